@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout request timeout of clients created with NewClient
+const DefaultTimeout = 30 * time.Second
+
+// Client typed client of the /api/v1 endpoints described in OpenAPI
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client for the server at baseURL eg.
+// "https://overrustlelogs.net"
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// LogsQuery pagination and filters of the day and user logs, zero values are
+// omitted
+type LogsQuery struct {
+	Cursor string
+	Limit  int
+	From   time.Time
+	To     time.Time
+	Filter string
+}
+
+func (q LogsQuery) values() url.Values {
+	v := url.Values{}
+	if q.Cursor != "" {
+		v.Set("cursor", q.Cursor)
+	}
+	if q.Limit != 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if !q.From.IsZero() {
+		v.Set("from", q.From.UTC().Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		v.Set("to", q.To.UTC().Format(time.RFC3339))
+	}
+	if q.Filter != "" {
+		v.Set("filter", q.Filter)
+	}
+	return v
+}
+
+// SearchQuery parameters of Search, zero values are omitted
+type SearchQuery struct {
+	Channel string
+	Query   string
+	Nick    string
+	From    time.Time
+	To      time.Time
+	Offset  int
+	Limit   int
+}
+
+func (q SearchQuery) values() url.Values {
+	v := url.Values{}
+	v.Set("channel", q.Channel)
+	v.Set("q", q.Query)
+	if q.Nick != "" {
+		v.Set("nick", q.Nick)
+	}
+	if !q.From.IsZero() {
+		v.Set("from", q.From.Format("2006-01-02"))
+	}
+	if !q.To.IsZero() {
+		v.Set("to", q.To.Format("2006-01-02"))
+	}
+	if q.Offset != 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Limit != 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// Channels lists the logged channels
+func (c *Client) Channels() ([]string, error) {
+	var v []string
+	return v, c.get(nil, &v, "channels.json")
+}
+
+// Months lists the months of a channel
+func (c *Client) Months(channel string) ([]string, error) {
+	var v []string
+	return v, c.get(nil, &v, channel, "months.json")
+}
+
+// Days lists the log files of a month
+func (c *Client) Days(channel, month string) ([]string, error) {
+	var v []string
+	return v, c.get(nil, &v, channel, month, "days.json")
+}
+
+// Users lists the user log files of a month
+func (c *Client) Users(channel, month string) ([]string, error) {
+	var v []string
+	return v, c.get(nil, &v, channel, month, "users.json")
+}
+
+// User returns a page of the messages of nick in a month
+func (c *Client) User(channel, month, nick string, q LogsQuery) (*Logs, error) {
+	v := &Logs{}
+	return v, c.get(q.values(), v, channel, month, "users", nick+".json")
+}
+
+// Day returns a page of the messages of a day, date is formatted as
+// 2006-01-02
+func (c *Client) Day(channel, month, date string, q LogsQuery) (*Logs, error) {
+	v := &Logs{}
+	return v, c.get(q.values(), v, channel, month, date+".json")
+}
+
+// Lines returns the line counts of the days of a month
+func (c *Client) Lines(channel, month string) (*Lines, error) {
+	v := &Lines{}
+	return v, c.get(nil, v, channel+" chatlog", month, "lines.json")
+}
+
+// Stalk returns the limit most recent lines of nick, 0 uses the server
+// default
+func (c *Client) Stalk(channel, nick string, limit int) (*Stalk, error) {
+	q := url.Values{}
+	if limit != 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	v := &Stalk{}
+	return v, c.get(q, v, "stalk", channel, nick+".json")
+}
+
+// Mentions returns the lines mentioning nick on date, an empty date is today
+// and a limit of 0 returns every mention
+func (c *Client) Mentions(channel, nick, date string, limit int) ([]Mention, error) {
+	q := url.Values{}
+	if date != "" {
+		q.Set("date", date)
+	}
+	if limit != 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var v []Mention
+	return v, c.get(q, &v, "mentions", channel, nick+".json")
+}
+
+// TopList returns the limit most active users of a month sorted by sort,
+// an empty sort orders by lines
+func (c *Client) TopList(channel, month string, limit int, sort string) (*TopList, error) {
+	q := url.Values{}
+	if sort != "" {
+		q.Set("sort", sort)
+	}
+	v := &TopList{}
+	return v, c.get(q, v, channel+" chatlog", month, "top"+strconv.Itoa(limit)+".json")
+}
+
+// Stats returns the activity stats of a month
+func (c *Client) Stats(channel, month string) (*Stats, error) {
+	v := &Stats{}
+	return v, c.get(nil, v, channel, month, "stats.json")
+}
+
+// Emotes returns the emote uses of a month, an empty nick returns the uses
+// of every nick
+func (c *Client) Emotes(channel, month, nick string) (*Emotes, error) {
+	q := url.Values{}
+	if nick != "" {
+		q.Set("nick", nick)
+	}
+	v := &Emotes{}
+	return v, c.get(q, v, channel, month, "emotes.json")
+}
+
+// UserProfile returns the channels nick spoke in
+func (c *Client) UserProfile(nick string) (*UserProfile, error) {
+	v := &UserProfile{}
+	return v, c.get(nil, v, "users", nick+".json")
+}
+
+// Search searches the indexed logs of a channel
+func (c *Client) Search(q SearchQuery) (*SearchResults, error) {
+	v := &SearchResults{}
+	return v, c.get(q.values(), v, "search")
+}
+
+// get decodes the json response of the endpoint at the joined path segments
+// into v, non 200 responses are returned as *Error
+func (c *Client) get(query url.Values, v interface{}, segments ...string) error {
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	u := c.BaseURL + "/api/v1/" + strings.Join(segments, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	res, err := c.HTTPClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: res.StatusCode}
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		if err := json.Unmarshal(body, e); err != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(body))
+		}
+		return e
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding %s %v", u, err)
+	}
+	return nil
+}
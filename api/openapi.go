@@ -0,0 +1,533 @@
+package api
+
+// OpenAPI OpenAPI 3 document of the /api/v1 endpoints, keep in sync with the
+// server routes and the types in this package
+const OpenAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "OverRustleLogs API",
+    "version": "1",
+    "description": "The re: terms of a filter query share a budget of matched text. Filtered routes fail with 422 once it's used up. The plain text day and user logs (/{channel} chatlog/{month}/{date}.txt and userlogs/{nick}.txt) take the same filter query parameter and stream their lines, they fail with 422 if the budget runs out before any line matched and otherwise end early with the X-Query-Truncated: true trailer."
+  },
+  "servers": [
+    {"url": "/api/v1"}
+  ],
+  "paths": {
+    "/channels.json": {
+      "get": {
+        "operationId": "channels",
+        "summary": "Logged channels",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Strings"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/search": {
+      "get": {
+        "operationId": "search",
+        "summary": "Search the indexed logs of a channel, newest first",
+        "parameters": [
+          {"name": "channel", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "q", "in": "query", "required": true, "schema": {"type": "string"}},
+          {"name": "nick", "in": "query", "schema": {"type": "string"}},
+          {"name": "from", "in": "query", "schema": {"type": "string", "format": "date"}},
+          {"name": "to", "in": "query", "schema": {"type": "string", "format": "date"}},
+          {"name": "offset", "in": "query", "schema": {"type": "integer", "minimum": 0}},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 1000}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Search results",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SearchResults"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/live": {
+      "get": {
+        "operationId": "live",
+        "summary": "Stream new lines of a channel over a websocket or server-sent events",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"name": "nick", "in": "query", "description": "comma separated nicks", "schema": {"type": "string"}},
+          {"$ref": "#/components/parameters/filter"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Event stream of SearchResult objects",
+            "content": {"text/event-stream": {"schema": {"$ref": "#/components/schemas/SearchResult"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "503": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/months.json": {
+      "get": {
+        "operationId": "months",
+        "summary": "Months of a channel",
+        "parameters": [{"$ref": "#/components/parameters/channel"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Strings"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/{month}/days.json": {
+      "get": {
+        "operationId": "days",
+        "summary": "Log files of a month",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Strings"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/{month}/users.json": {
+      "get": {
+        "operationId": "users",
+        "summary": "User log files of a month",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Strings"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/{month}/users/{nick}.json": {
+      "get": {
+        "operationId": "user",
+        "summary": "Parsed messages of a user in a month",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"},
+          {"$ref": "#/components/parameters/nick"},
+          {"$ref": "#/components/parameters/cursor"},
+          {"$ref": "#/components/parameters/pageLimit"},
+          {"$ref": "#/components/parameters/fromTime"},
+          {"$ref": "#/components/parameters/toTime"},
+          {"$ref": "#/components/parameters/filter"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Logs"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/{month}/stats.json": {
+      "get": {
+        "operationId": "stats",
+        "summary": "Activity stats of a month",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Stats",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Stats"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/{month}/emotes.json": {
+      "get": {
+        "operationId": "emotes",
+        "summary": "Emote uses of a month",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"},
+          {"name": "nick", "in": "query", "description": "only count the uses of nick", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Emote uses",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Emotes"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel}/{month}/{date}.json": {
+      "get": {
+        "operationId": "day",
+        "summary": "Parsed messages of a day",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"},
+          {"$ref": "#/components/parameters/date"},
+          {"$ref": "#/components/parameters/cursor"},
+          {"$ref": "#/components/parameters/pageLimit"},
+          {"$ref": "#/components/parameters/fromTime"},
+          {"$ref": "#/components/parameters/toTime"},
+          {"$ref": "#/components/parameters/filter"}
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Logs"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel} chatlog/{month}/lines.json": {
+      "get": {
+        "operationId": "lines",
+        "summary": "Line counts of the days of a month",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Line counts",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Lines"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/stalk/{channel}/{nick}.json": {
+      "get": {
+        "operationId": "stalk",
+        "summary": "Most recent lines of a nick",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/nick"},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 200, "default": 3}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Recent lines, oldest first",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Stalk"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/mentions/{channel}/{nick}.json": {
+      "get": {
+        "operationId": "mentions",
+        "summary": "Lines mentioning a nick on a day",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/nick"},
+          {"name": "date", "in": "query", "description": "defaults to today", "schema": {"type": "string", "format": "date"}},
+          {"name": "limit", "in": "query", "schema": {"type": "integer"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Mentions",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Mention"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/users/{nick}.json": {
+      "get": {
+        "operationId": "userProfile",
+        "summary": "Channels a nick spoke in",
+        "parameters": [
+          {"$ref": "#/components/parameters/nick"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Profile",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/UserProfile"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/{channel} chatlog/{month}/top{limit}.json": {
+      "get": {
+        "operationId": "topList",
+        "summary": "Most active users of a month",
+        "parameters": [
+          {"$ref": "#/components/parameters/channel"},
+          {"$ref": "#/components/parameters/month"},
+          {"name": "limit", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "sort", "in": "query", "schema": {"type": "string", "enum": ["lines", "bytes", "seen", "username"]}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Top list",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/TopList"}}}
+          },
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "operationId": "openAPI",
+        "summary": "This document",
+        "responses": {
+          "200": {"description": "OpenAPI document", "content": {"application/json": {}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "channel": {"name": "channel", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^[a-zA-Z0-9_-]+$"}},
+      "month": {"name": "month", "in": "path", "required": true, "example": "January 2020", "schema": {"type": "string", "pattern": "^[a-zA-Z]+ [0-9]{4}$"}},
+      "date": {"name": "date", "in": "path", "required": true, "schema": {"type": "string", "format": "date"}},
+      "nick": {"name": "nick", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^[a-zA-Z0-9_-]+$"}},
+      "cursor": {"name": "cursor", "in": "query", "description": "next cursor of the previous page", "schema": {"type": "string"}},
+      "pageLimit": {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 1000, "default": 100}},
+      "fromTime": {"name": "from", "in": "query", "description": "unix seconds or RFC 3339", "schema": {"type": "string"}},
+      "toTime": {"name": "to", "in": "query", "description": "unix seconds or RFC 3339", "schema": {"type": "string"}},
+      "filter": {"name": "filter", "in": "query", "description": "query of words, \"phrases\", AND, OR, NOT, parentheses, nick:, before:, after: and re: terms, a query using up its re: budget fails with 422", "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Error": {
+        "description": "Error",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      },
+      "Strings": {
+        "description": "Names",
+        "content": {"application/json": {"schema": {"type": "array", "items": {"type": "string"}}}}
+      },
+      "Logs": {
+        "description": "Page of messages",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Logs"}}}
+      }
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "required": ["message"],
+        "properties": {"message": {"type": "string"}}
+      },
+      "Lines": {
+        "type": "object",
+        "properties": {
+          "data": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "date": {"type": "string", "example": "2020-01-02T00:00:00+0000"},
+                "lines": {"type": "integer"}
+              }
+            }
+          }
+        }
+      },
+      "Stalk": {
+        "type": "object",
+        "properties": {
+          "nick": {"type": "string"},
+          "lines": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "timestamp": {"type": "integer", "format": "int64"},
+                "text": {"type": "string"}
+              }
+            }
+          }
+        }
+      },
+      "Mention": {
+        "type": "object",
+        "properties": {
+          "date": {"type": "integer", "format": "int64"},
+          "text": {"type": "string"},
+          "nick": {"type": "string"}
+        }
+      },
+      "TopList": {
+        "type": "object",
+        "properties": {
+          "sort": {"type": "string"},
+          "limit": {"type": "integer"},
+          "maxLimit": {"type": "integer"},
+          "generated": {"type": "string"},
+          "topList": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "Username": {"type": "string"},
+                "Lines": {"type": "integer"},
+                "Bytes": {"type": "integer"},
+                "Seen": {"type": "integer", "format": "int64"},
+                "SeenString": {"type": "string"},
+                "KiloBytes": {"type": "string"}
+              }
+            }
+          }
+        }
+      },
+      "UserProfile": {
+        "type": "object",
+        "properties": {
+          "nick": {"type": "string"},
+          "channels": {
+            "type": "array",
+            "description": "most recently active first",
+            "items": {
+              "type": "object",
+              "properties": {
+                "channel": {"type": "string"},
+                "firstSeen": {"type": "integer", "format": "int64", "description": "unix seconds, 0 when unknown"},
+                "lastSeen": {"type": "integer", "format": "int64", "description": "unix seconds, 0 when unknown"},
+                "lines": {"type": "integer"},
+                "bytes": {"type": "integer"},
+                "months": {
+                  "type": "array",
+                  "description": "newest first, totals are 0 until the month's toplist is generated",
+                  "items": {
+                    "type": "object",
+                    "properties": {
+                      "month": {"type": "string"},
+                      "lines": {"type": "integer"},
+                      "bytes": {"type": "integer"},
+                      "url": {"type": "string"}
+                    }
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "Stats": {
+        "type": "object",
+        "properties": {
+          "channel": {"type": "string"},
+          "month": {"type": "string"},
+          "lines": {"type": "integer"},
+          "chatters": {"type": "integer", "description": "unique nicks"},
+          "newChatters": {"type": "integer", "description": "chatters that didn't speak in the previous month"},
+          "returningChatters": {"type": "integer", "description": "chatters that spoke in the previous month"},
+          "hours": {"$ref": "#/components/schemas/Hours"},
+          "busiestMinute": {"$ref": "#/components/schemas/StatsMinute"},
+          "words": {"type": "array", "items": {"$ref": "#/components/schemas/TermCount"}},
+          "emotes": {"type": "array", "items": {"$ref": "#/components/schemas/TermCount"}},
+          "days": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "date": {"type": "string"},
+                "lines": {"type": "integer"},
+                "chatters": {"type": "integer"},
+                "newChatters": {"type": "integer", "description": "chatters that didn't speak earlier in the month or in the previous month"},
+                "returningChatters": {"type": "integer", "description": "chatters that spoke earlier in the month or in the previous month"},
+                "hours": {"$ref": "#/components/schemas/Hours"},
+                "busiestMinute": {"$ref": "#/components/schemas/StatsMinute"}
+              }
+            }
+          }
+        }
+      },
+      "Emotes": {
+        "type": "object",
+        "properties": {
+          "channel": {"type": "string"},
+          "month": {"type": "string"},
+          "nick": {"type": "string"},
+          "emotes": {
+            "type": "array",
+            "description": "most used first",
+            "items": {
+              "type": "object",
+              "properties": {
+                "emote": {"type": "string"},
+                "count": {"type": "integer"},
+                "users": {"type": "integer", "description": "nicks that used the emote"},
+                "days": {
+                  "type": "array",
+                  "items": {
+                    "type": "object",
+                    "properties": {
+                      "date": {"type": "string"},
+                      "count": {"type": "integer"}
+                    }
+                  }
+                }
+              }
+            }
+          }
+        }
+      },
+      "Hours": {
+        "type": "array",
+        "description": "line counts by UTC hour",
+        "minItems": 24,
+        "maxItems": 24,
+        "items": {"type": "integer"}
+      },
+      "StatsMinute": {
+        "type": "object",
+        "properties": {
+          "time": {"type": "integer", "format": "int64", "description": "unix seconds of the start of the minute"},
+          "lines": {"type": "integer"}
+        }
+      },
+      "TermCount": {
+        "type": "object",
+        "properties": {
+          "term": {"type": "string"},
+          "count": {"type": "integer"}
+        }
+      },
+      "SearchResult": {
+        "type": "object",
+        "properties": {
+          "timestamp": {"type": "integer", "format": "int64"},
+          "nick": {"type": "string"},
+          "text": {"type": "string"}
+        }
+      },
+      "SearchResults": {
+        "type": "object",
+        "properties": {
+          "channel": {"type": "string"},
+          "results": {"type": "array", "items": {"$ref": "#/components/schemas/SearchResult"}},
+          "next": {"type": "integer", "description": "offset of the next page"}
+        }
+      },
+      "Message": {
+        "type": "object",
+        "properties": {
+          "type": {"type": "string"},
+          "channel": {"type": "string"},
+          "nick": {"type": "string"},
+          "data": {"type": "string"},
+          "time": {"type": "string", "format": "date-time"},
+          "tags": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "Logs": {
+        "type": "object",
+        "properties": {
+          "channel": {"type": "string"},
+          "messages": {"type": "array", "items": {"$ref": "#/components/schemas/Message"}},
+          "next": {"type": "string", "description": "cursor of the next page"}
+        }
+      }
+    }
+  }
+}
+`
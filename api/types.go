@@ -0,0 +1,170 @@
+// Package api response types and client of the overrustlelogs /api/v1
+// endpoints
+package api
+
+import (
+	"fmt"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+// Error body of failed requests
+type Error struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+}
+
+// Lines line counts of the days of a month
+type Lines struct {
+	Data []DayLines `json:"data"`
+}
+
+// DayLines line count of a day, Date is formatted as 2006-01-02T15:04:05-0700
+type DayLines struct {
+	Date  string `json:"date"`
+	Lines int    `json:"lines"`
+}
+
+// Stalk most recent lines of a nick
+type Stalk struct {
+	Nick  string      `json:"nick"`
+	Lines []StalkLine `json:"lines"`
+}
+
+// StalkLine ...
+type StalkLine struct {
+	Timestamp int64  `json:"timestamp"`
+	Text      string `json:"text"`
+}
+
+// Mention line mentioning a nick
+type Mention struct {
+	Date int64  `json:"date"`
+	Text string `json:"text"`
+	Nick string `json:"nick"`
+}
+
+// TopList most active users of a month
+type TopList struct {
+	Sort      string         `json:"sort"`
+	Limit     int            `json:"limit"`
+	MaxLimit  int            `json:"maxLimit"`
+	Generated string         `json:"generated"`
+	Users     []*TopListUser `json:"topList"`
+}
+
+// TopListUser month totals of a nick, SeenString and KiloBytes format Seen
+// and Bytes for display
+type TopListUser struct {
+	Username   string
+	Lines      int
+	Bytes      int
+	Seen       int64
+	SeenString string
+	KiloBytes  string
+}
+
+// Stats activity of a channel in a month. Chatters are unique nicks, new
+// chatters didn't speak in the previous month and returning ones did. Words
+// and emotes are summed from the most used of each day.
+type Stats struct {
+	Channel           string             `json:"channel"`
+	Month             string             `json:"month"`
+	Lines             int                `json:"lines"`
+	Chatters          int                `json:"chatters"`
+	NewChatters       int                `json:"newChatters"`
+	ReturningChatters int                `json:"returningChatters"`
+	Hours             [24]int            `json:"hours"`
+	BusiestMinute     common.StatsMinute `json:"busiestMinute"`
+	Words             []common.TermCount `json:"words"`
+	Emotes            []common.TermCount `json:"emotes"`
+	Days              []DayStats         `json:"days"`
+}
+
+// DayStats activity of a day, new chatters didn't speak earlier in the month
+// or in the previous month and the others are returning. Hours are line
+// counts by UTC hour.
+type DayStats struct {
+	Date              string             `json:"date"`
+	Lines             int                `json:"lines"`
+	Chatters          int                `json:"chatters"`
+	NewChatters       int                `json:"newChatters"`
+	ReturningChatters int                `json:"returningChatters"`
+	Hours             [24]int            `json:"hours"`
+	BusiestMinute     common.StatsMinute `json:"busiestMinute"`
+}
+
+// Emotes emote uses in a channel in a month, most used first. Nick is set
+// when the uses are of a single nick.
+type Emotes struct {
+	Channel string       `json:"channel"`
+	Month   string       `json:"month"`
+	Nick    string       `json:"nick,omitempty"`
+	Emotes  []EmoteUsage `json:"emotes"`
+}
+
+// EmoteUsage uses of an emote, Users is the number of nicks that used it and
+// Days its uses on each day it was used
+type EmoteUsage struct {
+	Emote string     `json:"emote"`
+	Count int        `json:"count"`
+	Users int        `json:"users"`
+	Days  []DayCount `json:"days"`
+}
+
+// DayCount uses on a day, Date is formatted as 2006-01-02
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// UserProfile channels a nick spoke in, most recently active first
+type UserProfile struct {
+	Nick     string        `json:"nick"`
+	Channels []UserChannel `json:"channels"`
+}
+
+// UserChannel activity of a nick in a channel, seen times are unix times and
+// 0 when unknown. Months are newest first.
+type UserChannel struct {
+	Channel   string      `json:"channel"`
+	FirstSeen int64       `json:"firstSeen"`
+	LastSeen  int64       `json:"lastSeen"`
+	Lines     int         `json:"lines"`
+	Bytes     int         `json:"bytes"`
+	Months    []UserMonth `json:"months"`
+}
+
+// UserMonth line and byte totals of a nick in a month, from the month's
+// toplist once it is generated. URL is the month's userlogs page.
+type UserMonth struct {
+	Month string `json:"month"`
+	Lines int    `json:"lines"`
+	Bytes int    `json:"bytes"`
+	URL   string `json:"url"`
+}
+
+// SearchResult message matching a search, also sent by the live tail
+type SearchResult struct {
+	Timestamp int64  `json:"timestamp"`
+	Nick      string `json:"nick"`
+	Text      string `json:"text"`
+}
+
+// SearchResults page of search results, Next is the offset of the next page
+type SearchResults struct {
+	Channel string         `json:"channel"`
+	Results []SearchResult `json:"results"`
+	Next    int            `json:"next,omitempty"`
+}
+
+// Logs page of parsed log messages, Next is the cursor of the next page
+type Logs struct {
+	Channel  string            `json:"channel"`
+	Messages []*common.Message `json:"messages"`
+	Next     string            `json:"next,omitempty"`
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
@@ -30,7 +31,12 @@ const (
 	IgnoreLogListPath = "/bot/ignorelog.json"
 )
 
+// DefaultHTTPAddress metrics listener address when the config doesn't set one
+const DefaultHTTPAddress = ":8082"
+
 var validNick = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+
+var commandsTotal = common.Metrics.Counter("orl_bot_commands_total", "Bot commands run by name and result.", "command", "result")
 var configPath string
 
 func init() {
@@ -45,6 +51,7 @@ func main() {
 	b := NewBot(c)
 	go b.Run()
 	go c.Run()
+	go serveMetrics()
 
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
@@ -54,6 +61,25 @@ func main() {
 	os.Exit(0)
 }
 
+// serveMetrics serves the metrics endpoint
+func serveMetrics() {
+	addr := common.GetConfig().Bot.HTTPAddress
+	if addr == "" {
+		addr = DefaultHTTPAddress
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", common.Metrics.Handler())
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("error serving metrics %s", err)
+	}
+}
+
 type command func(m *common.Message, r *bufio.Reader) (string, error)
 
 // Bot commands
@@ -235,7 +261,13 @@ func (b *Bot) runCommand(commands map[string]command, m *common.Message) (string
 	if !ok {
 		return "", errors.New("not a valid command")
 	}
-	return cmd(m, r)
+	rs, err := cmd(m, r)
+	if err != nil {
+		commandsTotal.Inc(c, "error")
+	} else {
+		commandsTotal.Inc(c, "ok")
+	}
+	return rs, err
 }
 
 func (b *Bot) isNuked(text string) bool {
@@ -346,6 +378,13 @@ func (b *Bot) handleDestinyLogs(m *common.Message, r *bufio.Reader) (string, err
 	}
 
 	if rs != nil {
+		filter, err := readLogFilter(r)
+		if err != nil {
+			return m.Nick + " invalid filter: " + err.Error(), nil
+		}
+		if filter != "" {
+			return rs.Month() + " logs. " + b.toURL(common.GetConfig().DestinyGG.LogHost, "/"+destinyPath+"/"+rs.Month()+"/userlogs/"+rs.Nick()+".txt") + "?filter=" + url.QueryEscape(filter), nil
+		}
 		return rs.Month() + " logs. " + b.toURL(common.GetConfig().DestinyGG.LogHost, "/"+rs.Nick()), nil
 	}
 	return b.toURL(common.GetConfig().DestinyGG.LogHost, ""), nil
@@ -358,6 +397,13 @@ func (b *Bot) handleTwitchLogs(m *common.Message, r *bufio.Reader) (string, erro
 	}
 
 	if rs != nil {
+		filter, err := readLogFilter(r)
+		if err != nil {
+			return m.Nick + " invalid filter: " + err.Error(), nil
+		}
+		if filter != "" {
+			return rs.Month() + " logs. " + b.toURL(common.GetConfig().Twitch.LogHost, "/"+twitchPath+"/"+rs.Month()+"/userlogs/"+rs.Nick()+".txt") + "?filter=" + url.QueryEscape(filter), nil
+		}
 		return rs.Month() + " logs. " + b.toURL(common.GetConfig().Twitch.LogHost, "/Destiny/"+rs.Nick()), nil
 	}
 	return b.toURL(common.GetConfig().Twitch.LogHost, "/Destiny"), nil
@@ -384,6 +430,23 @@ func (b *Bot) searchNickFromLine(path string, r *bufio.Reader) (*common.NickSear
 	return rs, "", nil
 }
 
+// readLogFilter reads the optional filter query following the nick of a log
+// command
+func readLogFilter(r *bufio.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	filter := strings.TrimSpace(string(data))
+	if filter == "" {
+		return "", nil
+	}
+	if _, err := common.ParseQuery(filter); err != nil {
+		return "", err
+	}
+	return filter, nil
+}
+
 func (b *Bot) handleSimpleNuke(m *common.Message, r *bufio.Reader) (string, error) {
 	return b.handleNuke(m, 10*time.Minute, r)
 }
@@ -53,12 +53,30 @@ func TestTlogs(t *testing.T) {
 	}
 }
 
+func TestLogsFilter(t *testing.T) {
+	tests := []*common.Message{
+		{Type: "MSG", Nick: "Destiny", Data: "!tlog Destiny nick:destiny re:^kappa", Time: time.Now()},
+		{Type: "MSG", Nick: "Destiny", Data: "!tlog Destiny (kappa", Time: time.Now()},
+	}
+	expected := []string{
+		"?filter=nick%3Adestiny+re%3A%5Ekappa",
+		"Destiny invalid filter: ",
+	}
+	for i, test := range tests {
+		if got, err := b.runCommand(b.public, test); err != nil {
+			t.Errorf("error running tlogs %s", err.Error())
+		} else if !strings.Contains(got, expected[i]) {
+			t.Errorf("invalid log response, got: %s; want: %s;", got, expected[i])
+		}
+	}
+}
+
 func TestMentions(t *testing.T) {
 	tests := []*common.Message{
-		{"MSG", "", "Destiny", "!mentions", time.Now()},
-		{"MSG", "", "Destiny", "!mentions 2017-01-10", time.Now()},
-		{"MSG", "", "Destiny", "!mentions 01-02-2017", time.Now()},
-		{"MSG", "", "Destiny", "!mentions 3000-01-10", time.Now()},
+		{Type: "MSG", Nick: "Destiny", Data: "!mentions", Time: time.Now()},
+		{Type: "MSG", Nick: "Destiny", Data: "!mentions 2017-01-10", Time: time.Now()},
+		{Type: "MSG", Nick: "Destiny", Data: "!mentions 01-02-2017", Time: time.Now()},
+		{Type: "MSG", Nick: "Destiny", Data: "!mentions 3000-01-10", Time: time.Now()},
 	}
 	expected := []string{
 		"Destiny dgg.overrustlelogs.net/mentions/Destiny",
@@ -78,7 +96,7 @@ func TestMentions(t *testing.T) {
 
 func TestMentionsFail(t *testing.T) {
 	tests := []*common.Message{
-		{"MSG", "", "Destiny", time.Now().Add(24 * time.Hour).Format("!mentions 2006-01-02"), time.Now()},
+		{Type: "MSG", Nick: "Destiny", Data: time.Now().Add(24 * time.Hour).Format("!mentions 2006-01-02"), Time: time.Now()},
 	}
 	expected := []string{
 		"Destiny BASEDWATM8 i can't look into the future.",
@@ -0,0 +1,67 @@
+package common
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Backoff exponential reconnect delay with jitter, every connection keeps its
+// own state so clients don't retry in lockstep
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	Jitter float64
+
+	mu      sync.Mutex
+	attempt int
+	rand    *rand.Rand
+}
+
+// NewBackoff backoff using the default socket reconnect delays
+func NewBackoff() *Backoff {
+	return &Backoff{
+		Min:    SocketReconnectMinDelay,
+		Max:    SocketReconnectMaxDelay,
+		Factor: 2,
+		Jitter: 0.5,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Next returns the delay before the next attempt
+func (b *Backoff) Next() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d := float64(b.Min)
+	for i := 0; i < b.attempt && d < float64(b.Max); i++ {
+		d *= b.Factor
+	}
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	b.attempt++
+
+	// spread out the upper part of the delay
+	if b.Jitter > 0 {
+		j := d * b.Jitter
+		d = d - j + j*b.rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Reset resets the attempt counter after a successful connection
+func (b *Backoff) Reset() {
+	b.mu.Lock()
+	b.attempt = 0
+	b.mu.Unlock()
+}
+
+// Attempt number of failed attempts since the last reset
+func (b *Backoff) Attempt() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.attempt
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff()
+	b.Min = time.Second
+	b.Max = 10 * time.Second
+
+	prevMax := time.Duration(0)
+	for i := 0; i < 10; i++ {
+		d := b.Next()
+		if d > b.Max {
+			t.Fatalf("delay above max, got: %s; want <= %s", d, b.Max)
+		}
+		if d < time.Duration(float64(b.Min)*(1-b.Jitter)) {
+			t.Fatalf("delay below min, got: %s", d)
+		}
+		if d > prevMax {
+			prevMax = d
+		}
+	}
+	if prevMax < 5*time.Second {
+		t.Errorf("delay did not grow, max: %s", prevMax)
+	}
+
+	b.Reset()
+	if d := b.Next(); d > b.Min {
+		t.Errorf("delay not reset, got: %s; want <= %s", d, b.Min)
+	}
+}
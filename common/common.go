@@ -8,24 +8,27 @@ import (
 
 // const ...
 const (
-	HandshakeTimeout     = 10 * time.Second
-	MaxChannelsPerChat   = 50
-	MessageBufferSize    = 1000
-	SocketReadTimeout    = 6 * time.Minute
-	SocketReconnectDelay = 20 * time.Second
-	SocketWriteDebounce  = 500 * time.Millisecond
-	SocketWriteTimeout   = 5 * time.Second
+	HandshakeTimeout        = 10 * time.Second
+	IRCJoinInterval         = time.Second
+	MaxChannelsPerChat      = 50
+	MessageBufferSize       = 1000
+	SocketReadTimeout       = 6 * time.Minute
+	SocketReconnectMinDelay = 2 * time.Second
+	SocketReconnectMaxDelay = 5 * time.Minute
+	SocketWriteDebounce     = 500 * time.Millisecond
+	SocketWriteTimeout      = 5 * time.Second
 )
 
 var messageNickPathUnsafe = regexp.MustCompile("[^a-zA-Z0-9_-]")
 
 // Message data
 type Message struct {
-	Type    string
-	Channel string
-	Nick    string
-	Data    string
-	Time    time.Time
+	Type    string            `json:"type"`
+	Channel string            `json:"channel"`
+	Nick    string            `json:"nick"`
+	Data    string            `json:"data"`
+	Time    time.Time         `json:"time"`
+	Tags    map[string]string `json:"tags,omitempty"`
 }
 
 func (m *Message) String() string {
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -27,24 +28,62 @@ func WriteCompressedFile(path string, data []byte) (*os.File, error) {
 	return f, nil
 }
 
-// ReadCompressedFile read compressed file
-func ReadCompressedFile(path string) ([]byte, error) {
-	f, err := os.Open(gzPath(path))
+// CreateCompressedFile creates or truncates a compressed file for streaming
+// compression, the file is complete once the writer is closed
+func CreateCompressedFile(path string) (io.WriteCloser, error) {
+	f, err := os.OpenFile(gzPath(path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return &compressedWriter{zstd.NewWriter(f), f}, nil
+}
 
-	data, err := ioutil.ReadAll(f)
+// compressedWriter compressing writer closing its underlying file
+type compressedWriter struct {
+	*zstd.Writer
+	f *os.File
+}
+
+func (c *compressedWriter) Close() error {
+	err := c.Writer.Close()
+	if ferr := c.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// ReadCompressedFile read compressed file, large files should be streamed
+// with OpenCompressedFile instead
+func ReadCompressedFile(path string) ([]byte, error) {
+	r, err := OpenCompressedFile(path)
 	if err != nil {
 		return nil, err
 	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
 
-	dData, err := zstd.Decompress(nil, data)
+// OpenCompressedFile opens a compressed file for streaming decompression
+func OpenCompressedFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(gzPath(path))
 	if err != nil {
 		return nil, err
 	}
-	return dData, nil
+	return &compressedFile{zstd.NewReader(f), f}, nil
+}
+
+// compressedFile decompressing reader closing its underlying file
+type compressedFile struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (c *compressedFile) Close() error {
+	err := c.ReadCloser.Close()
+	if ferr := c.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
 }
 
 // CompressFile compress an existing file
@@ -53,13 +92,18 @@ func CompressFile(path string) (*os.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	data, err := ioutil.ReadAll(s)
-	s.Close()
+	defer s.Close()
+	d, err := os.OpenFile(gzPath(path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
-	d, err := WriteCompressedFile(path, data)
-	if err != nil {
+	defer d.Close()
+	w := zstd.NewWriter(d)
+	if _, err := io.Copy(w, s); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
 		return nil, err
 	}
 	if err := os.Remove(path); err != nil {
@@ -70,16 +114,17 @@ func CompressFile(path string) (*os.File, error) {
 
 // UncompressFile uncompress an existing file
 func UncompressFile(path string) (*os.File, error) {
-	d, err := ReadCompressedFile(path)
+	r, err := OpenCompressedFile(path)
 	if err != nil {
 		return nil, err
 	}
+	defer r.Close()
 	f, err := os.OpenFile(strings.Replace(path, ".gz", "", -1), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	if _, err := f.Write(d); err != nil {
+	if _, err := io.Copy(f, r); err != nil {
 		return nil, err
 	}
 	if err := os.Remove(gzPath(path)); err != nil {
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "2020-03-01.txt")
+
+	lines := []string{
+		"[2020-03-01 10:00:00 UTC] Bob: hello\n",
+		"[2020-03-01 10:00:01 UTC] Alice: " + strings.Repeat("a", LineReaderSize*2) + "\n",
+		"[2020-03-01 10:00:02 UTC] Bob: bye\n",
+	}
+	w, err := CreateCompressedFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := io.WriteString(w, "[2020-03-01 10:00:03 UTC] Bob: unterminated"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenCompressedFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	lr := NewLineReader(r)
+	for i := 0; ; i++ {
+		line, err := lr.Next()
+		if err == io.EOF {
+			if i != len(lines) {
+				t.Errorf("read %d lines, want %d", i, len(lines))
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(lines) || string(line) != lines[i] {
+			t.Errorf("line %d = %.40q", i, line)
+		}
+	}
+
+	data, err := ReadCompressedFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), strings.Join(lines, "")) {
+		t.Error("ReadCompressedFile doesn't match the written lines")
+	}
+}
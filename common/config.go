@@ -25,10 +25,48 @@ type Config struct {
 		CommandChannel string   `toml:"commandChannel"`
 	} `toml:"twitch"`
 	Bot struct {
-		Admins []string `toml:"admins"`
+		Admins      []string `toml:"admins"`
+		HTTPAddress string   `toml:"httpAddress"`
 	} `toml:"bot"`
-	LogHost     string `toml:"logHost"`
-	MaxOpenLogs int    `toml:"maxOpenLogs"`
+	Logger struct {
+		JournalPath  string `toml:"journalPath"`
+		HTTPAddress  string `toml:"httpAddress"`
+		SeekableLogs bool   `toml:"seekableLogs"`
+		FrameLines   int    `toml:"frameLines"`
+	} `toml:"logger"`
+	Jobs struct {
+		Enabled        bool                   `toml:"enabled"`
+		HistoryPath    string                 `toml:"historyPath"`
+		CatchUp        int                    `toml:"catchUp"`
+		BigQueryConfig string                 `toml:"bigQueryConfig"`
+		Schedule       map[string]JobSchedule `toml:"schedule"`
+	} `toml:"jobs"`
+	Sources     []SourceConfig `toml:"sources"`
+	LogHost     string         `toml:"logHost"`
+	MaxOpenLogs int            `toml:"maxOpenLogs"`
+	EmotesPath  string         `toml:"emotesPath"`
+}
+
+// SourceConfig chat source the logger reads from, the irc fields are used
+// by "irc" sources
+type SourceConfig struct {
+	Type          string   `toml:"type"`
+	Name          string   `toml:"name"`
+	Server        string   `toml:"server"`
+	TLS           bool     `toml:"tls"`
+	Nick          string   `toml:"nick"`
+	User          string   `toml:"user"`
+	Password      string   `toml:"password"`
+	Auth          string   `toml:"auth"`
+	Channels      []string `toml:"channels"`
+	ChannelPrefix string   `toml:"channelPrefix"`
+}
+
+// JobSchedule when a job runs, every is "daily" or "monthly" (on the 1st)
+// and at is the UTC time of day formatted as 15:04
+type JobSchedule struct {
+	Every string `toml:"every"`
+	At    string `toml:"at"`
 }
 
 var config *Config
@@ -3,10 +3,13 @@ package common
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,10 +18,14 @@ import (
 // Destiny destiny.gg chat client
 type Destiny struct {
 	connLock      sync.Mutex
+	sendLock      sync.Mutex
+	connected     bool
 	conn          *websocket.Conn
 	lastMessageMu sync.RWMutex
 	lastMessage   time.Time
 	messages      chan *Message
+	backoff       *Backoff
+	dropped       uint64
 	quit          chan struct{}
 }
 
@@ -26,57 +33,87 @@ type Destiny struct {
 func NewDestiny() *Destiny {
 	return &Destiny{
 		messages: make(chan *Message, MessageBufferSize),
-		quit:     make(chan struct{}, 2),
+		backoff:  NewBackoff(),
+		quit:     make(chan struct{}),
 	}
 }
 
 // Connect open ws connection
-func (c *Destiny) connect() {
+func (c *Destiny) connect() error {
 	dialer := websocket.Dialer{HandshakeTimeout: HandshakeTimeout}
 	header := http.Header{
 		"Origin": []string{GetConfig().DestinyGG.OriginURL},
 		"Cookie": []string{GetConfig().DestinyGG.Cookie},
 	}
-	var err error
-	c.connLock.Lock()
-	c.conn, _, err = dialer.Dial(GetConfig().DestinyGG.SocketURL, header)
-	c.connLock.Unlock()
+	conn, _, err := dialer.Dial(GetConfig().DestinyGG.SocketURL, header)
 	if err != nil {
-		log.Printf("error connecting to destiny ws %s", err)
-		c.reconnect()
-		return
+		return fmt.Errorf("error connecting to destiny ws %s", err)
 	}
+	c.connLock.Lock()
+	c.conn = conn
+	c.connected = true
+	c.connLock.Unlock()
 	log.Printf("connected to destiny ws")
 
-	go func() {
-		timeout := time.NewTimer(2 * time.Minute)
-		for range timeout.C {
-			c.lastMessageMu.RLock()
-			if time.Now().Sub(c.lastMessage).Minutes() > 2 {
-				log.Println("destiny timeout triggered")
-				c.lastMessageMu.RUnlock()
-				c.reconnect()
-				continue
-			}
-			c.lastMessageMu.RUnlock()
+	connected := time.Now()
+	time.AfterFunc(2*time.Minute, func() {
+		c.lastMessageMu.RLock()
+		stale := c.lastMessage.Before(connected)
+		c.lastMessageMu.RUnlock()
+		if stale {
+			log.Println("destiny timeout triggered")
+			conn.Close()
 		}
-	}()
+	})
+	return nil
 }
 
-func (c *Destiny) reconnect() {
+// reconnect closes the current connection and retries connecting with
+// backoff until it succeeds or the client is stopped
+func (c *Destiny) reconnect() bool {
+	c.drop()
+	for {
+		delay := c.backoff.Next()
+		sourceReconnects.Inc(c.Name())
+		log.Printf("reconnecting to destiny in %s", delay)
+		select {
+		case <-c.quit:
+			return false
+		case <-time.After(delay):
+		}
+		err := c.connect()
+		if err == nil {
+			return true
+		}
+		log.Println(err)
+	}
+}
+
+// drop closes the current connection which makes the read loop reconnect
+func (c *Destiny) drop() {
 	c.connLock.Lock()
+	c.connected = false
 	if c.conn != nil {
 		c.conn.Close()
 	}
 	c.connLock.Unlock()
-	time.Sleep(SocketReconnectDelay)
-	c.connect()
+}
+
+func (c *Destiny) getConn() *websocket.Conn {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.conn
 }
 
 // Run connect and start message read loop
 func (c *Destiny) Run() {
-	c.connect()
 	defer close(c.messages)
+	if err := c.connect(); err != nil {
+		log.Println(err)
+		if !c.reconnect() {
+			return
+		}
+	}
 	for {
 		select {
 		case <-c.quit:
@@ -84,21 +121,21 @@ func (c *Destiny) Run() {
 		default:
 		}
 
-		err := c.conn.SetReadDeadline(time.Now().Add(SocketReadTimeout))
+		conn := c.getConn()
+		err := conn.SetReadDeadline(time.Now().Add(SocketReadTimeout))
 		if err != nil {
 			log.Println("SetReadDeadline triggered, reconnecting")
 			c.reconnect()
 			continue
 		}
 
-		c.connLock.Lock()
-		_, msg, err := c.conn.ReadMessage()
-		c.connLock.Unlock()
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("error reading from websocket %s", err)
 			c.reconnect()
 			continue
 		}
+		c.backoff.Reset()
 
 		index := bytes.IndexByte(msg, ' ')
 		if index == -1 || len(msg) < index+1 {
@@ -107,7 +144,9 @@ func (c *Destiny) Run() {
 		}
 
 		if strings.Index(string(msg), "PING") == 0 {
-			err := c.conn.WriteMessage(websocket.TextMessage, bytes.Replace(msg, []byte("PING"), []byte("PONG"), -1))
+			c.sendLock.Lock()
+			err := conn.WriteMessage(websocket.TextMessage, bytes.Replace(msg, []byte("PING"), []byte("PONG"), -1))
+			c.sendLock.Unlock()
 			if err != nil {
 				c.reconnect()
 			}
@@ -134,6 +173,9 @@ func (c *Destiny) Run() {
 			Time:    time.Unix(data.Timestamp/1000, 0).UTC(),
 		}:
 		default:
+			atomic.AddUint64(&c.dropped, 1)
+			sourceDropped.Inc(c.Name())
+			log.Println("error messages channel full :(")
 		}
 		c.lastMessageMu.Lock()
 		c.lastMessage = time.Now()
@@ -143,17 +185,50 @@ func (c *Destiny) Run() {
 
 // Stop ...
 func (c *Destiny) Stop() {
-	c.quit <- struct{}{}
-	c.connLock.Lock()
-	if c.conn != nil {
-		c.conn.Close()
-	}
-	c.connLock.Unlock()
+	close(c.quit)
+	c.drop()
 }
 
 // Messages channel accessor
 func (c *Destiny) Messages() <-chan *Message { return c.messages }
 
+// Dropped number of messages dropped because the messages channel was full
+func (c *Destiny) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Status connection state
+func (c *Destiny) Status() []ConnStatus {
+	c.connLock.Lock()
+	connected := c.connected
+	c.connLock.Unlock()
+	c.lastMessageMu.RLock()
+	last := c.lastMessage
+	c.lastMessageMu.RUnlock()
+	channels := 1
+	return []ConnStatus{{
+		Connected:   connected,
+		LastMessage: last,
+		Channels:    channels,
+	}}
+}
+
+// Name source name
+func (c *Destiny) Name() string { return "destinygg" }
+
+// Join destiny.gg has a single channel
+func (c *Destiny) Join(ch string) error {
+	if strings.EqualFold(ch, "destinygg") {
+		return nil
+	}
+	return ErrJoinUnsupported
+}
+
+// Leave destiny.gg has a single channel
+func (c *Destiny) Leave(ch string) error {
+	return ErrJoinUnsupported
+}
+
 func (c *Destiny) send(command string, msg map[string]string) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -163,9 +238,16 @@ func (c *Destiny) send(command string, msg map[string]string) error {
 	buf.WriteString(command)
 	buf.WriteString(" ")
 	buf.Write(data)
-	if err := c.conn.WriteMessage(websocket.TextMessage, buf.Bytes()); err != nil {
+	conn := c.getConn()
+	if conn == nil {
+		return errors.New("not connected")
+	}
+	c.sendLock.Lock()
+	err = conn.WriteMessage(websocket.TextMessage, buf.Bytes())
+	c.sendLock.Unlock()
+	if err != nil {
 		log.Printf("error sending message %s", err)
-		c.reconnect()
+		c.drop()
 		return err
 	}
 	return nil
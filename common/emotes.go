@@ -0,0 +1,134 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Emote registries are JSON arrays of emote names in the emotes directory,
+// GlobalEmotesFile holds the emotes of every channel and <channel>.json, the
+// lower case channel name, the emotes of a channel:
+//
+//	["OverRustle", "Kappa", "PepeLaugh"]
+//
+// Emote uses of each nick are stored next to each day log, named after it
+// with DayEmotesExtension, as zstd compressed JSON objects whose version
+// field is StatsVersion.
+const (
+	GlobalEmotesFile   = "global.json"
+	DayEmotesExtension = ".emotes"
+)
+
+// EmoteRegistry emote names of a channel, names are case sensitive
+type EmoteRegistry map[string]struct{}
+
+// LoadEmoteRegistry reads the global and channel emotes in dir, missing
+// files are empty and an empty dir is an empty registry
+func LoadEmoteRegistry(dir, channel string) (EmoteRegistry, error) {
+	r := EmoteRegistry{}
+	if dir == "" {
+		return r, nil
+	}
+	for _, name := range []string{GlobalEmotesFile, strings.ToLower(channel) + ".json"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return r, err
+		}
+		var emotes []string
+		if err := json.Unmarshal(data, &emotes); err != nil {
+			return r, fmt.Errorf("error decoding emotes %s %v", name, err)
+		}
+		for _, emote := range emotes {
+			r[emote] = struct{}{}
+		}
+	}
+	return r, nil
+}
+
+// Has checks if word is a registered emote
+func (r EmoteRegistry) Has(word string) bool {
+	_, ok := r[word]
+	return ok
+}
+
+// Emotes returns the emotes used in text, the words that are registered or
+// marked by the Twitch emote positions of tagged
+func (r EmoteRegistry) Emotes(text string, tagged []Emote) []string {
+	return r.emotes(text, tagged, true)
+}
+
+// TaggedEmotes returns the emotes of text only known from tagged, the words
+// marked by tagged that aren't registered
+func (r EmoteRegistry) TaggedEmotes(text string, tagged []Emote) []string {
+	return r.emotes(text, tagged, false)
+}
+
+func (r EmoteRegistry) emotes(text string, tagged []Emote, registered bool) []string {
+	names := taggedEmoteNames(text, tagged)
+	if len(names) == 0 && (!registered || len(r) == 0) {
+		return nil
+	}
+	var emotes []string
+	for _, w := range strings.Fields(text) {
+		_, ok := names[w]
+		if r.Has(w) {
+			ok = registered
+		}
+		if ok {
+			emotes = append(emotes, w)
+		}
+	}
+	return emotes
+}
+
+// taggedEmoteNames text of the emotes marked by tagged, positions are in
+// runes
+func taggedEmoteNames(text string, tagged []Emote) map[string]struct{} {
+	if len(tagged) == 0 {
+		return nil
+	}
+	runes := []rune(text)
+	names := make(map[string]struct{}, len(tagged))
+	for _, e := range tagged {
+		if e.Start < 0 || e.End < e.Start || e.End >= len(runes) {
+			continue
+		}
+		names[string(runes[e.Start:e.End+1])] = struct{}{}
+	}
+	return names
+}
+
+// DayEmotes emote uses of each nick on a day
+type DayEmotes struct {
+	Version int                       `json:"version"`
+	Date    string                    `json:"date"`
+	Nicks   map[string]map[string]int `json:"nicks"`
+}
+
+// ReadDayEmotes reads the emote uses of the day log at path
+func ReadDayEmotes(path string) (*DayEmotes, error) {
+	data, err := ReadCompressedFile(dayFilePath(path, DayEmotesExtension))
+	if err != nil {
+		return nil, err
+	}
+	d := &DayEmotes{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("error decoding emotes %s %v", path, err)
+	}
+	if d.Version != StatsVersion {
+		return nil, fmt.Errorf("unsupported emotes version %d in %s", d.Version, path)
+	}
+	return d, nil
+}
+
+// WriteDayEmotes writes the emote uses of the day log at path
+func WriteDayEmotes(path string, d *DayEmotes) error {
+	d.Version = StatsVersion
+	return writeDayFile(dayFilePath(path, DayEmotesExtension), d)
+}
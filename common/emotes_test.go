@@ -0,0 +1,103 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmoteRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, GlobalEmotesFile), []byte(`["Kappa"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "destinygg.json"), []byte(`["OverRustle", "PepeLaugh"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadEmoteRegistry(dir, "Destinygg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 3 || !r.Has("OverRustle") || r.Has("overrustle") {
+		t.Errorf("registry = %v", r)
+	}
+	if r, err := LoadEmoteRegistry(dir, "Foo"); err != nil || len(r) != 1 {
+		t.Errorf("channel without emotes = %v %v", r, err)
+	}
+
+	// PogChamp is only known from the tags
+	text := "OverRustle PogChamp Kappa overrustle"
+	tagged := ParseEmotes("88:11-18/25:20-24")
+	if e := r.Emotes(text, tagged); !reflect.DeepEqual(e, []string{"OverRustle", "PogChamp", "Kappa"}) {
+		t.Errorf("emotes = %v", e)
+	}
+	if e := r.TaggedEmotes(text, tagged); !reflect.DeepEqual(e, []string{"PogChamp"}) {
+		t.Errorf("tagged emotes = %v", e)
+	}
+}
+
+func TestDayEmotes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "emotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "2020-03-01.txt")
+
+	log := "[2020-03-01 10:00:00 UTC] Bob: OverRustle hi OverRustle\n" +
+		"[2020-03-01 10:00:01 UTC] Alice: PogChamp OverRustle\n"
+	records := `{"ts":1583056800000,"type":"MSG","nick":"Bob","text":"OverRustle hi OverRustle"}` + "\n" +
+		`{"ts":1583056801000,"type":"MSG","nick":"Alice","text":"PogChamp OverRustle","emotes":[{"id":"88","start":0,"end":7}]}` + "\n"
+	if _, err := WriteCompressedFile(path, []byte(log)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteCompressedFile(filepath.Join(dir, "2020-03-01.jsonl"), []byte(records)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := BuildDayStats(path, EmoteRegistry{"OverRustle": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteDayEmotes(path, c.Emotes()); err != nil {
+		t.Fatal(err)
+	}
+	d, err := ReadDayEmotes(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]int{
+		"Bob":   {"OverRustle": 2},
+		"Alice": {"OverRustle": 1, "PogChamp": 1},
+	}
+	if d.Date != "2020-03-01" || !reflect.DeepEqual(d.Nicks, want) {
+		t.Errorf("emotes = %+v", d)
+	}
+	if e := c.Stats().Emotes; len(e) != 2 || e[0] != (TermCount{"OverRustle", 3}) {
+		t.Errorf("stats emotes = %+v", e)
+	}
+
+	// live messages count the same emotes
+	live := NewDayStatsCounter("2020-03-01", EmoteRegistry{"OverRustle": {}})
+	for _, line := range strings.Split(strings.TrimSpace(log), "\n") {
+		m, err := ParseMessageLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Nick == "Alice" {
+			m.Tags = map[string]string{"emotes": "88:0-7"}
+		}
+		live.Add(m)
+	}
+	if e := live.Emotes(); !reflect.DeepEqual(e.Nicks, want) {
+		t.Errorf("live emotes = %+v", e.Nicks)
+	}
+}
@@ -0,0 +1,163 @@
+package common
+
+import (
+	"errors"
+	"strings"
+)
+
+// IRCMessage IRCv3 message
+// > @tags :prefix COMMAND param1 param2 :trailing param
+type IRCMessage struct {
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// ErrEmptyIRCMessage returned when parsing a line without a command
+var ErrEmptyIRCMessage = errors.New("empty irc message")
+
+// ParseIRCMessage parses a single line without the trailing CRLF
+func ParseIRCMessage(line string) (*IRCMessage, error) {
+	m := &IRCMessage{}
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return nil, ErrEmptyIRCMessage
+		}
+		m.Tags = ParseTags(line[1:i])
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return nil, ErrEmptyIRCMessage
+		}
+		m.Prefix = line[1:i]
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+
+	for line != "" {
+		if line[0] == ':' {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			m.Params = append(m.Params, line)
+			break
+		}
+		m.Params = append(m.Params, line[:i])
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+
+	if len(m.Params) == 0 {
+		return nil, ErrEmptyIRCMessage
+	}
+	m.Command = strings.ToUpper(m.Params[0])
+	m.Params = m.Params[1:]
+	return m, nil
+}
+
+// Nick nick part of the prefix
+func (m *IRCMessage) Nick() string {
+	if i := strings.IndexAny(m.Prefix, "!@"); i != -1 {
+		return m.Prefix[:i]
+	}
+	return m.Prefix
+}
+
+// Param returns the i-th param or an empty string
+func (m *IRCMessage) Param(i int) string {
+	if i < 0 || i >= len(m.Params) {
+		return ""
+	}
+	return m.Params[i]
+}
+
+// Trailing returns the last param
+func (m *IRCMessage) Trailing() string {
+	return m.Param(len(m.Params) - 1)
+}
+
+// String formats the message as a raw line without the trailing CRLF
+func (m *IRCMessage) String() string {
+	var b strings.Builder
+	if len(m.Tags) > 0 {
+		b.WriteByte('@')
+		first := true
+		for k, v := range m.Tags {
+			if !first {
+				b.WriteByte(';')
+			}
+			first = false
+			b.WriteString(k)
+			if v != "" {
+				b.WriteByte('=')
+				b.WriteString(tagValueEscaper.Replace(v))
+			}
+		}
+		b.WriteByte(' ')
+	}
+	if m.Prefix != "" {
+		b.WriteByte(':')
+		b.WriteString(m.Prefix)
+		b.WriteByte(' ')
+	}
+	b.WriteString(m.Command)
+	for i, p := range m.Params {
+		b.WriteByte(' ')
+		if i == len(m.Params)-1 && (p == "" || p[0] == ':' || strings.IndexByte(p, ' ') != -1) {
+			b.WriteByte(':')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// ctcpAction extracts the text of a CTCP ACTION, ok is false for other text
+func ctcpAction(text string) (string, bool) {
+	if !strings.HasPrefix(text, "\x01ACTION") {
+		return text, false
+	}
+	text = strings.TrimPrefix(text, "\x01ACTION")
+	text = strings.TrimSuffix(text, "\x01")
+	return strings.TrimSpace(text), true
+}
+
+var (
+	tagValueReplacer = strings.NewReplacer(
+		"\\:", ";",
+		"\\s", " ",
+		"\\\\", "\\",
+		"\\r", "\r",
+		"\\n", "\n",
+	)
+	tagValueEscaper = strings.NewReplacer(
+		";", "\\:",
+		" ", "\\s",
+		"\\", "\\\\",
+		"\r", "\\r",
+		"\n", "\\n",
+	)
+)
+
+// ParseTags parses an IRCv3 tags block without the leading @
+func ParseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ";") {
+		if tag == "" {
+			continue
+		}
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) == 1 {
+			tags[parts[0]] = ""
+			continue
+		}
+		tags[parts[0]] = tagValueReplacer.Replace(parts[1])
+	}
+	return tags
+}
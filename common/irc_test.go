@@ -0,0 +1,58 @@
+package common
+
+import "testing"
+
+func TestParseIRCMessage(t *testing.T) {
+	m, err := ParseIRCMessage(`@badges=moderator/1;display-name=Ronni;system-msg=hello\sworld\:\\ :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #dallas :Kappa Keepo Kappa`)
+	if err != nil {
+		t.Fatalf("error parsing message %s", err)
+	}
+	if m.Command != "PRIVMSG" || m.Nick() != "ronni" || m.Param(0) != "#dallas" || m.Trailing() != "Kappa Keepo Kappa" {
+		t.Errorf("invalid message, got: %+v", m)
+	}
+	if got := m.Tags["system-msg"]; got != `hello world;\` {
+		t.Errorf("invalid tag value, got: %q; want: %q", got, `hello world;\`)
+	}
+
+	m, err = ParseIRCMessage("PING :tmi.twitch.tv")
+	if err != nil {
+		t.Fatalf("error parsing message %s", err)
+	}
+	if m.Command != "PING" || m.Prefix != "" || m.Trailing() != "tmi.twitch.tv" {
+		t.Errorf("invalid message, got: %+v", m)
+	}
+
+	if _, err := ParseIRCMessage("@a=b :prefix"); err != ErrEmptyIRCMessage {
+		t.Errorf("expected ErrEmptyIRCMessage, got: %v", err)
+	}
+}
+
+func TestParseTwitchMessage(t *testing.T) {
+	cases := []struct {
+		line string
+		typ  string
+		nick string
+		data string
+	}{
+		{":ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #dallas :\x01ACTION waves\x01", "MSG", "ronni", "/me waves"},
+		{`@msg-id=resub;system-msg=ronni\shas\ssubscribed! :tmi.twitch.tv USERNOTICE #dallas :keep it up`, "MSG", "twitchnotify", "ronni has subscribed! [SubMessage]: keep it up"},
+		{`@msg-id=raid;login=ronni;system-msg=10\sraiders :tmi.twitch.tv USERNOTICE #dallas`, "RAID", "ronni", "10 raiders"},
+		{"@ban-duration=600 :tmi.twitch.tv CLEARCHAT #dallas :ronni", "CLEARCHAT", "ronni", "600"},
+		{"@login=ronni;target-msg-id=abc :tmi.twitch.tv CLEARMSG #dallas :HeyGuys", "CLEARMSG", "ronni", "HeyGuys"},
+		{":tmi.twitch.tv HOSTTARGET #dallas :ronni 10", "HOSTTARGET", "", "ronni 10"},
+	}
+	for _, c := range cases {
+		im, err := ParseIRCMessage(c.line)
+		if err != nil {
+			t.Fatalf("error parsing %q %s", c.line, err)
+		}
+		m := parseTwitchMessage(im)
+		if m == nil {
+			t.Errorf("expected message for %q", c.line)
+			continue
+		}
+		if m.Type != c.typ || m.Nick != c.nick || m.Data != c.data || m.Channel != "dallas" {
+			t.Errorf("invalid message for %q, got: %s %q %q %q", c.line, m.Type, m.Channel, m.Nick, m.Data)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package common
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ircChannelUnsafe = regexp.MustCompile("[^a-z0-9_-]")
+
+// IRC chat client for plain irc networks
+type IRC struct {
+	conf          SourceConfig
+	connLock      sync.Mutex
+	sendLock      sync.Mutex
+	connected     bool
+	conn          net.Conn
+	reader        *bufio.Reader
+	chLock        sync.RWMutex
+	channels      []string
+	messages      chan *Message
+	lastMessageMu sync.RWMutex
+	lastMessage   time.Time
+	backoff       *Backoff
+	dropped       uint64
+	quit          chan struct{}
+}
+
+// NewIRC new irc chat client
+func NewIRC(conf SourceConfig) *IRC {
+	c := &IRC{
+		conf:     conf,
+		channels: make([]string, 0),
+		messages: make(chan *Message, MessageBufferSize),
+		backoff:  NewBackoff(),
+		quit:     make(chan struct{}),
+	}
+	for _, ch := range conf.Channels {
+		c.channels = append(c.channels, ircChannel(ch))
+	}
+	return c
+}
+
+// Dropped number of messages dropped because the messages channel was full
+func (c *IRC) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Status connection state
+func (c *IRC) Status() []ConnStatus {
+	c.connLock.Lock()
+	connected := c.connected
+	c.connLock.Unlock()
+	c.lastMessageMu.RLock()
+	last := c.lastMessage
+	c.lastMessageMu.RUnlock()
+	c.chLock.RLock()
+	channels := len(c.channels)
+	c.chLock.RUnlock()
+	return []ConnStatus{{
+		Connected:   connected,
+		LastMessage: last,
+		Channels:    channels,
+	}}
+}
+
+// Name source name
+func (c *IRC) Name() string {
+	if c.conf.Name != "" {
+		return c.conf.Name
+	}
+	return "irc " + c.conf.Server
+}
+
+// ChannelName log channel name of an irc channel eg. "#Foo.Bar" with prefix
+// "rizon-" is logged as "rizon-foobar"
+func (c *IRC) ChannelName(ch string) string {
+	return c.conf.ChannelPrefix + ircChannelUnsafe.ReplaceAllString(strings.ToLower(ch), "")
+}
+
+func ircChannel(ch string) string {
+	if strings.HasPrefix(ch, "#") || strings.HasPrefix(ch, "&") {
+		return ch
+	}
+	return "#" + ch
+}
+
+// connect dials the server, registers and joins the channels
+func (c *IRC) connect() error {
+	dialer := &net.Dialer{Timeout: HandshakeTimeout}
+	var conn net.Conn
+	var err error
+	if c.conf.TLS {
+		host, _, _ := net.SplitHostPort(c.conf.Server)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.conf.Server, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.conf.Server)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s %s", c.conf.Server, err)
+	}
+	r := bufio.NewReader(conn)
+
+	if err := c.register(conn, r); err != nil {
+		conn.Close()
+		return fmt.Errorf("error registering with %s %s", c.conf.Server, err)
+	}
+	log.Printf("connected to %s", c.conf.Server)
+
+	c.connLock.Lock()
+	old := c.conn
+	c.conn = conn
+	c.connected = true
+	c.reader = r
+	c.connLock.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	c.lastMessageMu.Lock()
+	c.lastMessage = time.Now()
+	c.lastMessageMu.Unlock()
+
+	go c.joinChannels(conn)
+	return nil
+}
+
+// register logs in and waits for the welcome reply, SASL PLAIN is used when
+// auth is "sasl", "nickserv" identifies after registering
+func (c *IRC) register(conn net.Conn, r *bufio.Reader) error {
+	nick := c.conf.Nick
+	if nick == "" {
+		nick = "overrustlelogs"
+	}
+	user := c.conf.User
+	if user == "" {
+		user = nick
+	}
+
+	var lines []string
+	if c.conf.Auth == "sasl" {
+		lines = append(lines, "CAP REQ :sasl")
+	} else if c.conf.Password != "" && c.conf.Auth != "nickserv" {
+		lines = append(lines, "PASS "+c.conf.Password)
+	}
+	lines = append(lines, "NICK "+nick, "USER "+user+" 0 * :"+user)
+	for _, l := range lines {
+		if err := c.write(conn, l); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(SocketReadTimeout)
+	for {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		m, err := ParseIRCMessage(line)
+		if err != nil {
+			continue
+		}
+		var reply string
+		switch m.Command {
+		case "PING":
+			reply = "PONG :" + m.Trailing()
+		case "CAP":
+			switch m.Param(1) {
+			case "ACK":
+				reply = "AUTHENTICATE PLAIN"
+			case "NAK":
+				return errors.New("server doesn't support sasl")
+			}
+		case "AUTHENTICATE":
+			if m.Param(0) == "+" {
+				reply = "AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte(user+"\x00"+user+"\x00"+c.conf.Password))
+			}
+		case "903":
+			reply = "CAP END"
+		case "902", "904", "905", "906":
+			return fmt.Errorf("sasl authentication failed: %s", m.Trailing())
+		case "433":
+			// nick in use
+			nick += "_"
+			reply = "NICK " + nick
+		case "ERROR":
+			return errors.New(m.Trailing())
+		case "001":
+			if c.conf.Auth == "nickserv" && c.conf.Password != "" {
+				return c.write(conn, "PRIVMSG NickServ :IDENTIFY "+user+" "+c.conf.Password)
+			}
+			return nil
+		}
+		if reply != "" {
+			if err := c.write(conn, reply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// joinChannels joins the channels one at a time so big channel lists don't
+// trigger flood protection
+func (c *IRC) joinChannels(conn net.Conn) {
+	c.chLock.RLock()
+	channels := make([]string, len(c.channels))
+	copy(channels, c.channels)
+	c.chLock.RUnlock()
+	for _, ch := range channels {
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+		log.Printf("joining %s on %s", ch, c.conf.Server)
+		if err := c.write(conn, "JOIN "+ch); err != nil {
+			log.Printf("failed to join %s: %v", ch, err)
+			return
+		}
+		time.Sleep(IRCJoinInterval)
+	}
+}
+
+// reconnect closes the current connection and retries connecting with
+// backoff until it succeeds or the client is stopped
+func (c *IRC) reconnect() bool {
+	c.drop()
+	for {
+		delay := c.backoff.Next()
+		sourceReconnects.Inc(c.Name())
+		log.Printf("reconnecting to %s in %s", c.conf.Server, delay)
+		select {
+		case <-c.quit:
+			return false
+		case <-time.After(delay):
+		}
+		err := c.connect()
+		if err == nil {
+			return true
+		}
+		log.Println(err)
+	}
+}
+
+// drop closes the current connection which makes the read loop reconnect
+func (c *IRC) drop() {
+	c.connLock.Lock()
+	c.connected = false
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.connLock.Unlock()
+}
+
+func (c *IRC) getConn() (net.Conn, *bufio.Reader) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.conn, c.reader
+}
+
+// Run connect and start message read loop
+func (c *IRC) Run() {
+	defer close(c.messages)
+	if err := c.connect(); err != nil {
+		log.Println(err)
+		if !c.reconnect() {
+			return
+		}
+	}
+
+	pingTicker := time.NewTicker(5 * time.Minute)
+	defer pingTicker.Stop()
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-pingTicker.C:
+			if err := c.send("PING :" + c.conf.Server); err != nil {
+				c.reconnect()
+				continue
+			}
+		default:
+		}
+
+		conn, r := c.getConn()
+		if err := conn.SetReadDeadline(time.Now().Add(SocketReadTimeout)); err != nil {
+			log.Printf("error setting the ReadDeadline: %v", err)
+			c.reconnect()
+			continue
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			log.Printf("error reading from %s: %v", c.conf.Server, err)
+			c.reconnect()
+			continue
+		}
+		c.backoff.Reset()
+		c.lastMessageMu.Lock()
+		c.lastMessage = time.Now()
+		c.lastMessageMu.Unlock()
+
+		im, err := ParseIRCMessage(line)
+		if err != nil {
+			continue
+		}
+		switch im.Command {
+		case "PING":
+			if err := c.send("PONG :" + im.Trailing()); err != nil {
+				log.Printf("error sending PONG: %v", err)
+				c.drop()
+			}
+		case "ERROR":
+			log.Printf("error from %s: %s", c.conf.Server, im.Trailing())
+			c.reconnect()
+		case "PRIVMSG":
+			m := c.parseMessage(im)
+			if m == nil {
+				continue
+			}
+			select {
+			case c.messages <- m:
+			default:
+				atomic.AddUint64(&c.dropped, 1)
+				sourceDropped.Inc(c.Name())
+				log.Println("error messages channel full :(")
+			}
+		}
+	}
+}
+
+// parseMessage converts channel messages, private messages and CTCP requests
+// other than ACTION return nil
+func (c *IRC) parseMessage(im *IRCMessage) *Message {
+	target := im.Param(0)
+	if !strings.HasPrefix(target, "#") && !strings.HasPrefix(target, "&") {
+		return nil
+	}
+	data := strings.TrimSpace(im.Param(1))
+	if action, ok := ctcpAction(data); ok {
+		data = "/me " + action
+	} else if strings.HasPrefix(data, "\x01") {
+		return nil
+	}
+	if data == "" {
+		return nil
+	}
+	return &Message{
+		Type:    "MSG",
+		Channel: c.ChannelName(target),
+		Nick:    im.Nick(),
+		Data:    data,
+		Time:    time.Now().UTC(),
+		Tags:    im.Tags,
+	}
+}
+
+// Stop stops the chat
+func (c *IRC) Stop() {
+	close(c.quit)
+	c.connLock.Lock()
+	if c.conn != nil {
+		c.write(c.conn, "QUIT :bye")
+		c.conn.Close()
+	}
+	c.connLock.Unlock()
+}
+
+// Messages channel accessor
+func (c *IRC) Messages() <-chan *Message {
+	return c.messages
+}
+
+// Message send a message to a channel
+func (c *IRC) Message(ch, payload string) error {
+	return c.send(fmt.Sprintf("PRIVMSG %s :%s", ircChannel(ch), payload))
+}
+
+func (c *IRC) send(m string) error {
+	conn, _ := c.getConn()
+	if conn == nil {
+		return errors.New("not connected")
+	}
+	return c.write(conn, m)
+}
+
+func (c *IRC) write(conn net.Conn, m string) error {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	if err := conn.SetWriteDeadline(time.Now().Add(SocketWriteTimeout)); err != nil {
+		return fmt.Errorf("error setting SetWriteDeadline %s", err)
+	}
+	if _, err := conn.Write([]byte(m + "\r\n")); err != nil {
+		return fmt.Errorf("error sending message %s", err)
+	}
+	return nil
+}
+
+// Join channel
+func (c *IRC) Join(ch string) error {
+	ch = ircChannel(ch)
+	c.chLock.Lock()
+	if inSlice(c.channels, ch) {
+		c.chLock.Unlock()
+		return errors.New("already in channel")
+	}
+	c.channels = append(c.channels, ch)
+	c.chLock.Unlock()
+
+	if conn, _ := c.getConn(); conn != nil {
+		return c.write(conn, "JOIN "+ch)
+	}
+	return nil
+}
+
+// Leave channel
+func (c *IRC) Leave(ch string) error {
+	ch = ircChannel(ch)
+	c.chLock.Lock()
+	defer c.chLock.Unlock()
+	for i, v := range c.channels {
+		if strings.EqualFold(v, ch) {
+			c.channels = append(c.channels[:i], c.channels[i+1:]...)
+			if conn, _ := c.getConn(); conn != nil {
+				return c.write(conn, "PART "+ch)
+			}
+			return nil
+		}
+	}
+	return errors.New("not in channel")
+}
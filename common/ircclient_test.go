@@ -0,0 +1,69 @@
+package common
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIRCClient(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening %s", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "CAP REQ"):
+				conn.Write([]byte(":irc.test CAP * ACK :sasl\r\n"))
+			case strings.HasPrefix(line, "AUTHENTICATE PLAIN"):
+				conn.Write([]byte("AUTHENTICATE +\r\n"))
+			case strings.HasPrefix(line, "AUTHENTICATE "):
+				conn.Write([]byte(":irc.test 903 logs :SASL authentication successful\r\n"))
+			case strings.HasPrefix(line, "CAP END"):
+				conn.Write([]byte(":irc.test 001 logs :Welcome\r\n"))
+			case strings.HasPrefix(line, "JOIN #Foo.Bar"):
+				conn.Write([]byte(":ronni!r@host PRIVMSG #Foo.Bar :\x01ACTION waves\x01\r\n"))
+				conn.Write([]byte(":ronni!r@host PRIVMSG logs :private\r\n"))
+				conn.Write([]byte(":ronni!r@host PRIVMSG #Foo.Bar :hello\r\n"))
+			}
+		}
+	}()
+
+	c := NewIRC(SourceConfig{
+		Server:        ln.Addr().String(),
+		Nick:          "logs",
+		Password:      "secret",
+		Auth:          "sasl",
+		Channels:      []string{"#Foo.Bar"},
+		ChannelPrefix: "test-",
+	})
+	go c.Run()
+	defer c.Stop()
+
+	want := []string{"/me waves", "hello"}
+	for _, data := range want {
+		select {
+		case m := <-c.Messages():
+			if m.Channel != "test-foobar" || m.Nick != "ronni" || m.Data != data {
+				t.Errorf("invalid message, got: %q %q %q; want: test-foobar ronni %q", m.Channel, m.Nick, m.Data, data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", data)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// JournalCompactSize journal size after which it's truncated once every
+// entry has been committed
+const JournalCompactSize = 64 << 20
+
+// Journal append only message log between a chat source and the logger.
+// Messages are appended as json lines and delivered in order, the offset of
+// the last acknowledged message is persisted by Commit once its lines are
+// synced to the chat logs. Delivery is at least once, messages that were delivered
+// but not committed before a crash are replayed on the next start.
+type Journal struct {
+	path       string
+	mu         sync.Mutex
+	f          *os.File
+	size       int64
+	delivered  int64
+	inflight   []int64
+	checkpoint int64
+	generation int
+	notify     chan struct{}
+	messages   chan *Message
+	quit       chan struct{}
+	stopOnce   sync.Once
+	done       chan struct{}
+	appended   uint64
+	failed     uint64
+}
+
+// OpenJournal opens or creates the journal at path, a partially written last
+// line is truncated
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := lastLineEnd(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	checkpoint := readCheckpoint(checkpointPath(path))
+	if checkpoint > size {
+		log.Printf("journal checkpoint %d past the end of %s, replaying everything", checkpoint, path)
+		checkpoint = 0
+	}
+	if checkpoint < size {
+		log.Printf("replaying %d bytes of %s", size-checkpoint, path)
+	}
+
+	j := &Journal{
+		path:       path,
+		f:          f,
+		size:       size,
+		delivered:  checkpoint,
+		checkpoint: checkpoint,
+		notify:     make(chan struct{}, 1),
+		messages:   make(chan *Message),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go j.deliver()
+	return j, nil
+}
+
+// lastLineEnd returns the offset after the last complete line
+func lastLineEnd(f *os.File) (int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := stat.Size()
+	buf := make([]byte, 4096)
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i != -1 {
+			return end - n + int64(i) + 1, nil
+		}
+		end -= n
+	}
+	return 0, nil
+}
+
+func checkpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+func readCheckpoint(path string) int64 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Append writes m to the journal
+func (j *Journal) Append(m *Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		atomic.AddUint64(&j.failed, 1)
+		return err
+	}
+	data = append(data, '\n')
+
+	j.mu.Lock()
+	n, err := j.f.Write(data)
+	if err != nil {
+		// drop the partial line so the next append starts on a new line
+		j.f.Truncate(j.size)
+		j.f.Seek(j.size, io.SeekStart)
+		j.mu.Unlock()
+		atomic.AddUint64(&j.failed, 1)
+		return fmt.Errorf("error writing to journal %s %v", j.path, err)
+	}
+	j.size += int64(n)
+	j.mu.Unlock()
+	atomic.AddUint64(&j.appended, 1)
+
+	select {
+	case j.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Messages delivers the journaled messages in order, receivers call Ack after
+// processing each message.
+func (j *Journal) Messages() <-chan *Message {
+	return j.messages
+}
+
+func (j *Journal) deliver() {
+	defer close(j.done)
+	defer close(j.messages)
+
+	r, err := os.Open(j.path)
+	if err != nil {
+		log.Printf("error opening journal %s %s", j.path, err)
+		return
+	}
+	defer func() { r.Close() }()
+
+	j.mu.Lock()
+	offset := j.delivered
+	generation := j.generation
+	j.mu.Unlock()
+	for {
+		j.mu.Lock()
+		size := j.size
+		if generation != j.generation {
+			// compacted after everything was delivered
+			generation = j.generation
+			offset = 0
+		}
+		j.mu.Unlock()
+
+		if offset == size {
+			select {
+			case <-j.quit:
+				return
+			case <-j.notify:
+			}
+			continue
+		}
+
+		br := bufio.NewReader(io.NewSectionReader(r, offset, size-offset))
+		for {
+			line, err := br.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			next := offset + int64(len(line))
+			m := &Message{}
+			if err := json.Unmarshal(line, m); err != nil {
+				log.Printf("error decoding journal entry at %d %s", offset, err)
+				offset = next
+				continue
+			}
+			j.mu.Lock()
+			j.inflight = append(j.inflight, next)
+			j.mu.Unlock()
+			select {
+			case <-j.quit:
+				j.mu.Lock()
+				j.inflight = j.inflight[:len(j.inflight)-1]
+				j.mu.Unlock()
+				return
+			case j.messages <- m:
+			}
+			offset = next
+		}
+	}
+}
+
+// Ack marks the oldest unacknowledged message as processed
+func (j *Journal) Ack() {
+	j.mu.Lock()
+	if len(j.inflight) > 0 {
+		j.delivered = j.inflight[0]
+		j.inflight = j.inflight[1:]
+	}
+	j.mu.Unlock()
+}
+
+// Commit persists the offset of the last acknowledged message, callers have to
+// make sure every delivered message is synced to disk first. Fully committed
+// journals are truncated once they grow past JournalCompactSize.
+func (j *Journal) Commit() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	if j.delivered == j.checkpoint {
+		return nil
+	}
+	if j.delivered == j.size && j.size > JournalCompactSize {
+		if err := j.f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		j.size = 0
+		j.delivered = 0
+		j.generation++
+	}
+	if err := writeCheckpoint(checkpointPath(j.path), j.delivered); err != nil {
+		return err
+	}
+	j.checkpoint = j.delivered
+	return nil
+}
+
+func writeCheckpoint(path string, offset int64) error {
+	f, err := os.Create(path + ".writing")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(strconv.FormatInt(offset, 10)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".writing", path)
+}
+
+// Appended number of messages appended since opening
+func (j *Journal) Appended() uint64 {
+	return atomic.LoadUint64(&j.appended)
+}
+
+// Failed number of messages that couldn't be appended
+func (j *Journal) Failed() uint64 {
+	return atomic.LoadUint64(&j.failed)
+}
+
+// Pending bytes appended but not committed yet
+func (j *Journal) Pending() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.size - j.checkpoint
+}
+
+// Stop stops delivering messages and closes the messages channel, the
+// journal can still be committed
+func (j *Journal) Stop() {
+	j.stopOnce.Do(func() { close(j.quit) })
+	<-j.done
+}
+
+// Close stops delivering messages and syncs the journal
+func (j *Journal) Close() error {
+	j.Stop()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
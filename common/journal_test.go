@@ -0,0 +1,76 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("error creating temp dir %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.journal")
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("error opening journal %s", err)
+	}
+	for _, data := range []string{"one", "two", "three"} {
+		if err := j.Append(&Message{Type: "MSG", Channel: "test", Nick: "foo", Data: data, Time: time.Now().UTC()}); err != nil {
+			t.Fatalf("error appending %s", err)
+		}
+	}
+	if m := receive(t, j); m.Data != "one" {
+		t.Fatalf("invalid message, got: %q; want: one", m.Data)
+	}
+	if err := j.Commit(); err != nil {
+		t.Fatalf("error committing %s", err)
+	}
+	if m := receive(t, j); m.Data != "two" {
+		t.Fatalf("invalid message, got: %q; want: two", m.Data)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("error closing journal %s", err)
+	}
+
+	// simulate a crash in the middle of an append
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("error opening journal file %s", err)
+	}
+	f.WriteString(`{"type":"MSG","da`)
+	f.Close()
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("error reopening journal %s", err)
+	}
+	defer j.Close()
+	for _, want := range []string{"two", "three"} {
+		if m := receive(t, j); m.Data != want {
+			t.Errorf("invalid replayed message, got: %q; want: %q", m.Data, want)
+		}
+	}
+	if err := j.Append(&Message{Type: "MSG", Data: "four"}); err != nil {
+		t.Fatalf("error appending %s", err)
+	}
+	if m := receive(t, j); m.Data != "four" {
+		t.Errorf("invalid message after partial line, got: %q; want: four", m.Data)
+	}
+}
+
+func receive(t *testing.T, j *Journal) *Message {
+	select {
+	case m := <-j.Messages():
+		j.Ack()
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for journal message")
+	}
+	return nil
+}
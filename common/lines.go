@@ -0,0 +1,43 @@
+package common
+
+import (
+	"bufio"
+	"io"
+)
+
+// LineReaderSize buffer size of LineReader, longer lines are assembled in a
+// separate buffer
+const LineReaderSize = 64 << 10
+
+// LineReader reads newline terminated lines from a stream
+type LineReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewLineReader creates a LineReader reading from r
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{r: bufio.NewReaderSize(r, LineReaderSize)}
+}
+
+// Next returns the next line including its newline, the slice is only valid
+// until the following call. An unterminated last line is skipped as it may
+// still be being written, io.EOF is returned at the end of the stream.
+func (l *LineReader) Next() ([]byte, error) {
+	line, err := l.r.ReadSlice('\n')
+	if err == nil {
+		return line, nil
+	}
+	if err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	l.buf = append(l.buf[:0], line...)
+	for err == bufio.ErrBufferFull {
+		line, err = l.r.ReadSlice('\n')
+		l.buf = append(l.buf, line...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l.buf, nil
+}
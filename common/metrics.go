@@ -0,0 +1,290 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics default registry exposed by the /metrics endpoints
+var Metrics = NewRegistry()
+
+// DefaultBuckets latency buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Labels constant labels of a func metric
+type Labels map[string]string
+
+// Registry collection of metrics rendered in the prometheus text format
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+	funcs  []metricFunc
+}
+
+type metricSeries struct {
+	values  []string
+	value   float64
+	counts  []uint64
+	sum     float64
+	samples uint64
+}
+
+type metricFunc struct {
+	labels Labels
+	fn     func() float64
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*metricFamily)}
+}
+
+func (r *Registry) family(name, help, typ string, buckets []float64, labels []string) *metricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ {
+			panic(fmt.Sprintf("metric %s registered as %s and %s", name, f.typ, typ))
+		}
+		return f
+	}
+	f := &metricFamily{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	r.families[name] = f
+	return f
+}
+
+func (f *metricFamily) get(values []string) *metricSeries {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{values: append([]string(nil), values...)}
+		if f.typ == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter monotonically increasing value
+type Counter struct {
+	f *metricFamily
+}
+
+// Counter returns the counter with the given name, creating it if needed
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{f: r.family(name, help, "counter", nil, labels)}
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the counter
+func (c *Counter) Add(v float64, values ...string) {
+	c.f.mu.Lock()
+	c.f.get(values).value += v
+	c.f.mu.Unlock()
+}
+
+// Gauge value that can go up and down
+type Gauge struct {
+	f *metricFamily
+}
+
+// Gauge returns the gauge with the given name, creating it if needed
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{f: r.family(name, help, "gauge", nil, labels)}
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.get(values).value = v
+	g.f.mu.Unlock()
+}
+
+// Add adds v to the gauge
+func (g *Gauge) Add(v float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.get(values).value += v
+	g.f.mu.Unlock()
+}
+
+// CounterFunc registers a counter that is read from fn on every scrape
+func (r *Registry) CounterFunc(name, help string, labels Labels, fn func() float64) {
+	f := r.family(name, help, "counter", nil, nil)
+	f.mu.Lock()
+	f.funcs = append(f.funcs, metricFunc{labels: labels, fn: fn})
+	f.mu.Unlock()
+}
+
+// GaugeFunc registers a gauge that is read from fn on every scrape
+func (r *Registry) GaugeFunc(name, help string, labels Labels, fn func() float64) {
+	f := r.family(name, help, "gauge", nil, nil)
+	f.mu.Lock()
+	f.funcs = append(f.funcs, metricFunc{labels: labels, fn: fn})
+	f.mu.Unlock()
+}
+
+// Histogram samples observations into buckets
+type Histogram struct {
+	f *metricFamily
+}
+
+// Histogram returns the histogram with the given name, creating it if needed
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{f: r.family(name, help, "histogram", buckets, labels)}
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.mu.Lock()
+	s := h.f.get(values)
+	for i, b := range h.f.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.samples++
+	h.f.mu.Unlock()
+}
+
+// WriteText writes all metrics in the prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		r.mu.Lock()
+		f := r.families[name]
+		r.mu.Unlock()
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *metricFamily) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.series) == 0 && len(f.funcs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, strings.Replace(f.help, "\n", " ", -1))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != "histogram" {
+			writeSample(w, f.name, f.labels, s.values, "", "", s.value)
+			continue
+		}
+		for i, b := range f.buckets {
+			writeSample(w, f.name+"_bucket", f.labels, s.values, "le", formatFloat(b), float64(s.counts[i]))
+		}
+		writeSample(w, f.name+"_bucket", f.labels, s.values, "le", "+Inf", float64(s.samples))
+		writeSample(w, f.name+"_sum", f.labels, s.values, "", "", s.sum)
+		writeSample(w, f.name+"_count", f.labels, s.values, "", "", float64(s.samples))
+	}
+
+	for _, fn := range f.funcs {
+		names := make([]string, 0, len(fn.labels))
+		for k := range fn.labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		values := make([]string, len(names))
+		for i, k := range names {
+			values[i] = fn.labels[k]
+		}
+		writeSample(w, f.name, names, values, "", "", fn.fn())
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l + "=\"" + labelValueEscaper.Replace(values[i]) + "\"")
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + "=\"" + extraValue + "\"")
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the metrics in the prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("test_messages_total", "Messages.", "channel")
+	c.Inc("foo")
+	c.Add(2, "bar\"baz")
+	r.GaugeFunc("test_open", "Open things.", Labels{"source": "twitch"}, func() float64 { return 3 })
+	h := r.Histogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	r.Counter("test_unused_total", "Unused.")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("error writing metrics %s", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE test_messages_total counter\n",
+		`test_messages_total{channel="foo"} 1` + "\n",
+		`test_messages_total{channel="bar\"baz"} 2` + "\n",
+		`test_open{source="twitch"} 3` + "\n",
+		`test_duration_seconds_bucket{route="/a",le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{route="/a",le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{route="/a",le="+Inf"} 2` + "\n",
+		`test_duration_seconds_count{route="/a"} 2` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "test_unused_total") {
+		t.Errorf("unexpected empty metric in:\n%s", out)
+	}
+}
@@ -0,0 +1,276 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// nick index location in a channel directory and its shard count, the
+// complete marker is written once the index covers the channel's history
+const (
+	NickIndexDir    = ".nickindex"
+	NickIndexShards = 4096
+
+	nickIndexComplete = "complete"
+)
+
+// NickDay lines of a nick on a day and the unix times of the first and last,
+// Bytes is counted by MessageBytes
+type NickDay struct {
+	Date  string `json:"date"`
+	Lines int    `json:"lines"`
+	Bytes int    `json:"bytes,omitempty"`
+	First int64  `json:"first"`
+	Last  int64  `json:"last"`
+}
+
+// Add counts a line sent at unix time t
+func (d *NickDay) Add(t int64) {
+	if d.Lines == 0 || t < d.First {
+		d.First = t
+	}
+	if t > d.Last {
+		d.Last = t
+	}
+	d.Lines++
+}
+
+// Count counts message m
+func (d *NickDay) Count(m *Message) {
+	d.Add(m.Time.Unix())
+	d.Bytes += MessageBytes(m.Data)
+}
+
+// Merge adds the lines and bytes of o and widens the first and last times
+func (d *NickDay) Merge(o NickDay) {
+	if o.Lines == 0 {
+		return
+	}
+	if d.Lines == 0 || o.First < d.First {
+		d.First = o.First
+	}
+	if o.Last > d.Last {
+		d.Last = o.Last
+	}
+	d.Lines += o.Lines
+	d.Bytes += o.Bytes
+}
+
+// MergeNickCases merges the day stats of the case variants of each nick, the
+// nick index keeps a single entry per lower case nick. Merged stats are keyed
+// by the variant that spoke last.
+func MergeNickCases(days map[string]*NickDay) map[string]NickDay {
+	merged := make(map[string]NickDay, len(days))
+	cases := make(map[string]string, len(days))
+	for nick, d := range days {
+		lower := strings.ToLower(nick)
+		prev, ok := cases[lower]
+		if !ok {
+			cases[lower] = nick
+			merged[nick] = *d
+			continue
+		}
+		m := merged[prev]
+		if d.Last > m.Last || d.Last == m.Last && nick < prev {
+			delete(merged, prev)
+			cases[lower] = nick
+		}
+		m.Merge(*d)
+		merged[cases[lower]] = m
+	}
+	return merged
+}
+
+// NickIndexEntry days a nick spoke on, newest first. Nick is the most
+// recently seen case of the nick.
+type NickIndexEntry struct {
+	Nick string    `json:"nick"`
+	Days []NickDay `json:"days"`
+}
+
+// Set replaces or inserts the stats of day d keeping the days sorted, nick
+// becomes the entry's case if d is the newest day
+func (e *NickIndexEntry) Set(nick string, d NickDay) {
+	i := sort.Search(len(e.Days), func(i int) bool { return e.Days[i].Date <= d.Date })
+	if i == 0 {
+		e.Nick = nick
+	}
+	if i < len(e.Days) && e.Days[i].Date == d.Date {
+		e.Days[i] = d
+		return
+	}
+	e.Days = append(e.Days, NickDay{})
+	copy(e.Days[i+1:], e.Days[i:])
+	e.Days[i] = d
+}
+
+// NickIndex per channel index of the days each nick spoke on, sharded by a
+// hash of the lower case nick
+type NickIndex struct {
+	path string
+}
+
+// NewNickIndex index of the channel at path
+func NewNickIndex(channelPath string) *NickIndex {
+	return &NickIndex{filepath.Join(channelPath, NickIndexDir)}
+}
+
+// Complete checks if the index was built from the channel's whole history,
+// until then lookups may miss older days
+func (x *NickIndex) Complete() bool {
+	_, err := os.Stat(filepath.Join(x.path, nickIndexComplete))
+	return err == nil
+}
+
+// Lookup returns the entry of nick, nil if it never spoke
+func (x *NickIndex) Lookup(nick string) (*NickIndexEntry, error) {
+	shard, err := readNickShard(x.shardPath(nick))
+	if err != nil {
+		return nil, err
+	}
+	return shard[strings.ToLower(nick)], nil
+}
+
+// nickIndexLocks serializes updates of a shard within the process
+var nickIndexLocks sync.Map
+
+// Update sets the stats of each nick in days, replacing earlier stats of the
+// same day. Stats cover every case variant of a nick, variants in days are
+// merged.
+func (x *NickIndex) Update(days map[string]NickDay) error {
+	if err := os.MkdirAll(x.path, 0755); err != nil {
+		return err
+	}
+	variants := make(map[string]*NickDay, len(days))
+	for nick, d := range days {
+		d := d
+		variants[nick] = &d
+	}
+	days = MergeNickCases(variants)
+	shards := map[string][]string{}
+	for nick := range days {
+		p := x.shardPath(nick)
+		shards[p] = append(shards[p], nick)
+	}
+	for p, nicks := range shards {
+		l, _ := nickIndexLocks.LoadOrStore(p, &sync.Mutex{})
+		l.(*sync.Mutex).Lock()
+		err := updateNickShard(p, nicks, days)
+		l.(*sync.Mutex).Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func updateNickShard(path string, nicks []string, days map[string]NickDay) error {
+	shard, err := readNickShard(path)
+	if err != nil {
+		return err
+	}
+	for _, nick := range nicks {
+		lower := strings.ToLower(nick)
+		e, ok := shard[lower]
+		if !ok {
+			e = &NickIndexEntry{Nick: nick}
+			shard[lower] = e
+		}
+		e.Set(nick, days[nick])
+	}
+	return writeNickShard(path, shard)
+}
+
+// Replace writes entries as the complete index. The shards are written to a
+// temporary directory that is then renamed into place, so lookups and the
+// logger's updates never see a partial or missing index. Updates made while
+// entries were counted are lost, callers recount the days the logger may have
+// written in the meantime right before replacing the index.
+func (x *NickIndex) Replace(entries map[string]*NickIndexEntry) error {
+	tmp, err := ioutil.TempDir(filepath.Dir(x.path), NickIndexDir+".building")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	shards := map[string]map[string]*NickIndexEntry{}
+	for nick, e := range entries {
+		p := filepath.Join(tmp, shardName(nick))
+		if shards[p] == nil {
+			shards[p] = map[string]*NickIndexEntry{}
+		}
+		shards[p][strings.ToLower(nick)] = e
+	}
+	for p, shard := range shards {
+		if err := writeNickShard(p, shard); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(filepath.Join(tmp, nickIndexComplete))
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// the logger may recreate the index between the renames, its shard is
+	// moved aside with the old index
+	for i := 0; ; i++ {
+		old := fmt.Sprintf("%s.old%d", tmp, i)
+		if err := os.Rename(x.path, old); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		defer os.RemoveAll(old)
+		err := os.Rename(tmp, x.path)
+		if err == nil || i == 2 {
+			return err
+		}
+	}
+}
+
+func (x *NickIndex) shardPath(nick string) string {
+	return filepath.Join(x.path, shardName(nick))
+}
+
+// shardName file name of the shard holding nick
+func shardName(nick string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(nick)))
+	return fmt.Sprintf("%03x.json", h.Sum32()%NickIndexShards)
+}
+
+func readNickShard(path string) (map[string]*NickIndexEntry, error) {
+	shard := map[string]*NickIndexEntry{}
+	data, err := ReadCompressedFile(path)
+	if os.IsNotExist(err) {
+		return shard, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &shard); err != nil {
+		return nil, fmt.Errorf("error decoding nick index %s %v", path, err)
+	}
+	return shard, nil
+}
+
+func writeNickShard(path string, shard map[string]*NickIndexEntry) error {
+	data, err := json.Marshal(shard)
+	if err != nil {
+		return err
+	}
+	f, err := WriteCompressedFile(path+".writing", data)
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), gzPath(path))
+}
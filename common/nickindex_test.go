@@ -0,0 +1,141 @@
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNickIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nickindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	x := NewNickIndex(dir)
+	updates := []map[string]NickDay{
+		{"bob": {Date: "2020-03-01", Lines: 1}, "Alice": {Date: "2020-03-01", Lines: 2}},
+		{"Bob": {Date: "2020-04-02", Lines: 3}},
+		{"bob": {Date: "2020-03-01", Lines: 4}},
+	}
+	for _, days := range updates {
+		if err := x.Update(days); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e, err := x.Lookup("BOB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil || e.Nick != "Bob" || len(e.Days) != 2 || e.Days[0].Date != "2020-04-02" || e.Days[1].Lines != 4 {
+		t.Errorf("bob = %+v", e)
+	}
+	if e, err := x.Lookup("carl"); e != nil || err != nil {
+		t.Errorf("carl = %+v %v", e, err)
+	}
+	if x.Complete() {
+		t.Error("index complete without Replace")
+	}
+
+	// case variants of a nick on the same day are merged
+	if err := x.Update(map[string]NickDay{
+		"Foo": {Date: "2020-03-01", Lines: 2, First: 10, Last: 20},
+		"foo": {Date: "2020-03-01", Lines: 3, First: 5, Last: 30},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	e, err = x.Lookup("FOO")
+	if err != nil || e == nil || e.Nick != "foo" || len(e.Days) != 1 || e.Days[0].Lines != 5 || e.Days[0].First != 5 {
+		t.Errorf("foo = %+v %v", e, err)
+	}
+
+	if err := x.Replace(map[string]*NickIndexEntry{"bob": {Nick: "Bob", Days: []NickDay{{Date: "2020-05-01", Lines: 1}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if !x.Complete() {
+		t.Error("replaced index isn't complete")
+	}
+	if e, err := x.Lookup("alice"); e != nil || err != nil {
+		t.Errorf("replaced alice = %+v %v", e, err)
+	}
+	if e, err := x.Lookup("bob"); err != nil || e == nil || len(e.Days) != 1 {
+		t.Errorf("replaced bob = %+v %v", e, err)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, NickIndexDir+"*")); len(names) != 1 {
+		t.Errorf("left over index directories %v", names)
+	}
+}
+
+func TestMergeNickCases(t *testing.T) {
+	days := MergeNickCases(map[string]*NickDay{
+		"Bob":   {Date: "2020-03-01", Lines: 1, Bytes: 5, First: 10, Last: 10},
+		"bob":   {Date: "2020-03-01", Lines: 2, Bytes: 7, First: 5, Last: 8},
+		"Alice": {Date: "2020-03-01", Lines: 1},
+	})
+	if len(days) != 2 {
+		t.Fatalf("days = %+v", days)
+	}
+	if d, ok := days["Bob"]; !ok || d.Lines != 3 || d.Bytes != 12 || d.First != 5 || d.Last != 10 {
+		t.Errorf("bob = %+v", days)
+	}
+}
+
+func TestNickSearchIndexed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nickindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, m := range []string{"March 2020", "April 2020"} {
+		if err := os.MkdirAll(filepath.Join(dir, m), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &NickIndexEntry{}
+	e.Set("bob", NickDay{Date: "2020-03-01", Lines: 1})
+	e.Set("Bob", NickDay{Date: "2020-04-02", Lines: 1})
+	e.Set("Bob", NickDay{Date: "2020-03-05", Lines: 1})
+	if err := NewNickIndex(dir).Replace(map[string]*NickIndexEntry{"bob": e}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewNickSearch(dir, "BOB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Indexed() {
+		t.Fatal("search doesn't use the complete index")
+	}
+	if m := s.Months(); len(m) != 2 || m[0] != "April 2020" || m[1] != "March 2020" {
+		t.Errorf("months = %v", m)
+	}
+	if nick, err := s.Month("March 2020"); err != nil || nick != "Bob" {
+		t.Errorf("march = %s %v", nick, err)
+	}
+	var days []string
+	for {
+		rs, err := s.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		days = append(days, rs.Day())
+	}
+	if len(days) != 3 || days[0] != "2020-04-02" || days[2] != "2020-03-01" {
+		t.Errorf("days = %v", days)
+	}
+
+	s, err = NewNickSearch(dir, "carl")
+	if err != nil || !s.Indexed() {
+		t.Fatal("unknown nick isn't answered by the index")
+	}
+	if _, err := s.Next(); err != io.EOF {
+		t.Errorf("unknown nick next = %v", err)
+	}
+}
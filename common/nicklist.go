@@ -87,12 +87,16 @@ func (n NickCaseMap) Remove(nick string) {
 	delete(n, strings.ToLower(nick))
 }
 
-// NickSearch scans nick indexes in reverse chronological order
+// NickSearch scans nick indexes in reverse chronological order, channels
+// with a complete NickIndex are answered from a single lookup
 type NickSearch struct {
-	nick   string
-	path   string
-	months map[string]struct{}
-	date   time.Time
+	nick    string
+	path    string
+	months  map[string]struct{}
+	date    time.Time
+	indexed bool
+	entry   *NickIndexEntry
+	day     int
 }
 
 // NewNickSearch create scanner
@@ -109,16 +113,40 @@ func NewNickSearch(path string, nick string) (*NickSearch, error) {
 	for _, name := range names {
 		months[name] = struct{}{}
 	}
-	return &NickSearch{
+	s := &NickSearch{
 		nick:   strings.ToLower(nick),
 		path:   path,
 		months: months,
 		date:   time.Now().UTC().Add(24 * time.Hour),
-	}, nil
+	}
+	if index := NewNickIndex(path); index.Complete() {
+		if s.entry, err = index.Lookup(nick); err == nil {
+			s.indexed = true
+		}
+	}
+	return s, nil
+}
+
+// Indexed checks if the search is answered by the channel's nick index
+func (n *NickSearch) Indexed() bool {
+	return n.indexed
 }
 
 // Next find next occurrence
 func (n *NickSearch) Next() (*NickSearchResult, error) {
+	if n.indexed {
+		today := time.Now().UTC().Format("2006-01-02")
+		for n.entry != nil && n.day < len(n.entry.Days) {
+			d := n.entry.Days[n.day]
+			n.day++
+			date, err := time.Parse("2006-01-02", d.Date)
+			if err != nil || d.Date > today {
+				continue
+			}
+			return &NickSearchResult{n.entry.Nick, date}, nil
+		}
+		return nil, io.EOF
+	}
 	for {
 		n.date = n.date.Add(-24 * time.Hour)
 		if _, ok := n.months[n.date.Format("January 2006")]; !ok {
@@ -137,6 +165,21 @@ func (n *NickSearch) Month(m string) (string, error) {
 	if _, ok := n.months[m]; !ok {
 		return "", errors.New("month not found")
 	}
+	if n.indexed {
+		t, err := time.Parse("January 2006", m)
+		if err != nil {
+			return "", err
+		}
+		prefix := t.Format("2006-01-")
+		if n.entry != nil {
+			for _, d := range n.entry.Days {
+				if strings.HasPrefix(d.Date, prefix) {
+					return n.entry.Nick, nil
+				}
+			}
+		}
+		return "", errors.New("user not found in " + m)
+	}
 	f, err := os.Open(filepath.Join(n.path, m))
 	if err != nil {
 		return "", err
@@ -161,6 +204,26 @@ func (n *NickSearch) Month(m string) (string, error) {
 	return "", errors.New("user not found in " + m)
 }
 
+// Months the nick spoke in, newest first. Only indexed searches know the
+// months without reading the nick lists of each.
+func (n *NickSearch) Months() []string {
+	var months []string
+	if n.entry == nil {
+		return months
+	}
+	for _, d := range n.entry.Days {
+		t, err := time.Parse("2006-01-02", d.Date)
+		if err != nil {
+			continue
+		}
+		m := t.Format("January 2006")
+		if len(months) == 0 || months[len(months)-1] != m {
+			months = append(months, m)
+		}
+	}
+	return months
+}
+
 // NickSearchResult nick/path data
 type NickSearchResult struct {
 	nick string
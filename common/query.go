@@ -0,0 +1,528 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// query limits
+const (
+	MaxQueryLength      = 1024
+	MaxQueryTerms       = 32
+	MaxQueryRegexLength = 256
+	MaxQueryRegexInsts  = 4096
+)
+
+// QueryRegexBudget bytes of text the regular expressions of a query match at
+// most
+var QueryRegexBudget int64 = 256 << 20
+
+// query errors
+var (
+	ErrEmptyQuery          = errors.New("empty query")
+	ErrQueryTooLong        = errors.New("query is too long")
+	ErrQueryBudgetExceeded = errors.New("query regex budget exceeded")
+)
+
+// Query log filter parsed by ParseQuery
+type Query struct {
+	root   queryNode
+	budget int64
+	err    error
+}
+
+// ParseQuery parses a log filter query. Terms are combined with AND unless
+// separated by OR, NOT negates the next term and parentheses group terms.
+// Words and "quoted phrases" are case insensitive substrings of the message,
+// nick:name matches messages sent by name, before:time and after:time match
+// messages before or at/after time (2006-01-02, RFC 3339 or unix seconds) and
+// re:pattern or re:"pattern" is a case insensitive regular expression.
+// Regular expressions are limited in size and share QueryRegexBudget bytes of
+// matched text, once it's used up Match returns false and Err returns
+// ErrQueryBudgetExceeded.
+func ParseQuery(s string) (*Query, error) {
+	if len(s) > MaxQueryLength {
+		return nil, ErrQueryTooLong
+	}
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if p.terms > MaxQueryTerms {
+		return nil, fmt.Errorf("query has more than %d terms", MaxQueryTerms)
+	}
+	return &Query{root: root, budget: QueryRegexBudget}, nil
+}
+
+// Match reports whether a log line matches the query, words and phrases
+// match anywhere in the line, nick included, like the plain day log filter
+func (q *Query) Match(line string) bool {
+	line = strings.TrimSuffix(line, "\n")
+	if m, err := ParseMessageLine(line); err == nil {
+		return q.match(&queryTarget{
+			text:   m.Data,
+			line:   line,
+			nick:   m.Nick,
+			time:   m.Time,
+			parsed: true,
+		})
+	}
+	return q.match(&queryTarget{text: line})
+}
+
+// MatchMessage reports whether m matches the query
+func (q *Query) MatchMessage(m *Message) bool {
+	return q.match(&queryTarget{
+		text:   m.Data,
+		nick:   m.Nick,
+		time:   m.Time,
+		parsed: true,
+	})
+}
+
+func (q *Query) match(t *queryTarget) bool {
+	if q.err != nil {
+		return false
+	}
+	return q.root.match(q, t)
+}
+
+// Err returns ErrQueryBudgetExceeded once the regex budget is used up
+func (q *Query) Err() error {
+	return q.err
+}
+
+// ResetBudget restores the regex budget, used by long lived filters that
+// match lines as they arrive
+func (q *Query) ResetBudget() {
+	q.budget = QueryRegexBudget
+	q.err = nil
+}
+
+// queryTarget message matched by a query, words and phrases are matched
+// against line if it's set and text otherwise
+type queryTarget struct {
+	text   string
+	line   string
+	lower  string
+	nick   string
+	time   time.Time
+	parsed bool
+}
+
+func (t *queryTarget) lowerWords() string {
+	if t.lower == "" {
+		if t.line != "" {
+			t.lower = strings.ToLower(t.line)
+		} else {
+			t.lower = strings.ToLower(t.text)
+		}
+	}
+	return t.lower
+}
+
+type queryNode interface {
+	match(q *Query, t *queryTarget) bool
+	// regex reports whether evaluating the node can use the regex budget
+	regex() bool
+}
+
+type (
+	queryAnd  []queryNode
+	queryOr   []queryNode
+	queryNot  struct{ node queryNode }
+	queryText string
+	queryNick string
+	queryTime struct {
+		before bool
+		t      time.Time
+	}
+	queryRegex struct{ re *regexp.Regexp }
+)
+
+func (n queryAnd) match(q *Query, t *queryTarget) bool {
+	for _, c := range n {
+		if !c.match(q, t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n queryAnd) regex() bool { return anyRegex(n) }
+
+func (n queryOr) match(q *Query, t *queryTarget) bool {
+	for _, c := range n {
+		if c.match(q, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n queryOr) regex() bool { return anyRegex(n) }
+
+func anyRegex(nodes []queryNode) bool {
+	for _, c := range nodes {
+		if c.regex() {
+			return true
+		}
+	}
+	return false
+}
+
+func (n queryNot) match(q *Query, t *queryTarget) bool {
+	// a failed regex must not turn into a match
+	ok := n.node.match(q, t)
+	return !ok && q.err == nil
+}
+
+func (n queryNot) regex() bool { return n.node.regex() }
+
+func (n queryText) match(q *Query, t *queryTarget) bool {
+	return strings.Contains(t.lowerWords(), string(n))
+}
+
+func (n queryText) regex() bool { return false }
+
+func (n queryNick) match(q *Query, t *queryTarget) bool {
+	return t.parsed && strings.EqualFold(t.nick, string(n))
+}
+
+func (n queryNick) regex() bool { return false }
+
+func (n queryTime) match(q *Query, t *queryTarget) bool {
+	if !t.parsed {
+		return false
+	}
+	if n.before {
+		return t.time.Before(n.t)
+	}
+	return !t.time.Before(n.t)
+}
+
+func (n queryTime) regex() bool { return false }
+
+func (n queryRegex) match(q *Query, t *queryTarget) bool {
+	cost := int64(len(t.text))
+	if cost > q.budget {
+		q.budget = 0
+		q.err = ErrQueryBudgetExceeded
+		return false
+	}
+	q.budget -= cost
+	return n.re.MatchString(t.text)
+}
+
+func (n queryRegex) regex() bool { return true }
+
+// compileQueryRegex compiles a case insensitive pattern within the size limits
+func compileQueryRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > MaxQueryRegexLength {
+		return nil, fmt.Errorf("regex is longer than %d characters", MaxQueryRegexLength)
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl|syntax.FoldCase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	}
+	if len(prog.Inst) > MaxQueryRegexInsts {
+		return nil, errors.New("regex is too complex")
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// parseQueryTime parses 2006-01-02, RFC 3339 or unix seconds
+func parseQueryTime(v string) (time.Time, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0).UTC(), nil
+	}
+	if t, err := time.Parse(MessageDateLayout, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
+}
+
+type queryTokenKind int
+
+const (
+	queryWord queryTokenKind = iota
+	queryPhrase
+	queryLParen
+	queryRParen
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	field string
+	value string
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case queryLParen:
+		return "("
+	case queryRParen:
+		return ")"
+	case queryPhrase:
+		return strconv.Quote(t.value)
+	}
+	if t.field != "" {
+		return t.field + ":" + t.value
+	}
+	return t.value
+}
+
+func (t queryToken) isOperator(op string) bool {
+	return t.kind == queryWord && t.field == "" && t.value == op
+}
+
+var queryFields = map[string]struct{}{
+	"nick":   {},
+	"before": {},
+	"after":  {},
+	"re":     {},
+}
+
+func tokenizeQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		switch c := r[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryLParen})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: queryRParen})
+			i++
+		case c == '"':
+			v, n, err := readQueryQuoted(r[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: queryPhrase, value: v})
+			i += n
+		default:
+			t := queryToken{kind: queryWord}
+			start := i
+			for i < len(r) && r[i] != ':' && !isQueryWordEnd(r[i]) {
+				i++
+			}
+			if i < len(r) && r[i] == ':' {
+				if _, ok := queryFields[strings.ToLower(string(r[start:i]))]; ok {
+					t.field = strings.ToLower(string(r[start:i]))
+					i++
+					start = i
+				}
+			}
+			if t.field != "" && i < len(r) && r[i] == '"' {
+				v, n, err := readQueryQuoted(r[i:])
+				if err != nil {
+					return nil, err
+				}
+				t.value = v
+				i += n
+			} else {
+				// regexes may contain balanced parentheses
+				depth := 0
+				for ; i < len(r); i++ {
+					if r[i] == ' ' || r[i] == '\t' || r[i] == '\n' || r[i] == '\r' {
+						break
+					}
+					if t.field == "re" && r[i] == '\\' {
+						i++
+						continue
+					}
+					if t.field == "re" && r[i] == '(' {
+						depth++
+					} else if r[i] == ')' {
+						if depth == 0 {
+							break
+						}
+						depth--
+					} else if r[i] == '(' {
+						break
+					}
+				}
+				if i > len(r) {
+					i = len(r)
+				}
+				t.value = string(r[start:i])
+			}
+			if t.field != "" && t.value == "" {
+				return nil, fmt.Errorf("missing value for %s:", t.field)
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func isQueryWordEnd(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(' || c == ')'
+}
+
+// readQueryQuoted reads a double quoted string with \" and \\ escapes, it
+// returns the unquoted value and the number of runes read
+func readQueryQuoted(r []rune) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(r); i++ {
+		switch r[i] {
+		case '\\':
+			if i+1 < len(r) && (r[i+1] == '"' || r[i+1] == '\\') {
+				i++
+			}
+			b.WriteRune(r[i])
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteRune(r[i])
+		}
+	}
+	return "", 0, errors.New("unterminated quote")
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	terms  int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := queryOr{node}
+	for {
+		t, ok := p.peek()
+		if !ok || !t.isOperator("OR") {
+			break
+		}
+		p.pos++
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, node)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var and, regexes queryAnd
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == queryRParen || t.isOperator("OR") {
+			break
+		}
+		if t.isOperator("AND") {
+			p.pos++
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		// cheap terms first so regexes only run on lines that match the rest
+		if node.regex() {
+			regexes = append(regexes, node)
+		} else {
+			and = append(and, node)
+		}
+	}
+	and = append(and, regexes...)
+	switch len(and) {
+	case 0:
+		if t, ok := p.peek(); ok {
+			return nil, fmt.Errorf("unexpected %s", t)
+		}
+		return nil, errors.New("unexpected end of query")
+	case 1:
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of query")
+	}
+	p.pos++
+	switch {
+	case t.isOperator("NOT"):
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{node}, nil
+	case t.isOperator("AND") || t.isOperator("OR") || t.kind == queryRParen:
+		return nil, fmt.Errorf("unexpected %s", t)
+	case t.kind == queryLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != queryRParen {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return node, nil
+	}
+	p.terms++
+	return parseQueryTerm(t)
+}
+
+func parseQueryTerm(t queryToken) (queryNode, error) {
+	switch t.field {
+	case "nick":
+		return queryNick(t.value), nil
+	case "before", "after":
+		tm, err := parseQueryTime(t.value)
+		if err != nil {
+			return nil, err
+		}
+		return queryTime{before: t.field == "before", t: tm}, nil
+	case "re":
+		re, err := compileQueryRegex(t.value)
+		if err != nil {
+			return nil, err
+		}
+		return queryRegex{re}, nil
+	}
+	return queryText(strings.ToLower(t.value)), nil
+}
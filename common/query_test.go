@@ -0,0 +1,107 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	lines := []string{
+		"[2020-03-01 10:00:00 UTC] Bob: hello chat\n",
+		"[2020-03-01 12:00:00 UTC] Alice: Kappa hello there\n",
+		"[2020-03-02 08:00:00 UTC] bob: the quick brown fox\n",
+		"[2020-03-02 09:00:00 UTC] Carl: error 404 (not found)\n",
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"hello", "11--"},
+		{"HELLO", "11--"},
+		{"hello chat", "1---"},
+		{"hello AND chat", "1---"},
+		{`"hello there"`, "-1--"},
+		{"chat OR fox", "1-1-"},
+		{"NOT hello", "--11"},
+		{"hello NOT kappa", "1---"},
+		{"nick:bob", "1-1-"},
+		{"nick:bob OR nick:carl", "1-11"},
+		{"(nick:bob OR nick:carl) NOT fox", "1--1"},
+		{"after:2020-03-02", "--11"},
+		{"before:2020-03-01T11:00:00Z", "1---"},
+		{"after:1583056801 before:2020-03-02", "-1--"},
+		{"re:^h", "1---"},
+		{"re:[0-9]{3}", "---1"},
+		{`re:"quick .* fox"`, "--1-"},
+		{"(re:\\((not|is)\\s+found\\))", "---1"},
+		{"nick:alice re:KAPPA", "-1--"},
+		{"carl", "---1"},
+		{`"bob: the"`, "--1-"},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		var got strings.Builder
+		for _, line := range lines {
+			if q.Match(line) {
+				got.WriteByte('1')
+			} else {
+				got.WriteByte('-')
+			}
+		}
+		if got.String() != test.want {
+			t.Errorf("%q matched %s, want %s", test.query, got.String(), test.want)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"   ",
+		"(hello",
+		"hello)",
+		"OR hello",
+		"hello OR",
+		"NOT",
+		`"unterminated`,
+		"nick:",
+		"before:yesterday",
+		"re:(",
+		"re:" + strings.Repeat("a", MaxQueryRegexLength+1),
+		"re:(a{100}){100}",
+		strings.Repeat("a ", MaxQueryTerms+1),
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("expected error for %q", query)
+		}
+	}
+}
+
+func TestQueryBudget(t *testing.T) {
+	q, err := ParseQuery("NOT re:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.budget = 10 << 10
+	line := "[2020-03-01 10:00:00 UTC] Bob: " + strings.Repeat("a", 1<<10) + "\n"
+	matched := 0
+	for i := 0; i < 11; i++ {
+		if q.Match(line) {
+			matched++
+		}
+	}
+	if q.Err() != ErrQueryBudgetExceeded {
+		t.Fatalf("expected budget error, got %v", q.Err())
+	}
+	if matched != 10 {
+		t.Errorf("matched %d lines before running out of budget", matched)
+	}
+	q.ResetBudget()
+	if !q.Match(line) || q.Err() != nil {
+		t.Error("expected match after resetting the budget")
+	}
+}
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tags that are stored as dedicated record fields or carry no information
+var recordOmittedTags = map[string]struct{}{
+	"badges":       empty,
+	"badge-info":   empty,
+	"color":        empty,
+	"display-name": empty,
+	"emotes":       empty,
+	"flags":        empty,
+	"id":           empty,
+	"mod":          empty,
+	"room-id":      empty,
+	"subscriber":   empty,
+	"tmi-sent-ts":  empty,
+	"turbo":        empty,
+	"user-id":      empty,
+	"user-type":    empty,
+}
+
+// Record structured form of a logged line, stored next to the plain text log
+type Record struct {
+	Time        int64             `json:"ts"`
+	Type        string            `json:"type"`
+	Nick        string            `json:"nick"`
+	Text        string            `json:"text"`
+	DisplayName string            `json:"displayName,omitempty"`
+	UserID      string            `json:"userID,omitempty"`
+	RoomID      string            `json:"roomID,omitempty"`
+	MessageID   string            `json:"id,omitempty"`
+	Color       string            `json:"color,omitempty"`
+	Badges      map[string]string `json:"badges,omitempty"`
+	Emotes      []Emote           `json:"emotes,omitempty"`
+	Mod         bool              `json:"mod,omitempty"`
+	Subscriber  bool              `json:"subscriber,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// Emote position of an emote in the message text
+type Emote struct {
+	ID    string `json:"id"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// NewRecord creates a record from a message and its tags
+func NewRecord(m *Message) *Record {
+	r := &Record{
+		Time: m.Time.UnixNano() / int64(time.Millisecond),
+		Type: m.Type,
+		Nick: m.Nick,
+		Text: m.Data,
+	}
+	if len(m.Tags) == 0 {
+		return r
+	}
+	r.DisplayName = m.Tags["display-name"]
+	r.UserID = m.Tags["user-id"]
+	r.RoomID = m.Tags["room-id"]
+	r.MessageID = m.Tags["id"]
+	r.Color = m.Tags["color"]
+	r.Badges = ParseBadges(m.Tags["badges"])
+	r.Emotes = ParseEmotes(m.Tags["emotes"])
+	r.Mod = m.Tags["mod"] == "1"
+	r.Subscriber = m.Tags["subscriber"] == "1"
+	for k, v := range m.Tags {
+		if _, ok := recordOmittedTags[k]; ok || v == "" {
+			continue
+		}
+		if r.Tags == nil {
+			r.Tags = make(map[string]string)
+		}
+		r.Tags[k] = v
+	}
+	return r
+}
+
+// ParseBadges parses a badges tag value eg. "moderator/1,subscriber/12"
+func ParseBadges(tag string) map[string]string {
+	if tag == "" {
+		return nil
+	}
+	badges := make(map[string]string)
+	for _, badge := range strings.Split(tag, ",") {
+		parts := strings.SplitN(badge, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		badges[parts[0]] = parts[1]
+	}
+	return badges
+}
+
+// ParseEmotes parses an emotes tag value eg. "25:0-4,12-16/1902:6-10"
+func ParseEmotes(tag string) []Emote {
+	if tag == "" {
+		return nil
+	}
+	var emotes []Emote
+	for _, emote := range strings.Split(tag, "/") {
+		parts := strings.SplitN(emote, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, pos := range strings.Split(parts[1], ",") {
+			r := strings.SplitN(pos, "-", 2)
+			if len(r) != 2 {
+				continue
+			}
+			start, err := strconv.Atoi(r[0])
+			if err != nil {
+				continue
+			}
+			end, err := strconv.Atoi(r[1])
+			if err != nil {
+				continue
+			}
+			emotes = append(emotes, Emote{ID: parts[0], Start: start, End: end})
+		}
+	}
+	return emotes
+}
@@ -0,0 +1,257 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// search index limits, version 2 indexes store the size of the log they
+// cover
+const (
+	searchIndexVersion = 2
+	MaxSearchTermSize  = 64
+)
+
+// SearchIndex inverted index of lower case terms to the lines they occur in
+type SearchIndex struct {
+	lines uint32
+	size  int64
+	terms map[string][]uint32
+}
+
+// NewSearchIndex creates an empty index
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{terms: make(map[string][]uint32)}
+}
+
+// BuildSearchIndex indexes every line of an existing log
+func BuildSearchIndex(r io.Reader) (*SearchIndex, error) {
+	s := NewSearchIndex()
+	if _, err := s.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ReadFrom indexes the complete lines of r as the lines following the indexed
+// ones, an unterminated last line is skipped
+func (s *SearchIndex) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		s.AddLine(line)
+		n += int64(len(line))
+	}
+}
+
+// AddLine indexes the next line of the log, line includes its newline
+func (s *SearchIndex) AddLine(line string) {
+	if s.size >= 0 {
+		s.size += int64(len(line))
+	}
+	msg, err := ParseMessageLine(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		s.Add("")
+		return
+	}
+	s.Add(msg.Data)
+}
+
+// SearchTerms splits text into lower case index terms
+func SearchTerms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if len(f) <= MaxSearchTermSize {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// Add indexes the text of the next line of the log, lines added this way
+// aren't counted in the indexed size, see AddLine
+func (s *SearchIndex) Add(text string) {
+	seen := make(map[string]struct{})
+	for _, term := range SearchTerms(text) {
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = empty
+		s.terms[term] = append(s.terms[term], s.lines)
+	}
+	s.lines++
+}
+
+// Lines number of indexed lines
+func (s *SearchIndex) Lines() int {
+	return int(s.lines)
+}
+
+// Size bytes of the log covered by the indexed lines, -1 for indexes read
+// from files written without it
+func (s *SearchIndex) Size() int64 {
+	return s.size
+}
+
+// Lookup returns the sorted line numbers containing all of the terms
+func (s *SearchIndex) Lookup(terms []string) []uint32 {
+	if len(terms) == 0 {
+		return nil
+	}
+	var rs []uint32
+	for i, term := range terms {
+		postings, ok := s.terms[term]
+		if !ok {
+			return nil
+		}
+		if i == 0 {
+			rs = append(rs, postings...)
+			continue
+		}
+		rs = intersectPostings(rs, postings)
+		if len(rs) == 0 {
+			return nil
+		}
+	}
+	return rs
+}
+
+func intersectPostings(a, b []uint32) []uint32 {
+	rs := a[:0]
+	var i, j int
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			rs = append(rs, a[i])
+			i++
+			j++
+		}
+	}
+	return rs
+}
+
+// WriteTo writes the index to the disk
+func (s *SearchIndex) WriteTo(path string) error {
+	var buf bytes.Buffer
+	tmp := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) {
+		buf.Write(tmp[:binary.PutUvarint(tmp, v)])
+	}
+
+	terms := make([]string, 0, len(s.terms))
+	for term := range s.terms {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	buf.WriteByte(searchIndexVersion)
+	writeUvarint(uint64(s.lines))
+	writeUvarint(uint64(s.size + 1))
+	writeUvarint(uint64(len(terms)))
+	for _, term := range terms {
+		writeUvarint(uint64(len(term)))
+		buf.WriteString(term)
+		postings := s.terms[term]
+		writeUvarint(uint64(len(postings)))
+		var prev uint32
+		for _, p := range postings {
+			writeUvarint(uint64(p - prev))
+			prev = p
+		}
+	}
+
+	f, err := WriteCompressedFile(path+".writing", buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), strings.Replace(f.Name(), ".writing", "", -1))
+}
+
+// ReadSearchIndex reads an index from the disk
+func ReadSearchIndex(path string) (*SearchIndex, error) {
+	data, err := ReadCompressedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > searchIndexVersion {
+		return nil, errors.New("unsupported search index version")
+	}
+	lines, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(-1)
+	if version >= 2 {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		size = int64(v) - 1
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &SearchIndex{
+		lines: uint32(lines),
+		size:  size,
+		terms: make(map[string][]uint32, count),
+	}
+	for i := uint64(0); i < count; i++ {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if size > MaxSearchTermSize {
+			return nil, errors.New("malformed search index term")
+		}
+		term := make([]byte, size)
+		if _, err := io.ReadFull(r, term); err != nil {
+			return nil, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n > lines {
+			return nil, errors.New("malformed search index postings")
+		}
+		postings := make([]uint32, n)
+		var prev uint32
+		for j := range postings {
+			d, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			prev += uint32(d)
+			postings[j] = prev
+		}
+		s.terms[string(term)] = postings
+	}
+	return s, nil
+}
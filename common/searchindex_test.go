@@ -0,0 +1,84 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchIndexLookup(t *testing.T) {
+	s := NewSearchIndex()
+	s.Add("hello world")
+	s.Add("Hello, there")
+	s.Add("nothing to see")
+	s.Add("world HELLO world")
+
+	got := s.Lookup(SearchTerms("hello world"))
+	if len(got) != 2 || got[0] != 0 || got[1] != 3 {
+		t.Errorf("invalid lookup result, got: %v; want: [0 3]", got)
+	}
+	if got := s.Lookup([]string{"missing"}); len(got) != 0 {
+		t.Errorf("expected no results, got: %v", got)
+	}
+}
+
+func TestSearchIndexReadWrite(t *testing.T) {
+	s := NewSearchIndex()
+	s.Add("foo bar")
+	s.Add("bar baz")
+	s.Add("baz qux")
+	if err := s.WriteTo("/tmp/search"); err != nil {
+		t.Fatalf("error writing search index %s", err)
+	}
+
+	r, err := ReadSearchIndex("/tmp/search")
+	if err != nil {
+		t.Fatalf("error reading search index %s", err)
+	}
+	if r.Lines() != 3 {
+		t.Errorf("invalid line count, got: %d; want: 3", r.Lines())
+	}
+	if got := r.Lookup([]string{"baz"}); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("invalid lookup result, got: %v; want: [1 2]", got)
+	}
+}
+
+func TestBuildSearchIndex(t *testing.T) {
+	log := "[2020-03-01 00:00:01 UTC] foo: hello world\n" +
+		"broken line\n" +
+		"[2020-03-01 00:00:02 UTC] bar: world\n"
+	s, err := BuildSearchIndex(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("error building search index %s", err)
+	}
+	if got := s.Lookup([]string{"world"}); len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Errorf("invalid lookup result, got: %v; want: [0 2]", got)
+	}
+}
+
+func TestSearchIndexSize(t *testing.T) {
+	first := "[2020-03-01 00:00:01 UTC] foo: hello world\n"
+	second := "[2020-03-01 00:00:02 UTC] bar: world\n"
+	s, err := BuildSearchIndex(strings.NewReader(first + "[2020-03-01 00:00:02 UTC] bar: unterminated"))
+	if err != nil {
+		t.Fatalf("error building search index %s", err)
+	}
+	if s.Size() != int64(len(first)) || s.Lines() != 1 {
+		t.Errorf("invalid size, got: %d %d; want: %d 1", s.Size(), s.Lines(), len(first))
+	}
+	if err := s.WriteTo("/tmp/search-size"); err != nil {
+		t.Fatalf("error writing search index %s", err)
+	}
+	r, err := ReadSearchIndex("/tmp/search-size")
+	if err != nil {
+		t.Fatalf("error reading search index %s", err)
+	}
+	if r.Size() != s.Size() {
+		t.Errorf("invalid size read, got: %d; want: %d", r.Size(), s.Size())
+	}
+	if _, err := r.ReadFrom(strings.NewReader(second)); err != nil {
+		t.Fatalf("error indexing appended lines %s", err)
+	}
+	if got := r.Lookup([]string{"world"}); len(got) != 2 || got[1] != 1 || r.Size() != int64(len(first+second)) {
+		t.Errorf("invalid appended lookup, got: %v %d", got, r.Size())
+	}
+}
@@ -0,0 +1,326 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/datadog/zstd"
+)
+
+// Seekable logs are a series of independent zstd frames, one per hour of
+// messages or per SeekableFrameLines lines, followed by an index in a zstd
+// skippable frame. Plain zstd readers decode them like any other compressed
+// log. The index payload is a little endian entry per frame holding its file
+// offset, the unix time and the line number of its first line, followed by the
+// entry count and SeekableIndexMagic.
+const (
+	SeekableFrameLines = 10000
+	SeekableIndexMagic = 0x494c524f
+
+	skippableFrameMagic = 0x184d2a5e
+	seekableEntrySize   = 20
+	seekableFooterSize  = 8
+)
+
+// ErrNotSeekable returned by OpenSeekable for logs without a frame index
+var ErrNotSeekable = errors.New("log has no frame index")
+
+// SeekableFrame index entry of a seekable log frame
+type SeekableFrame struct {
+	Offset int64
+	Size   int64
+	Time   time.Time
+	Line   int
+}
+
+// SeekableWriter writes a seekable log, lines are buffered until complete
+type SeekableWriter struct {
+	w          io.Writer
+	maxLines   int
+	offset     int64
+	frames     []SeekableFrame
+	frame      *zstd.Writer
+	frameLines int
+	lines      int
+	hour       int64
+	partial    []byte
+}
+
+// NewSeekableWriter creates a SeekableWriter starting a new frame every hour
+// or every maxLines lines, 0 only splits hourly
+func NewSeekableWriter(w io.Writer, maxLines int) *SeekableWriter {
+	return &SeekableWriter{w: w, maxLines: maxLines}
+}
+
+// Write writes the complete lines of p to the log
+func (s *SeekableWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(s.partial) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			s.partial = append(s.partial, p...)
+			return n, nil
+		}
+		s.partial = append(s.partial, p[:i+1]...)
+		if err := s.writeLine(s.partial); err != nil {
+			return 0, err
+		}
+		s.partial = s.partial[:0]
+		p = p[i+1:]
+	}
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			break
+		}
+		if err := s.writeLine(p[:i+1]); err != nil {
+			return 0, err
+		}
+		p = p[i+1:]
+	}
+	s.partial = append(s.partial, p...)
+	return n, nil
+}
+
+func (s *SeekableWriter) writeLine(line []byte) error {
+	var t time.Time
+	if len(line) >= MessageTimeLayoutLength {
+		t, _ = time.Parse(MessageTimeLayout, string(line[:MessageTimeLayoutLength]))
+	}
+	if s.frame != nil && ((!t.IsZero() && t.Unix()/3600 != s.hour) || (s.maxLines > 0 && s.frameLines >= s.maxLines)) {
+		if err := s.endFrame(); err != nil {
+			return err
+		}
+	}
+	if s.frame == nil {
+		if t.IsZero() && len(s.frames) > 0 {
+			t = s.frames[len(s.frames)-1].Time
+		}
+		s.frames = append(s.frames, SeekableFrame{Offset: s.offset, Time: t, Line: s.lines})
+		s.frame = zstd.NewWriter(&countWriter{s.w, &s.offset})
+		s.frameLines = 0
+		s.hour = t.Unix() / 3600
+	}
+	if _, err := s.frame.Write(line); err != nil {
+		return err
+	}
+	s.frameLines++
+	s.lines++
+	return nil
+}
+
+func (s *SeekableWriter) endFrame() error {
+	err := s.frame.Close()
+	s.frame = nil
+	return err
+}
+
+// Close flushes the last frame and writes the index, an unterminated last
+// line is written as is
+func (s *SeekableWriter) Close() error {
+	if len(s.partial) > 0 {
+		if err := s.writeLine(s.partial); err != nil {
+			return err
+		}
+		s.partial = nil
+	}
+	if s.frame != nil {
+		if err := s.endFrame(); err != nil {
+			return err
+		}
+	}
+
+	size := len(s.frames)*seekableEntrySize + seekableFooterSize
+	b := make([]byte, 8+size)
+	binary.LittleEndian.PutUint32(b, skippableFrameMagic)
+	binary.LittleEndian.PutUint32(b[4:], uint32(size))
+	for i, f := range s.frames {
+		e := b[8+i*seekableEntrySize:]
+		binary.LittleEndian.PutUint64(e, uint64(f.Offset))
+		binary.LittleEndian.PutUint64(e[8:], uint64(f.Time.Unix()))
+		binary.LittleEndian.PutUint32(e[16:], uint32(f.Line))
+	}
+	binary.LittleEndian.PutUint32(b[len(b)-8:], uint32(len(s.frames)))
+	binary.LittleEndian.PutUint32(b[len(b)-4:], SeekableIndexMagic)
+	_, err := s.w.Write(b)
+	return err
+}
+
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// WriteSeekableFile writes the lines of r to a seekable compressed file at
+// path, replacing it once complete
+func WriteSeekableFile(path string, r io.Reader, maxLines int) error {
+	path = gzPath(path)
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := NewSeekableWriter(f, maxLines)
+	if _, err = io.Copy(w, r); err == nil {
+		err = w.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// CompressFileSeekable compress an existing file into the seekable format
+func CompressFileSeekable(path string, maxLines int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := WriteSeekableFile(path, f, maxLines); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// SeekableFile compressed log with a frame index
+type SeekableFile struct {
+	Frames []SeekableFrame
+	f      *os.File
+}
+
+// OpenSeekable opens a compressed log and reads its frame index, logs written
+// without one return ErrNotSeekable
+func OpenSeekable(path string) (*SeekableFile, error) {
+	f, err := os.Open(gzPath(path))
+	if err != nil {
+		return nil, err
+	}
+	frames, err := readSeekableIndex(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &SeekableFile{frames, f}, nil
+}
+
+func readSeekableIndex(f *os.File) ([]SeekableFrame, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	footer := make([]byte, seekableFooterSize)
+	if stat.Size() < 8+seekableFooterSize {
+		return nil, ErrNotSeekable
+	}
+	if _, err := f.ReadAt(footer, stat.Size()-seekableFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[4:]) != SeekableIndexMagic {
+		return nil, ErrNotSeekable
+	}
+	count := int64(binary.LittleEndian.Uint32(footer))
+	size := count*seekableEntrySize + seekableFooterSize
+	start := stat.Size() - size - 8
+	if start < 0 {
+		return nil, ErrNotSeekable
+	}
+	b := make([]byte, size+8)
+	if _, err := f.ReadAt(b, start); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(b) != skippableFrameMagic || int64(binary.LittleEndian.Uint32(b[4:])) != size {
+		return nil, ErrNotSeekable
+	}
+
+	frames := make([]SeekableFrame, count)
+	for i := range frames {
+		e := b[8+i*seekableEntrySize:]
+		frames[i] = SeekableFrame{
+			Offset: int64(binary.LittleEndian.Uint64(e)),
+			Time:   time.Unix(int64(binary.LittleEndian.Uint64(e[8:])), 0).UTC(),
+			Line:   int(binary.LittleEndian.Uint32(e[16:])),
+		}
+	}
+	for i := range frames {
+		end := start
+		if i+1 < len(frames) {
+			end = frames[i+1].Offset
+		}
+		frames[i].Size = end - frames[i].Offset
+		if frames[i].Size < 0 {
+			return nil, ErrNotSeekable
+		}
+	}
+	return frames, nil
+}
+
+// Close closes the underlying file
+func (s *SeekableFile) Close() error {
+	return s.f.Close()
+}
+
+// FramesReader decompresses the frames from frame i to the end of the log
+func (s *SeekableFile) FramesReader(i int) io.ReadCloser {
+	if i >= len(s.Frames) {
+		return ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	last := s.Frames[len(s.Frames)-1]
+	end := last.Offset + last.Size
+	return zstd.NewReader(io.NewSectionReader(s.f, s.Frames[i].Offset, end-s.Frames[i].Offset))
+}
+
+// SeekTime returns the index of the frame holding the first lines at or after
+// t, lines before t may lead the frame
+func (s *SeekableFile) SeekTime(t time.Time) int {
+	i := sort.Search(len(s.Frames), func(i int) bool {
+		return s.Frames[i].Time.After(t)
+	})
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// ReadFrame decompresses frame i
+func (s *SeekableFile) ReadFrame(i int) ([]byte, error) {
+	f := s.Frames[i]
+	r := zstd.NewReader(io.NewSectionReader(s.f, f.Offset, f.Size))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// ReadBackwards calls fn with the lines of the log from last to first until
+// it returns false, line includes its newline and is only valid until fn
+// returns
+func (s *SeekableFile) ReadBackwards(fn func(line []byte) bool) error {
+	for i := len(s.Frames) - 1; i >= 0; i-- {
+		data, err := s.ReadFrame(i)
+		if err != nil {
+			return err
+		}
+		for len(data) > 0 {
+			j := bytes.LastIndexByte(data[:len(data)-1], '\n')
+			if !fn(data[j+1:]) {
+				return nil
+			}
+			data = data[:j+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeekable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seekable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "2020-03-01.txt")
+
+	// three lines every hour from 00:00 to 04:00
+	var lines []string
+	for h := 0; h < 5; h++ {
+		for m := 0; m < 3; m++ {
+			lines = append(lines, fmt.Sprintf("[2020-03-01 %02d:%02d:00 UTC] Bob: line %d\n", h, m, len(lines)))
+		}
+	}
+	if err := WriteSeekableFile(path, strings.NewReader(strings.Join(lines, "")), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadCompressedFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != strings.Join(lines, "") {
+		t.Fatalf("plain read = %q", data)
+	}
+
+	s, err := OpenSeekable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// an hour of 3 lines with at most 2 lines per frame
+	if len(s.Frames) != 10 {
+		t.Fatalf("frames = %+v", s.Frames)
+	}
+	if f := s.Frames[2]; f.Line != 3 || f.Time.Hour() != 1 {
+		t.Errorf("frame 2 = %+v", f)
+	}
+
+	i := s.SeekTime(time.Date(2020, 3, 1, 3, 1, 30, 0, time.UTC))
+	r := s.FramesReader(i)
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), lines[9]) || !strings.HasSuffix(string(b), lines[14]) {
+		t.Errorf("seek to 03:01:30 read from frame %d %q", i, b)
+	}
+
+	var got []string
+	err = s.ReadBackwards(func(line []byte) bool {
+		got = append(got, string(line))
+		return len(got) < 4
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[0] != lines[14] || got[3] != lines[11] {
+		t.Errorf("backwards = %q", got)
+	}
+}
+
+func TestNotSeekable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seekable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "2020-03-01.txt")
+	if _, err := WriteCompressedFile(path, []byte("[2020-03-01 00:00:00 UTC] Bob: hi\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSeekable(path); err != ErrNotSeekable {
+		t.Errorf("expected ErrNotSeekable, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"errors"
+	"time"
+)
+
+// source metrics
+var (
+	sourceReconnects = Metrics.Counter("orl_source_reconnects_total", "Chat source reconnect attempts.", "source")
+	sourceDropped    = Metrics.Counter("orl_source_dropped_messages_total", "Messages dropped because the messages channel was full.", "source")
+)
+
+// ErrJoinUnsupported returned by sources with a fixed set of channels
+var ErrJoinUnsupported = errors.New("source doesn't support joining channels")
+
+// ChatSource chat platform the logger reads messages from
+type ChatSource interface {
+	// Name source name used in logs and config eg. "twitch"
+	Name() string
+	// Run connects and starts reading messages, callers run it in a goroutine
+	Run()
+	// Stop disconnects, the messages channel is closed once reading stopped
+	Stop()
+	// Messages channel accessor
+	Messages() <-chan *Message
+	// Dropped number of messages dropped because the consumer fell behind
+	Dropped() uint64
+	// Status state of the source connections
+	Status() []ConnStatus
+	// Join starts reading messages from a channel
+	Join(ch string) error
+	// Leave stops reading messages from a channel
+	Leave(ch string) error
+}
+
+// ConnStatus state of a single chat connection
+type ConnStatus struct {
+	Connected   bool      `json:"connected"`
+	LastMessage time.Time `json:"lastMessage"`
+	Channels    int       `json:"channels"`
+}
@@ -0,0 +1,309 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Day stats are stored next to each day log, named after it with
+// DayStatsExtension, as zstd compressed JSON objects whose version field is
+// StatsVersion. Words and Emotes hold every term counted that day so they
+// can be summed, month stats keep the StatsTopTerms most used. Emotes are
+// the words of the channel's EmoteRegistry and those marked by the Twitch
+// emotes tag of the records.
+const (
+	StatsVersion      = 1
+	DayStatsExtension = ".stats"
+	StatsTopTerms     = 100
+)
+
+// minimum length of a counted word
+const statsMinWordLength = 3
+
+// DayStats activity of a day log, Hours are line counts by UTC hour
+type DayStats struct {
+	Version       int         `json:"version"`
+	Date          string      `json:"date"`
+	Lines         int         `json:"lines"`
+	Hours         [24]int     `json:"hours"`
+	Chatters      []string    `json:"chatters"`
+	BusiestMinute StatsMinute `json:"busiestMinute"`
+	Words         []TermCount `json:"words"`
+	Emotes        []TermCount `json:"emotes"`
+}
+
+// StatsMinute lines sent in the minute starting at unix time Time
+type StatsMinute struct {
+	Time  int64 `json:"time"`
+	Lines int   `json:"lines"`
+}
+
+// TermCount uses of a word or emote
+type TermCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// DayStatsCounter counts the activity and emote uses of a day as its lines
+// are logged
+type DayStatsCounter struct {
+	date     string
+	registry EmoteRegistry
+	lines    int
+	hours    [24]int
+	minutes  [24 * 60]int
+	chatters map[string]struct{}
+	words    map[string]int
+	emotes   map[string]map[string]int
+}
+
+// NewDayStatsCounter counter of the day log of date, emotes are looked up in
+// registry
+func NewDayStatsCounter(date string, registry EmoteRegistry) *DayStatsCounter {
+	return &DayStatsCounter{
+		date:     date,
+		registry: registry,
+		chatters: make(map[string]struct{}),
+		words:    make(map[string]int),
+		emotes:   make(map[string]map[string]int),
+	}
+}
+
+// Add counts message m and its emotes, registered or marked by its tags
+func (c *DayStatsCounter) Add(m *Message) {
+	c.addLine(m)
+	c.addEmotes(m.Nick, c.registry.Emotes(m.Data, ParseEmotes(m.Tags["emotes"])))
+}
+
+// AddLine counts message m and its registered emotes, the emotes only known
+// from its tags are added by AddTaggedEmotes
+func (c *DayStatsCounter) AddLine(m *Message) {
+	c.addLine(m)
+	c.addEmotes(m.Nick, c.registry.Emotes(m.Data, nil))
+}
+
+// AddTaggedEmotes counts the unregistered emotes of a message of nick marked
+// by tagged
+func (c *DayStatsCounter) AddTaggedEmotes(nick, text string, tagged []Emote) {
+	c.addEmotes(nick, c.registry.TaggedEmotes(text, tagged))
+}
+
+func (c *DayStatsCounter) addLine(m *Message) {
+	t := m.Time.UTC()
+	c.lines++
+	c.hours[t.Hour()]++
+	c.minutes[t.Hour()*60+t.Minute()]++
+	c.chatters[m.Nick] = struct{}{}
+	for _, w := range strings.Fields(m.Data) {
+		if strings.Contains(w, "://") {
+			continue
+		}
+		w = strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}))
+		if utf8.RuneCountInString(w) >= statsMinWordLength {
+			c.words[w]++
+		}
+	}
+}
+
+func (c *DayStatsCounter) addEmotes(nick string, emotes []string) {
+	if len(emotes) == 0 {
+		return
+	}
+	n, ok := c.emotes[nick]
+	if !ok {
+		n = make(map[string]int)
+		c.emotes[nick] = n
+	}
+	for _, emote := range emotes {
+		n[emote]++
+	}
+}
+
+// Stats returns the counted stats
+func (c *DayStatsCounter) Stats() *DayStats {
+	emotes := make(map[string]int)
+	for _, n := range c.emotes {
+		for emote, uses := range n {
+			emotes[emote] += uses
+		}
+	}
+	s := &DayStats{
+		Version:  StatsVersion,
+		Date:     c.date,
+		Lines:    c.lines,
+		Hours:    c.hours,
+		Chatters: make([]string, 0, len(c.chatters)),
+		Words:    TopTerms(c.words, len(c.words)),
+		Emotes:   TopTerms(emotes, len(emotes)),
+	}
+	for nick := range c.chatters {
+		s.Chatters = append(s.Chatters, nick)
+	}
+	sort.Strings(s.Chatters)
+	day, err := time.Parse(MessageDateLayout, c.date)
+	if err != nil {
+		return s
+	}
+	for i, n := range c.minutes {
+		if n > s.BusiestMinute.Lines {
+			s.BusiestMinute = StatsMinute{day.Add(time.Duration(i) * time.Minute).Unix(), n}
+		}
+	}
+	return s
+}
+
+// Emotes returns the counted emote uses of each nick
+func (c *DayStatsCounter) Emotes() *DayEmotes {
+	d := &DayEmotes{
+		Version: StatsVersion,
+		Date:    c.date,
+		Nicks:   make(map[string]map[string]int, len(c.emotes)),
+	}
+	for nick, n := range c.emotes {
+		uses := make(map[string]int, len(n))
+		for emote, count := range n {
+			uses[emote] = count
+		}
+		d.Nicks[nick] = uses
+	}
+	return d
+}
+
+// TopTerms returns the limit most used terms, ties are ordered by term
+func TopTerms(counts map[string]int, limit int) []TermCount {
+	terms := make([]TermCount, 0, len(counts))
+	for term, n := range counts {
+		terms = append(terms, TermCount{term, n})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+	return terms
+}
+
+// CountDayStats counts the day log lines of logs and the tagged emotes of
+// the structured records of the day, records may be nil
+func CountDayStats(logs, records io.Reader, date string, registry EmoteRegistry) (*DayStatsCounter, error) {
+	c := NewDayStatsCounter(date, registry)
+	lines := NewLineReader(logs)
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return c, err
+		}
+		m, err := ParseMessageLine(string(line))
+		if err != nil {
+			continue
+		}
+		c.AddLine(m)
+	}
+	if records == nil {
+		return c, nil
+	}
+	return c, c.AddRecords(records)
+}
+
+// AddRecords counts the tagged emotes of the structured records of r, the
+// lines of the records are counted by AddLine
+func (c *DayStatsCounter) AddRecords(r io.Reader) error {
+	lines := NewLineReader(r)
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			continue
+		}
+		c.AddTaggedEmotes(r.Nick, r.Text, r.Emotes)
+	}
+}
+
+// BuildDayStats counts the day log at path, plain or compressed, and the
+// tagged emotes of its records file if there is one
+func BuildDayStats(path string, registry EmoteRegistry) (*DayStatsCounter, error) {
+	path = strings.TrimSuffix(path, ".gz")
+	logs, err := openDayFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+	var records io.Reader
+	if r, err := openDayFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".jsonl"); err == nil {
+		defer r.Close()
+		records = r
+	}
+	name := filepath.Base(path)
+	return CountDayStats(logs, records, name[:len(name)-len(filepath.Ext(name))], registry)
+}
+
+// openDayFile opens the plain file at path or else its compressed version
+func openDayFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return OpenCompressedFile(path)
+	}
+	return f, err
+}
+
+// ReadDayStats reads the stats of the day log at path
+func ReadDayStats(path string) (*DayStats, error) {
+	data, err := ReadCompressedFile(dayFilePath(path, DayStatsExtension))
+	if err != nil {
+		return nil, err
+	}
+	s := &DayStats{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error decoding stats %s %v", path, err)
+	}
+	if s.Version != StatsVersion {
+		return nil, fmt.Errorf("unsupported stats version %d in %s", s.Version, path)
+	}
+	return s, nil
+}
+
+// WriteDayStats writes the stats of the day log at path
+func WriteDayStats(path string, s *DayStats) error {
+	s.Version = StatsVersion
+	return writeDayFile(dayFilePath(path, DayStatsExtension), s)
+}
+
+// dayFilePath file with extension ext next to the day log at path, without
+// the .gz extension of the stored file
+func dayFilePath(path, ext string) string {
+	path = strings.TrimSuffix(path, ".gz")
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+func writeDayFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := WriteCompressedFile(path+".writing", data)
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), gzPath(path))
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDayStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "2020-03-01.txt")
+
+	log := "[2020-03-01 10:00:00 UTC] Bob: Kappa hello, hello!\n" +
+		"[2020-03-01 10:00:30 UTC] Alice: hi https://example.com\n" +
+		"[2020-03-01 12:15:00 UTC] Bob: Kappa\n"
+	records := `{"ts":1583056800000,"type":"MSG","nick":"Bob","text":"Kappa hello, hello!","emotes":[{"id":"25","start":0,"end":4}]}` + "\n" +
+		`{"ts":1583056830000,"type":"MSG","nick":"Alice","text":"hi https://example.com"}` + "\n" +
+		`{"ts":1583064900000,"type":"MSG","nick":"Bob","text":"Kappa","emotes":[{"id":"25","start":0,"end":4},{"id":"1","start":3,"end":9}]}` + "\n"
+	if _, err := WriteCompressedFile(path, []byte(log)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "2020-03-01.jsonl"), []byte(records), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := BuildDayStats(path+".gz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteDayStats(path, c.Stats()); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadDayStats(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Date != "2020-03-01" || s.Lines != 3 || s.Hours[10] != 2 || s.Hours[12] != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+	if strings.Join(s.Chatters, ",") != "Alice,Bob" {
+		t.Errorf("chatters = %v", s.Chatters)
+	}
+	if s.BusiestMinute != (StatsMinute{1583056800, 2}) {
+		t.Errorf("busiest minute = %+v", s.BusiestMinute)
+	}
+	want := []TermCount{{"hello", 2}, {"kappa", 2}}
+	if len(s.Words) != 2 || s.Words[0] != want[0] || s.Words[1] != want[1] {
+		t.Errorf("words = %+v", s.Words)
+	}
+	// the emote past the end of the text is skipped
+	if len(s.Emotes) != 1 || s.Emotes[0] != (TermCount{"Kappa", 2}) {
+		t.Errorf("emotes = %+v", s.Emotes)
+	}
+
+	// live messages take emotes from their tags
+	live := NewDayStatsCounter("2020-03-01", nil)
+	live.Add(&Message{
+		Nick: "Bob",
+		Data: "hi PogChamp",
+		Time: time.Unix(1583056800, 0),
+		Tags: map[string]string{"emotes": "88:3-10"},
+	})
+	if e := live.Stats().Emotes; len(e) != 1 || e[0] != (TermCount{"PogChamp", 1}) {
+		t.Errorf("live emotes = %+v", e)
+	}
+}
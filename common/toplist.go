@@ -0,0 +1,197 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Toplists are stored as zstd compressed JSON objects whose version field
+// is TopListVersion. The month toplist, TopListFile in a month directory,
+// holds the totals of each nick sorted by lines:
+//
+//	{"version": 1, "generated": 1583020800, "users": [
+//	  {"username": "Bob", "lines": 3, "bytes": 40, "seen": 1583020800}]}
+//
+// The counters of each day, named after the day log with DayTopListExtension,
+// hold the NickDay of each nick:
+//
+//	{"version": 1, "nicks": {"Bob": {"date": "2020-03-01", "lines": 3,
+//	  "bytes": 40, "first": 1583020000, "last": 1583020800}}}
+//
+// Times are unix seconds. Readers reject versions they don't know.
+const (
+	TopListVersion      = 1
+	TopListFile         = "toplist.json"
+	DayTopListExtension = ".toplist"
+)
+
+// TopList totals of the nicks of a month, Generated is the unix time it was
+// written
+type TopList struct {
+	Version   int           `json:"version"`
+	Generated int64         `json:"generated"`
+	Users     []TopListUser `json:"users"`
+}
+
+// TopListUser month totals of a nick, Seen is the unix time of its last line
+type TopListUser struct {
+	Username string `json:"username"`
+	Lines    int    `json:"lines"`
+	Bytes    int    `json:"bytes"`
+	Seen     int64  `json:"seen"`
+}
+
+// dayTopList day toplist file
+type dayTopList struct {
+	Version int                 `json:"version"`
+	Nicks   map[string]*NickDay `json:"nicks"`
+}
+
+// NewTopList sorts the month totals of each nick by lines
+func NewTopList(users map[string]*NickDay) *TopList {
+	t := &TopList{
+		Version: TopListVersion,
+		Users:   make([]TopListUser, 0, len(users)),
+	}
+	for nick, u := range users {
+		if u.Lines == 0 {
+			continue
+		}
+		t.Users = append(t.Users, TopListUser{
+			Username: nick,
+			Lines:    u.Lines,
+			Bytes:    u.Bytes,
+			Seen:     u.Last,
+		})
+	}
+	sort.Slice(t.Users, func(i, j int) bool {
+		if t.Users[i].Lines != t.Users[j].Lines {
+			return t.Users[i].Lines > t.Users[j].Lines
+		}
+		return t.Users[i].Username < t.Users[j].Username
+	})
+	return t
+}
+
+// ReadTopList reads the month toplist at path
+func ReadTopList(path string) (*TopList, error) {
+	data, err := ReadCompressedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &TopList{}
+	if err := decodeTopList(data, &t.Version, t); err != nil {
+		return nil, fmt.Errorf("error decoding toplist %s %v", path, err)
+	}
+	return t, nil
+}
+
+// WriteTopList writes t to path setting its version, an unset generation
+// time is now
+func WriteTopList(path string, t *TopList) error {
+	t.Version = TopListVersion
+	if t.Generated == 0 {
+		t.Generated = time.Now().Unix()
+	}
+	return writeTopListFile(path, t)
+}
+
+// decodeTopList decodes data into v checking the version
+func decodeTopList(data []byte, version *int, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if *version != TopListVersion {
+		return fmt.Errorf("unsupported toplist version %d", *version)
+	}
+	return nil
+}
+
+func writeTopListFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := WriteCompressedFile(path+".writing", data)
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), gzPath(path))
+}
+
+// MessageBytes bytes a message adds to its nick's toplist total, the message
+// and its ": " nick separator
+func MessageBytes(data string) int {
+	return len(strings.TrimSuffix(data, "\n")) + len(": ")
+}
+
+// CountNickDays counts the lines of each nick in the day log lines of r
+func CountNickDays(r io.Reader, date string) (map[string]*NickDay, error) {
+	days := map[string]*NickDay{}
+	lines := NewLineReader(r)
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			return days, nil
+		} else if err != nil {
+			return days, err
+		}
+		m, err := ParseMessageLine(string(line))
+		if err != nil {
+			continue
+		}
+		d, ok := days[m.Nick]
+		if !ok {
+			d = &NickDay{Date: date}
+			days[m.Nick] = d
+		}
+		d.Count(m)
+	}
+}
+
+// ReadDayTopList reads the toplist counters of the day log at path, a
+// missing file is an empty toplist
+func ReadDayTopList(path string) (map[string]*NickDay, error) {
+	data, err := ReadCompressedFile(dayTopListPath(path))
+	if os.IsNotExist(err) {
+		return map[string]*NickDay{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	d := &dayTopList{}
+	if err := decodeTopList(data, &d.Version, d); err != nil {
+		return nil, fmt.Errorf("error decoding toplist %s %v", path, err)
+	}
+	if d.Nicks == nil {
+		d.Nicks = map[string]*NickDay{}
+	}
+	return d.Nicks, nil
+}
+
+// WriteDayTopList writes the toplist counters of the day log at path
+func WriteDayTopList(path string, days map[string]*NickDay) error {
+	return writeTopListFile(dayTopListPath(path), &dayTopList{TopListVersion, days})
+}
+
+// AddNickDays adds the counters of a day to the month totals
+func AddNickDays(month, day map[string]*NickDay) {
+	for nick, d := range day {
+		m, ok := month[nick]
+		if !ok {
+			m = &NickDay{}
+			month[nick] = m
+		}
+		m.Merge(*d)
+	}
+}
+
+func dayTopListPath(path string) string {
+	path = strings.TrimSuffix(path, ".gz")
+	return strings.TrimSuffix(path, filepath.Ext(path)) + DayTopListExtension
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDayTopList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toplist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "2020-03-01.txt")
+
+	log := "[2020-03-01 10:00:00 UTC] Bob: hello\n" +
+		"[2020-03-01 10:00:01 UTC] Alice: hi\n" +
+		"[2020-03-01 10:00:02 UTC] Bob: bye\n"
+	days, err := CountNickDays(strings.NewReader(log), "2020-03-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := days["Bob"]; b == nil || b.Lines != 2 || b.Bytes != len(": hello")+len(": bye") || b.First != 1583056800 || b.Last != 1583056802 {
+		t.Errorf("bob = %+v", b)
+	}
+
+	if err := WriteDayTopList(path, days); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadDayTopList(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || *read["Alice"] != *days["Alice"] {
+		t.Errorf("read = %+v", read)
+	}
+
+	month := map[string]*NickDay{"Bob": {Lines: 1, Bytes: 5, First: 1583000000, Last: 1583000000}}
+	AddNickDays(month, read)
+	if b := month["Bob"]; b.Lines != 3 || b.Bytes != 5+days["Bob"].Bytes || b.First != 1583000000 || b.Last != 1583056802 {
+		t.Errorf("month bob = %+v", b)
+	}
+
+	if empty, err := ReadDayTopList(filepath.Join(dir, "2020-03-02.txt")); err != nil || len(empty) != 0 {
+		t.Errorf("missing toplist = %v %v", empty, err)
+	}
+}
+
+func TestTopList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toplist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, TopListFile)
+
+	users := map[string]*NickDay{
+		"Alice": {Lines: 2, Bytes: 20, Last: 1583056801},
+		"Bob":   {Lines: 3, Bytes: 40, Last: 1583056802},
+		"Carl":  {Lines: 2, Bytes: 10, Last: 1583056800},
+	}
+	if err := WriteTopList(path, NewTopList(users)); err != nil {
+		t.Fatal(err)
+	}
+	toplist, err := ReadTopList(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toplist.Version != TopListVersion || toplist.Generated == 0 {
+		t.Errorf("toplist version %d generated %d", toplist.Version, toplist.Generated)
+	}
+	want := []TopListUser{
+		{"Bob", 3, 40, 1583056802},
+		{"Alice", 2, 20, 1583056801},
+		{"Carl", 2, 10, 1583056800},
+	}
+	if len(toplist.Users) != len(want) {
+		t.Fatalf("users = %+v", toplist.Users)
+	}
+	for i, u := range toplist.Users {
+		if u != want[i] {
+			t.Errorf("user %d = %+v, want %+v", i, u, want[i])
+		}
+	}
+
+	if _, err := WriteCompressedFile(path, []byte(`{"version":2,"users":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTopList(path + ".gz"); err == nil {
+		t.Error("toplist with unknown version read")
+	}
+}
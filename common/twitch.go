@@ -5,10 +5,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,17 +16,36 @@ import (
 
 // Twitch twitch chat client
 type Twitch struct {
-	connLock       sync.Mutex
-	sendLock       sync.Mutex
-	conn           *websocket.Conn
-	ChLock         sync.RWMutex
-	channels       []string
-	messages       chan *Message
-	MessagePattern *regexp.Regexp
-	SubPattern     *regexp.Regexp
-	lastMessageMu  sync.RWMutex
-	lastMessage    time.Time
-	quit           chan struct{}
+	connLock      sync.Mutex
+	sendLock      sync.Mutex
+	connected     bool
+	conn          *websocket.Conn
+	ChLock        sync.RWMutex
+	channels      []string
+	messages      chan *Message
+	lastMessageMu sync.RWMutex
+	lastMessage   time.Time
+	backoff       *Backoff
+	dropped       uint64
+	quit          chan struct{}
+	switching     int32
+	switched      sync.WaitGroup
+	seenMu        sync.Mutex
+	seen          map[string]struct{}
+	seenUntil     time.Time
+}
+
+// TwitchDedupWindow how long messages read on the replaced connection are
+// recognized after a requested reconnect, both connections receive the
+// messages sent while the new one joins
+const TwitchDedupWindow = time.Minute
+
+// usernotice msg-ids that are logged as twitchnotify messages
+var twitchSubNotices = map[string]struct{}{
+	"sub":             empty,
+	"resub":           empty,
+	"subgift":         empty,
+	"giftpaidupgrade": empty,
 }
 
 // NewTwitch new twitch chat client
@@ -34,30 +53,21 @@ func NewTwitch() *Twitch {
 	return &Twitch{
 		channels: make([]string, 0),
 		messages: make(chan *Message, MessageBufferSize),
-		// > @badges=global_mod/1,turbo/1;color=#0D4200;display-name=dallas;emotes=25:0-4,12-16/1902:6-10;mod=0;room-id=1337;
-		//subscriber=0;turbo=1;user-id=1337;user-type=global_mod :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #dallas :Kappa Keepo Kappa
-		MessagePattern: regexp.MustCompile(`user-type=.+:([a-z0-9_-]+)\!.+\.tmi\.twitch\.tv PRIVMSG #([a-z0-9_-]+) :(.+)`),
-		// > @badges=staff/1,broadcaster/1,turbo/1;color=#008000;display-name=ronni;emotes=;mod=0;msg-id=resub;msg-param-months=6;
-		// msg-param-sub-plan=Prime;msg-param-sub-plan-name=Prime;room-id=1337;subscriber=1;system-msg=ronni\shas\ssubscribed\sfor\s6\smonths!;
-		// login=ronni;turbo=1;user-id=1337;user-type=staff :tmi.twitch.tv USERNOTICE #dallas :Great stream -- keep it up!
-		SubPattern: regexp.MustCompile(`msg-id=(sub|resub|subgift|giftpaidupgrade);.+;system-msg=(.+);tmi-sent-ts.+ \:tmi\.twitch\.tv USERNOTICE #([a-z0-9_-]+)( :.+)?`),
-		quit:       make(chan struct{}, 2),
+		backoff:  NewBackoff(),
+		quit:     make(chan struct{}, 2),
 	}
 }
 
-func (c *Twitch) connect() {
+// connect dials a new connection, logs in and joins the channels before
+// replacing the current connection
+func (c *Twitch) connect() error {
 	conf := GetConfig()
 	dialer := websocket.Dialer{HandshakeTimeout: HandshakeTimeout}
 	headers := http.Header{"Origin": []string{conf.Twitch.OriginURL}}
 
-	var err error
-	c.connLock.Lock()
-	c.conn, _, err = dialer.Dial(GetConfig().Twitch.SocketURL, headers)
-	c.connLock.Unlock()
+	conn, _, err := dialer.Dial(conf.Twitch.SocketURL, headers)
 	if err != nil {
-		log.Printf("error connecting to twitch ws %s", err)
-		c.reconnect()
-		return
+		return fmt.Errorf("error connecting to twitch ws %s", err)
 	}
 
 	if conf.Twitch.OAuth == "" || conf.Twitch.Nick == "" {
@@ -66,46 +76,154 @@ func (c *Twitch) connect() {
 		conf.Twitch.Nick = "justinfan659"
 	}
 
-	c.send("PASS " + conf.Twitch.OAuth)
-	c.send("NICK " + conf.Twitch.Nick)
-	c.send("CAP REQ :twitch.tv/tags")
-	c.send("CAP REQ :twitch.tv/commands")
+	for _, m := range []string{
+		"PASS " + conf.Twitch.OAuth,
+		"NICK " + conf.Twitch.Nick,
+		"CAP REQ :twitch.tv/tags",
+		"CAP REQ :twitch.tv/commands",
+	} {
+		if err := c.write(conn, m); err != nil {
+			conn.Close()
+			return err
+		}
+	}
 
-	for _, ch := range c.channels {
+	c.ChLock.RLock()
+	channels := make([]string, len(c.channels))
+	copy(channels, c.channels)
+	c.ChLock.RUnlock()
+	for _, ch := range channels {
 		select {
 		case <-c.quit:
-			return
+			conn.Close()
+			return errors.New("twitch client stopped")
 		default:
 		}
 		ch = strings.ToLower(ch)
 		log.Printf("joining %s", ch)
-		err := c.send("JOIN #" + ch)
-		if err != nil {
+		if err := c.write(conn, "JOIN #"+ch); err != nil {
 			log.Println("failed to join", ch, "after freshly re/connecting to the websocket")
 		}
 	}
+
+	c.connLock.Lock()
+	old := c.conn
+	c.conn = conn
+	c.connected = true
+	c.connLock.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	c.lastMessageMu.Lock()
+	c.lastMessage = time.Now()
+	c.lastMessageMu.Unlock()
+	return nil
+}
+
+// reconnect closes the current connection and retries connecting with
+// backoff until it succeeds or the client is stopped. Only the read loop
+// reconnects, other goroutines drop the connection to trigger it.
+func (c *Twitch) reconnect() bool {
+	c.drop()
+	for {
+		delay := c.backoff.Next()
+		sourceReconnects.Inc(c.Name())
+		log.Printf("reconnecting to twitch in %s", delay)
+		select {
+		case <-c.quit:
+			return false
+		case <-time.After(delay):
+		}
+		err := c.connect()
+		if err == nil {
+			return true
+		}
+		log.Println(err)
+	}
+}
+
+// switchConn connects and joins the channels in the background while the
+// read loop keeps reading the current connection, which is replaced once the
+// new one is joined. Twitch requests it before restarting its servers.
+func (c *Twitch) switchConn() {
+	if !atomic.CompareAndSwapInt32(&c.switching, 0, 1) {
+		return
+	}
+	c.seenMu.Lock()
+	c.seen = make(map[string]struct{})
+	c.seenMu.Unlock()
+	c.switched.Add(1)
+	go func() {
+		defer c.switched.Done()
+		err := c.connect()
+		c.seenMu.Lock()
+		c.seenUntil = time.Now().Add(TwitchDedupWindow)
+		if err != nil {
+			c.seen = nil
+		}
+		c.seenMu.Unlock()
+		atomic.StoreInt32(&c.switching, 0)
+		if err != nil {
+			log.Println(err)
+			c.drop()
+		}
+	}()
 }
 
-func (c *Twitch) reconnect() {
+// seenMessage records the ids of the messages read while the connection is
+// being switched and reports the ones read again on the new connection
+func (c *Twitch) seenMessage(id string) bool {
+	if id == "" {
+		return false
+	}
+	c.seenMu.Lock()
+	defer c.seenMu.Unlock()
+	switch {
+	case c.seen == nil:
+		return false
+	case atomic.LoadInt32(&c.switching) == 1:
+		c.seen[id] = empty
+		return false
+	case time.Now().After(c.seenUntil):
+		c.seen = nil
+		return false
+	}
+	_, ok := c.seen[id]
+	return ok
+}
+
+// drop closes the current connection which makes the read loop reconnect
+func (c *Twitch) drop() {
 	c.connLock.Lock()
+	c.connected = false
 	if c.conn != nil {
 		c.conn.Close()
 	}
 	c.connLock.Unlock()
+}
 
-	time.Sleep(SocketReconnectDelay)
-	c.connect()
+func (c *Twitch) getConn() *websocket.Conn {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.conn
 }
 
 // Run connect and start message read loop
 func (c *Twitch) Run() {
-	pinger := time.NewTicker(4 * time.Minute)
-	c.connect()
+	if err := c.connect(); err != nil {
+		log.Println(err)
+		if !c.reconnect() {
+			close(c.messages)
+			return
+		}
+	}
 	go c.rejoinHandler()
 
 	pingTicker := time.NewTicker(5 * time.Minute)
 
 	go func() {
+		defer pingTicker.Stop()
 		for {
 			select {
 			case <-c.quit:
@@ -119,74 +237,65 @@ func (c *Twitch) Run() {
 				}
 			default:
 			}
-			c.connLock.Lock()
-			err := c.conn.SetReadDeadline(time.Now().Add(SocketReadTimeout))
-			c.connLock.Unlock()
+			conn := c.getConn()
+			err := conn.SetReadDeadline(time.Now().Add(SocketReadTimeout))
 			if err != nil {
 				log.Printf("error setting the ReadDeadline: %v", err)
 				c.reconnect()
 				continue
 			}
 
-			c.connLock.Lock()
-			_, msg, err := c.conn.ReadMessage()
-			c.connLock.Unlock()
+			_, msg, err := conn.ReadMessage()
 			if err != nil {
+				if conn != c.getConn() {
+					// replaced by a graceful reconnect
+					continue
+				}
+				if atomic.LoadInt32(&c.switching) == 1 {
+					// twitch closed the connection before the new one was
+					// joined
+					c.switched.Wait()
+					if conn != c.getConn() {
+						continue
+					}
+				}
 				log.Printf("error reading message: %v", err)
 				c.reconnect()
 				continue
 			}
+			c.backoff.Reset()
 
-			if strings.Index(string(msg), "PING") == 0 {
-				err := c.send("PONG")
-				if err != nil {
-					log.Printf("error sending PONG: %v", err)
-					c.reconnect()
-				}
-				continue
-			}
-
-			s := c.SubPattern.FindAllStringSubmatch(string(msg), -1)
-			for _, v := range s {
-				data := strings.Replace(v[2], "\\s", " ", -1)
-				if v[4] != "" {
-					data += " [SubMessage]: " + v[4][2:]
+			for _, line := range strings.Split(string(msg), "\r\n") {
+				if line == "" {
+					continue
 				}
-				m := &Message{
-					Type:    "MSG",
-					Channel: v[3],
-					Nick:    "twitchnotify",
-					Data:    data,
-					Time:    time.Now().UTC(),
+				im, err := ParseIRCMessage(line)
+				if err != nil {
+					log.Printf("error parsing message %q: %v", line, err)
+					continue
 				}
-
-				select {
-				case <-pinger.C:
-					c.send("PING :tmi.twitch.tv")
-				case c.messages <- m:
-				default:
-					log.Println("error messages channel full :(")
+				switch im.Command {
+				case "PING":
+					if err := c.send("PONG :" + im.Trailing()); err != nil {
+						log.Printf("error sending PONG: %v", err)
+						c.drop()
+					}
+					continue
+				case "RECONNECT":
+					// twitch closes the connection shortly after, connect
+					// before that happens
+					log.Println("twitch requested a reconnect")
+					c.switchConn()
 				}
-			}
-
-			l := c.MessagePattern.FindAllStringSubmatch(string(msg), -1)
-			for _, v := range l {
-				data := strings.TrimSpace(v[3])
-				data = strings.Replace(data, "ACTION", "/me", -1)
-				data = strings.Replace(data, "", "", -1)
-				m := &Message{
-					Type:    "MSG",
-					Channel: v[2],
-					Nick:    v[1],
-					Data:    data,
-					Time:    time.Now().UTC(),
+				m := parseTwitchMessage(im)
+				if m == nil || c.seenMessage(im.Tags["id"]) {
+					continue
 				}
-
 				select {
-				case <-pinger.C:
-					c.send("PING :tmi.twitch.tv")
 				case c.messages <- m:
 				default:
+					atomic.AddUint64(&c.dropped, 1)
+					sourceDropped.Inc(c.Name())
 					log.Println("error messages channel full :(")
 				}
 			}
@@ -207,20 +316,53 @@ func (c *Twitch) Messages() <-chan *Message {
 	return c.messages
 }
 
+// Dropped number of messages dropped because the messages channel was full
+func (c *Twitch) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Status connection state
+func (c *Twitch) Status() []ConnStatus {
+	c.connLock.Lock()
+	connected := c.connected
+	c.connLock.Unlock()
+	c.lastMessageMu.RLock()
+	last := c.lastMessage
+	c.lastMessageMu.RUnlock()
+	c.ChLock.RLock()
+	channels := len(c.channels)
+	c.ChLock.RUnlock()
+	return []ConnStatus{{
+		Connected:   connected,
+		LastMessage: last,
+		Channels:    channels,
+	}}
+}
+
+// Name source name
+func (c *Twitch) Name() string { return "twitch" }
+
 // Message send a message to a channel
 func (c *Twitch) Message(ch, payload string) error {
 	return c.send(fmt.Sprintf("PRIVMSG #%s :%s", ch, payload))
 }
 
 func (c *Twitch) send(m string) error {
+	conn := c.getConn()
+	if conn == nil {
+		return errors.New("not connected")
+	}
+	return c.write(conn, m)
+}
+
+func (c *Twitch) write(conn *websocket.Conn, m string) error {
 	c.sendLock.Lock()
-	err := c.conn.SetWriteDeadline(time.Now().Add(SocketWriteTimeout))
-	c.sendLock.Unlock()
+	err := conn.SetWriteDeadline(time.Now().Add(SocketWriteTimeout))
 	if err != nil {
+		c.sendLock.Unlock()
 		return fmt.Errorf("error setting SetWriteDeadline %s", err)
 	}
-	c.sendLock.Lock()
-	err = c.conn.WriteMessage(websocket.TextMessage, []byte(m+"\r\n"))
+	err = conn.WriteMessage(websocket.TextMessage, []byte(m+"\r\n"))
 	c.sendLock.Unlock()
 	if err != nil {
 		return fmt.Errorf("error sending message %s", err)
@@ -234,7 +376,7 @@ func (c *Twitch) Join(ch string) error {
 	ch = strings.ToLower(ch)
 	err := c.send("JOIN #" + ch)
 	if err != nil {
-		c.reconnect()
+		c.drop()
 		return err
 	}
 	c.ChLock.Lock()
@@ -252,7 +394,7 @@ func (c *Twitch) Leave(ch string) error {
 	err := c.send("PART #" + ch)
 	if err != nil {
 		log.Printf("error leaving channel: %s", err)
-		c.reconnect()
+		c.drop()
 	}
 	return c.removeChannel(ch)
 }
@@ -280,7 +422,7 @@ func (c *Twitch) rejoinHandler() {
 			if time.Now().Sub(c.lastMessage).Minutes() > 2 {
 				c.lastMessageMu.RUnlock()
 				log.Println("twitch timeout triggered")
-				c.reconnect()
+				c.drop()
 				continue
 			}
 			c.lastMessageMu.RUnlock()
@@ -302,14 +444,76 @@ func (c *Twitch) rejoinHandler() {
 }
 
 // Stop stops the chats
-func (c *Twitch) Stop(wg *sync.WaitGroup) {
+func (c *Twitch) Stop() {
 	close(c.quit)
-	c.connLock.Lock()
-	if c.conn != nil {
-		c.conn.Close()
+	c.drop()
+}
+
+// parseTwitchMessage converts an irc message to a chat message, commands
+// that aren't logged return nil
+// > @badges=global_mod/1,turbo/1;color=#0D4200;display-name=dallas;emotes=25:0-4,12-16/1902:6-10;mod=0;room-id=1337;
+// subscriber=0;turbo=1;user-id=1337;user-type=global_mod :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #dallas :Kappa Keepo Kappa
+func parseTwitchMessage(im *IRCMessage) *Message {
+	m := &Message{
+		Channel: strings.TrimPrefix(im.Param(0), "#"),
+		Time:    time.Now().UTC(),
+		Tags:    im.Tags,
 	}
-	c.connLock.Unlock()
-	wg.Done()
+	switch im.Command {
+	case "PRIVMSG":
+		// bits are kept in the tags of regular messages
+		m.Type = "MSG"
+		m.Nick = im.Nick()
+		m.Data = strings.TrimSpace(im.Param(1))
+		if m.Data == "" {
+			return nil
+		}
+		if action, ok := ctcpAction(m.Data); ok {
+			m.Data = "/me " + action
+		}
+	case "USERNOTICE":
+		// > @badges=staff/1;msg-id=resub;msg-param-months=6;system-msg=ronni\shas\ssubscribed\sfor\s6\smonths!;
+		// login=ronni;user-id=1337 :tmi.twitch.tv USERNOTICE #dallas :Great stream -- keep it up!
+		m.Nick = "twitchnotify"
+		m.Data = im.Tags["system-msg"]
+		msgID := im.Tags["msg-id"]
+		if _, ok := twitchSubNotices[msgID]; ok {
+			m.Type = "MSG"
+			if text := strings.TrimSpace(im.Param(1)); text != "" {
+				m.Data += " [SubMessage]: " + text
+			}
+		} else if msgID == "raid" {
+			m.Type = "RAID"
+			m.Nick = im.Tags["login"]
+		} else {
+			m.Type = "USERNOTICE"
+		}
+	case "CLEARCHAT":
+		// > @ban-duration=600;room-id=1337;target-user-id=1338 :tmi.twitch.tv CLEARCHAT #dallas :ronni
+		// nick is empty when the whole chat was cleared
+		m.Type = "CLEARCHAT"
+		m.Nick = im.Param(1)
+		m.Data = im.Tags["ban-duration"]
+	case "CLEARMSG":
+		// > @login=ronni;target-msg-id=abc-123 :tmi.twitch.tv CLEARMSG #dallas :HeyGuys
+		m.Type = "CLEARMSG"
+		m.Nick = im.Tags["login"]
+		m.Data = im.Param(1)
+	case "ROOMSTATE":
+		m.Type = "ROOMSTATE"
+	case "NOTICE":
+		m.Type = "NOTICE"
+		m.Data = im.Param(1)
+	case "HOSTTARGET":
+		// > :tmi.twitch.tv HOSTTARGET #dallas :ronni 10
+		m.Type = "HOSTTARGET"
+		m.Data = im.Param(1)
+	case "RECONNECT":
+		m.Type = "RECONNECT"
+	default:
+		return nil
+	}
+	return m
 }
 
 func inSlice(s []string, v string) bool {
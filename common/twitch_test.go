@@ -0,0 +1,35 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTwitchSeenMessage(t *testing.T) {
+	c := NewTwitch()
+	if c.seenMessage("a") {
+		t.Error("expected no dedup outside of a reconnect")
+	}
+
+	c.seen = make(map[string]struct{})
+	c.switching = 1
+	for _, id := range []string{"a", "b", ""} {
+		if c.seenMessage(id) {
+			t.Errorf("expected %q read on the old connection to pass", id)
+		}
+	}
+
+	c.switching = 0
+	c.seenUntil = time.Now().Add(TwitchDedupWindow)
+	if !c.seenMessage("a") || !c.seenMessage("b") {
+		t.Error("expected messages read on both connections to be dropped")
+	}
+	if c.seenMessage("c") || c.seenMessage("") {
+		t.Error("expected new messages to pass")
+	}
+
+	c.seenUntil = time.Now().Add(-time.Second)
+	if c.seenMessage("a") || c.seen != nil {
+		t.Error("expected the seen ids to expire")
+	}
+}
@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/b-ggs/overrustlelogs/tool/avro"
+)
+
+// BigQuery uploads the logs of the day before the scheduled time
+func BigQuery(configPath, logsPath string) Func {
+	return func(t time.Time) error {
+		return UploadToBigQuery(configPath, logsPath, t.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+}
+
+// UploadToBigQuery loads the logs of every channel on date (2006-01-02) into
+// the month's table, configPath is the json writer and avro buffer config
+func UploadToBigQuery(configPath, logsPath, date string) error {
+	if logsPath == "" {
+		return fmt.Errorf("didn't provide a path to the logs")
+	}
+	if date == "" {
+		return fmt.Errorf("didn't provide a date load")
+	}
+
+	// parse bq config
+	var bigqueryWriterConfig common.BigQueryWriterConfig
+
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("error reading bigquery config file: %v", err)
+	}
+
+	err = json.Unmarshal(b, &bigqueryWriterConfig)
+	if err != nil {
+		return fmt.Errorf("error reading writer config: %v", err)
+	}
+
+	bufferConfig := struct {
+		RecordsPerBlock int64 `json:"recordsPerBlock"`
+		BytesPerFile    int   `json:"bytesPerFile"`
+	}{}
+	err = json.Unmarshal(b, &bufferConfig)
+	if err != nil {
+		return fmt.Errorf("error reading avro buffer config: %v", err)
+	}
+
+	// create bq client
+	tableDatestamp := strings.Replace(date, "-", "", -1)
+	bigqueryWriterConfig.TableID += "_" + tableDatestamp[0:6] + "01"
+	bq, err := common.NewBigQueryWriter(bigqueryWriterConfig)
+	if err != nil {
+		return fmt.Errorf("error creating bigquery writer: %v", err)
+	}
+
+	// upload log files
+	buffer, err := common.NewAvroBuffer(
+		avro.NewMessageWriter,
+		bq,
+		container.Snappy,
+		bufferConfig.RecordsPerBlock,
+		bufferConfig.BytesPerFile,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating buffer: %v", err)
+	}
+
+	// find log files
+	fileNamePattern := fmt.Sprintf("%s.txt.gz", date)
+	pathPattern := filepath.Join(logsPath, "*", "*", fileNamePattern)
+	files, err := filepath.Glob(pathPattern)
+	if err != nil || len(files) < 1 {
+		log.Println("couldn't find any log files for this date in", logsPath)
+		return err
+	}
+
+	for i, file := range files {
+		if err := loadLogFileIntoAvroBuffer(file, buffer); err != nil {
+			log.Println(err)
+		}
+		log.Printf("loaded %d/%d %s", i+1, len(files), file)
+	}
+
+	if err := buffer.Flush(); err != nil {
+		return fmt.Errorf("error flushing buffer to bigquery: %v", err)
+	}
+	return nil
+}
+
+func loadLogFileIntoAvroBuffer(file string, buffer *common.AvroBuffer) error {
+	channel, err := common.ExtractChannelFromPath(file)
+	if err != nil {
+		return err
+	}
+	r, err := common.OpenCompressedFile(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	lines := common.NewLineReader(r)
+	for {
+		b, err := lines.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		line := strings.TrimSuffix(string(b), "\n")
+		if len(line) == 0 {
+			continue
+		}
+
+		message, err := common.ParseMessageLine(line)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if err := buffer.WriteRecord(avro.NewMessageFromCommonMessage(channel, message)); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return nil
+}
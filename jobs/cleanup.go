@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CleanupMinAge files modified more recently may still be written by the
+// logger and are left for the next cleanup
+const CleanupMinAge = 24 * time.Hour
+
+// Cleanup compresses stale files, compress replaces path with its
+// compressed version
+func Cleanup(logsPath string, compress func(path string) error) Func {
+	return func(t time.Time) error {
+		return CleanupLogs(logsPath, compress)
+	}
+}
+
+// CleanupLogs compresses the uncompressed files in the month directories of
+// every channel except today's and those modified in the last CleanupMinAge
+func CleanupLogs(logsPath string, compress func(path string) error) error {
+	now := time.Now()
+
+	filepaths, err := filepath.Glob(filepath.Join(logsPath, "/*/*/*"))
+	if err != nil {
+		return fmt.Errorf("error getting filepaths: %v", err)
+	}
+	log.Printf("found %d files, starting cleanup...", len(filepaths))
+
+	var failed int
+	for _, fp := range filepaths {
+		if strings.HasSuffix(fp, ".gz") || strings.Contains(fp, now.Format("2006-01-02")) || hiddenPath(logsPath, fp) {
+			continue
+		}
+		fi, err := os.Stat(fp)
+		if err != nil || fi.IsDir() || now.Sub(fi.ModTime()) < CleanupMinAge {
+			continue
+		}
+		if err := compress(fp); err != nil {
+			log.Printf("error writing compressed file: %v", err)
+			failed++
+			continue
+		}
+		log.Println("compressed", fp)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed compressing %d files", failed)
+	}
+	return nil
+}
+
+// hiddenPath checks for dot files like the nick index under logsPath
+func hiddenPath(logsPath, path string) bool {
+	rel, err := filepath.Rel(logsPath, path)
+	if err != nil {
+		return false
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(name, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,321 @@
+// Package jobs runs the periodic maintenance of the logs, toplists, cleanup
+// and uploads, on a schedule and keeps a history of the runs so missed runs
+// are caught up after downtime
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+// defaults of unset scheduler settings, HistoryRuns runs are kept per job
+// and a failed run is tried RetryRuns times RetryDelay apart
+const (
+	DefaultHistoryPath = "/logger/jobs.json"
+	DefaultCatchUp     = 31
+	HistoryRuns        = 50
+	RetryRuns          = 3
+	RetryDelay         = 10 * time.Minute
+)
+
+// job metrics
+var (
+	jobRuns        = common.Metrics.Counter("orl_jobs_runs_total", "Scheduled job runs.", "job", "status")
+	jobLastSuccess = common.Metrics.Gauge("orl_jobs_last_success_timestamp_seconds", "Scheduled time of the last successful run of a job.", "job")
+)
+
+// Func runs a job for the period scheduled at t, t is in the past for runs
+// caught up after downtime
+type Func func(t time.Time) error
+
+// Schedule times a job runs at, every day or on the first of every month at
+// an offset from midnight UTC
+type Schedule struct {
+	Every string
+	At    time.Duration
+}
+
+// ParseSchedule parses every ("daily" or "monthly") and at ("15:04")
+func ParseSchedule(every, at string) (Schedule, error) {
+	s := Schedule{Every: every}
+	if every != "daily" && every != "monthly" {
+		return s, fmt.Errorf("invalid schedule %q, expected daily or monthly", every)
+	}
+	if at == "" {
+		return s, nil
+	}
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return s, fmt.Errorf("invalid schedule time %q %v", at, err)
+	}
+	s.At = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	return s, nil
+}
+
+func (s Schedule) String() string {
+	at := time.Time{}.Add(s.At).Format("15:04")
+	if s.Every == "monthly" {
+		return "monthly on the 1st at " + at + " UTC"
+	}
+	return "daily at " + at + " UTC"
+}
+
+// period start of the day or month holding t
+func (s Schedule) period(t time.Time, n int) time.Time {
+	t = t.UTC()
+	if s.Every == "monthly" {
+		return time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+n, 0, 0, 0, 0, time.UTC)
+}
+
+// Prev returns the last scheduled time at or before t
+func (s Schedule) Prev(t time.Time) time.Time {
+	p := s.period(t, 0).Add(s.At)
+	if p.After(t) {
+		p = s.period(t, -1).Add(s.At)
+	}
+	return p
+}
+
+// Next returns the first scheduled time after t
+func (s Schedule) Next(t time.Time) time.Time {
+	p := s.period(t, 0).Add(s.At)
+	if !p.After(t) {
+		p = s.period(t, 1).Add(s.At)
+	}
+	return p
+}
+
+// Run outcome of a job run, Skipped runs were recorded without running on
+// the job's first start
+type Run struct {
+	Scheduled time.Time `json:"scheduled"`
+	Started   time.Time `json:"started"`
+	Duration  float64   `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+	Skipped   bool      `json:"skipped,omitempty"`
+}
+
+// JobStatus schedule and recent runs of a job, newest first
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+	Running  bool      `json:"running"`
+	Runs     []Run     `json:"runs"`
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       Func
+}
+
+// Scheduler runs jobs when they're due, one at a time
+type Scheduler struct {
+	path    string
+	catchUp int
+	jobs    []*job
+
+	mu      sync.Mutex
+	runs    map[string][]Run
+	running string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewScheduler loads the run history at path, at most catchUp missed runs
+// of a job are caught up
+func NewScheduler(path string, catchUp int) (*Scheduler, error) {
+	s := &Scheduler{
+		path:    path,
+		catchUp: catchUp,
+		runs:    make(map[string][]Run),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.runs); err != nil {
+		return nil, fmt.Errorf("error decoding job history %s %v", path, err)
+	}
+	return s, nil
+}
+
+// Add schedules fn as name
+func (s *Scheduler) Add(name string, schedule Schedule, fn Func) {
+	s.jobs = append(s.jobs, &job{name, schedule, fn})
+}
+
+// Run checks for due jobs every minute until Stop is called
+func (s *Scheduler) Run() {
+	defer close(s.done)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		s.RunDue(time.Now())
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop stops Run once the running job returns
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// RunDue runs every run of the jobs scheduled since their last run up to
+// now, oldest first, after retrying the last run if it failed. Jobs without
+// history record their latest scheduled time as skipped, it likely ran
+// before the scheduler was set up, eg. from cron.
+func (s *Scheduler) RunDue(now time.Time) {
+	for _, j := range s.jobs {
+		s.mu.Lock()
+		first := len(s.runs[j.name]) == 0
+		s.mu.Unlock()
+		if first {
+			t := j.schedule.Prev(now)
+			log.Printf("skipping %s scheduled at %s on its first start", j.name, t.Format(time.RFC3339))
+			s.record(j, Run{Scheduled: t, Started: now.UTC(), Skipped: true})
+			continue
+		}
+		for _, t := range s.missed(j, now) {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			s.run(j, t)
+		}
+	}
+}
+
+// missed scheduled times of j up to now that haven't run, led by the last
+// run if it failed and is due a retry
+func (s *Scheduler) missed(j *job, now time.Time) []time.Time {
+	s.mu.Lock()
+	runs := s.runs[j.name]
+	s.mu.Unlock()
+
+	last := j.schedule.Prev(now)
+	if len(runs) == 0 {
+		return nil
+	}
+	var times []time.Time
+	for t := j.schedule.Next(runs[0].Scheduled); !t.After(last); t = j.schedule.Next(t) {
+		times = append(times, t)
+	}
+	if len(times) > s.catchUp {
+		log.Printf("skipping %d missed runs of %s", len(times)-s.catchUp, j.name)
+		times = times[len(times)-s.catchUp:]
+	}
+	if retry(runs, now) {
+		times = append([]time.Time{runs[0].Scheduled}, times...)
+	}
+	return times
+}
+
+// retry whether the last run failed and is due another try
+func retry(runs []Run, now time.Time) bool {
+	last := runs[0]
+	if last.Error == "" || now.Sub(last.Started) < RetryDelay {
+		return false
+	}
+	tries := 0
+	for _, r := range runs {
+		if r.Error == "" || !r.Scheduled.Equal(last.Scheduled) {
+			break
+		}
+		tries++
+	}
+	return tries < RetryRuns
+}
+
+func (s *Scheduler) run(j *job, t time.Time) {
+	s.mu.Lock()
+	s.running = j.name
+	s.mu.Unlock()
+
+	log.Printf("running %s scheduled at %s", j.name, t.Format(time.RFC3339))
+	r := Run{Scheduled: t, Started: time.Now().UTC()}
+	err := j.fn(t)
+	r.Duration = time.Since(r.Started).Seconds()
+	if err != nil {
+		r.Error = err.Error()
+		jobRuns.Inc(j.name, "error")
+		log.Printf("error running %s %s", j.name, err)
+	} else {
+		jobRuns.Inc(j.name, "ok")
+		jobLastSuccess.Set(float64(t.Unix()), j.name)
+		log.Printf("finished %s in %.1fs", j.name, r.Duration)
+	}
+	s.record(j, r)
+}
+
+// record adds r to the history of j and saves it
+func (s *Scheduler) record(j *job, r Run) {
+	s.mu.Lock()
+	s.running = ""
+	runs := append([]Run{r}, s.runs[j.name]...)
+	if len(runs) > HistoryRuns {
+		runs = runs[:HistoryRuns]
+	}
+	s.runs[j.name] = runs
+	err := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("error saving job history %s", err)
+	}
+}
+
+// save writes the history, s.mu must be held
+func (s *Scheduler) save() error {
+	data, err := json.MarshalIndent(s.runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.path+".writing", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".writing", s.path)
+}
+
+// Status schedule and recent runs of every job sorted by name
+func (s *Scheduler) Status() []JobStatus {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status = append(status, JobStatus{
+			Name:     j.name,
+			Schedule: j.schedule.String(),
+			Next:     j.schedule.Next(now),
+			Running:  s.running == j.name,
+			Runs:     append([]Run(nil), s.runs[j.name]...),
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return strings.ToLower(status[i].Name) < strings.ToLower(status[j].Name)
+	})
+	return status
+}
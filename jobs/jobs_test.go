@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	daily, err := ParseSchedule("daily", "02:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monthly, err := ParseSchedule("monthly", "01:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseSchedule("weekly", ""); err == nil {
+		t.Error("weekly schedule parsed")
+	}
+
+	now := time.Date(2020, 3, 1, 2, 0, 0, 0, time.UTC)
+	cases := []struct {
+		got, want time.Time
+	}{
+		{daily.Prev(now), time.Date(2020, 2, 29, 2, 30, 0, 0, time.UTC)},
+		{daily.Next(now), time.Date(2020, 3, 1, 2, 30, 0, 0, time.UTC)},
+		{daily.Prev(daily.Next(now)), daily.Next(now)},
+		{monthly.Prev(now), time.Date(2020, 3, 1, 1, 0, 0, 0, time.UTC)},
+		{monthly.Next(now), time.Date(2020, 4, 1, 1, 0, 0, 0, time.UTC)},
+		{monthly.Prev(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), time.Date(2019, 12, 1, 1, 0, 0, 0, time.UTC)},
+	}
+	for i, c := range cases {
+		if !c.got.Equal(c.want) {
+			t.Errorf("case %d = %s, want %s", i, c.got, c.want)
+		}
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jobs.json")
+
+	var ran []time.Time
+	fn := func(t time.Time) error {
+		ran = append(ran, t)
+		if len(ran) == 1 {
+			return errors.New("first run fails")
+		}
+		return nil
+	}
+	daily, _ := ParseSchedule("daily", "00:30")
+	newScheduler := func() *Scheduler {
+		s, err := NewScheduler(path, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Add("cleanup", daily, fn)
+		return s
+	}
+
+	// without history the latest run is recorded as skipped
+	start := time.Now().UTC()
+	day := func(n int) time.Time { return daily.Prev(start.AddDate(0, 0, n)) }
+	s := newScheduler()
+	s.RunDue(start)
+	if len(ran) != 0 {
+		t.Fatalf("first runs = %v", ran)
+	}
+	if runs := s.Status()[0].Runs; len(runs) != 1 || !runs[0].Skipped || !runs[0].Scheduled.Equal(day(0)) {
+		t.Fatalf("first start runs = %+v", runs)
+	}
+
+	// the next run fails
+	s = newScheduler()
+	s.RunDue(day(1))
+	if len(ran) != 1 || !ran[0].Equal(day(1)) {
+		t.Fatalf("failed runs = %v", ran)
+	}
+
+	// five days of downtime retry the failed run and catch up the two most
+	// recent runs
+	s = newScheduler()
+	s.RunDue(day(6))
+	if len(ran) != 4 || !ran[1].Equal(day(1)) || !ran[2].Equal(day(5)) || !ran[3].Equal(day(6)) {
+		t.Fatalf("caught up runs = %v", ran)
+	}
+	s.RunDue(day(6))
+	if len(ran) != 4 {
+		t.Errorf("runs repeated = %v", ran)
+	}
+
+	status := s.Status()
+	if len(status) != 1 || len(status[0].Runs) != 5 {
+		t.Fatalf("status = %+v", status)
+	}
+	if runs := status[0].Runs; runs[0].Error != "" || runs[3].Error != "first run fails" || !runs[4].Skipped {
+		t.Errorf("runs = %+v", runs)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	failed := func(day int, started time.Time) Run {
+		return Run{Scheduled: time.Date(2020, 3, day, 0, 30, 0, 0, time.UTC), Started: started, Error: "failed"}
+	}
+	old := now.Add(-time.Hour)
+	tests := []struct {
+		runs  []Run
+		retry bool
+	}{
+		{[]Run{{Scheduled: old, Started: old}}, false},
+		{[]Run{failed(10, old)}, true},
+		{[]Run{failed(10, now.Add(-time.Minute))}, false},
+		{[]Run{failed(10, old), failed(10, old)}, true},
+		{[]Run{failed(10, old), failed(10, old), failed(10, old)}, false},
+		{[]Run{failed(10, old), failed(9, old), failed(8, old)}, true},
+	}
+	for i, test := range tests {
+		if r := retry(test.runs, now); r != test.retry {
+			t.Errorf("%d: retry = %v, expected %v", i, r, test.retry)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+// Stats recounts the day stats of the month before the scheduled time
+func Stats(logsPath, emotesPath string) Func {
+	return func(t time.Time) error {
+		return CreateStats(logsPath, emotesPath, t.AddDate(0, 0, -t.Day()).Format("January 2006"))
+	}
+}
+
+// CreateStats recounts the compressed day logs of month in every channel and
+// writes their day stats and emote uses, month may be a glob pattern. The
+// emote registries are read from emotesPath.
+func CreateStats(logsPath, emotesPath, month string) error {
+	filepaths, err := filepath.Glob(filepath.Join(logsPath, "/*", month))
+	if err != nil {
+		return fmt.Errorf("error getting filepaths: %v", err)
+	}
+
+	var failed int
+	for _, mpath := range filepaths {
+		log.Printf("creating stats for %s", mpath)
+		if err := createMonthStats(mpath, emotesPath); err != nil {
+			log.Printf("error creating stats for %s %v", mpath, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed creating stats of %d of %d months", failed, len(filepaths))
+	}
+	return nil
+}
+
+func createMonthStats(mpath, emotesPath string) error {
+	files, err := ioutil.ReadDir(mpath)
+	if err != nil {
+		return fmt.Errorf("error reading folder: %v", err)
+	}
+	channel := strings.TrimSuffix(filepath.Base(filepath.Dir(mpath)), " chatlog")
+	emotes, err := common.LoadEmoteRegistry(emotesPath, channel)
+	if err != nil {
+		return fmt.Errorf("error loading emotes: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".txt.gz") {
+			continue
+		}
+		path := filepath.Join(mpath, file.Name())
+		c, err := common.BuildDayStats(path, emotes)
+		if err != nil {
+			log.Printf("error reading %s %v", file.Name(), err)
+			continue
+		}
+		if err := common.WriteDayStats(path, c.Stats()); err != nil {
+			return fmt.Errorf("error writing stats file: %v", err)
+		}
+		if err := common.WriteDayEmotes(path, c.Emotes()); err != nil {
+			return fmt.Errorf("error writing emotes file: %v", err)
+		}
+	}
+	return nil
+}
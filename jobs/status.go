@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+var statusTemplate = template.Must(template.New("jobs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>jobs</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+{{range .}}
+<h2>{{.Name}}{{if .Running}} (running){{end}}</h2>
+<p>{{.Schedule}}, next run {{.Next.Format "2006-01-02 15:04 MST"}}</p>
+<table>
+<tr><th>Scheduled</th><th>Started</th><th>Duration</th><th>Status</th></tr>
+{{range .Runs}}
+<tr>
+<td>{{.Scheduled.Format "2006-01-02 15:04 MST"}}</td>
+<td>{{.Started.Format "2006-01-02 15:04:05 MST"}}</td>
+<td>{{printf "%.1fs" .Duration}}</td>
+{{if .Error}}<td class="error">{{.Error}}</td>{{else if .Skipped}}<td>skipped</td>{{else}}<td>ok</td>{{end}}
+</tr>
+{{else}}
+<tr><td colspan="4">never ran</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>no jobs scheduled</p>
+{{end}}
+</body>
+</html>
+`))
+
+// StatusHandler serves the schedule and recent runs of the jobs, as json if
+// the format query parameter is json
+func (s *Scheduler) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := s.Status()
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(status)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusTemplate.Execute(w, status); err != nil {
+			log.Printf("error executing jobs template %s", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+// TopList creates the toplists of the month before the scheduled time
+func TopList(logsPath string) Func {
+	return func(t time.Time) error {
+		return CreateTopList(logsPath, t.AddDate(0, 0, -t.Day()).Format("January 2006"))
+	}
+}
+
+// CreateTopList recounts the compressed day logs of month in every channel
+// and writes their toplist counters and the month's toplist
+func CreateTopList(logsPath, month string) error {
+	filepaths, err := filepath.Glob(filepath.Join(logsPath, "/*", month))
+	if err != nil {
+		return fmt.Errorf("error getting filepaths: %v", err)
+	}
+
+	var failed int
+	for _, mpath := range filepaths {
+		log.Printf("creating toplist for %s", mpath)
+		if err := createMonthTopList(mpath); err != nil {
+			log.Printf("error creating toplist for %s %v", mpath, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed creating %d of %d toplists", failed, len(filepaths))
+	}
+	return nil
+}
+
+func createMonthTopList(mpath string) error {
+	files, err := ioutil.ReadDir(mpath)
+	if err != nil {
+		return fmt.Errorf("error reading folder: %v", err)
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".txt.gz") {
+			continue
+		}
+		path := filepath.Join(mpath, file.Name())
+		r, err := common.OpenCompressedFile(path)
+		if err != nil {
+			log.Printf("error: %v reading file %s", err, file.Name())
+			continue
+		}
+		days, err := common.CountNickDays(r, file.Name()[:len(file.Name())-len(".txt.gz")])
+		r.Close()
+		if err != nil {
+			log.Printf("error reading %s %v", file.Name(), err)
+			continue
+		}
+		if err := common.WriteDayTopList(path, days); err != nil {
+			return fmt.Errorf("error writing day toplist file: %v", err)
+		}
+	}
+
+	users, err := SumDayTopLists(mpath)
+	if err != nil {
+		return err
+	}
+	if err := common.WriteTopList(filepath.Join(mpath, common.TopListFile), common.NewTopList(users)); err != nil {
+		return fmt.Errorf("error writing toplist file: %v", err)
+	}
+	return nil
+}
+
+// SumDayTopLists adds up the toplist counters of the days of the month
+// directory mpath
+func SumDayTopLists(mpath string) (map[string]*common.NickDay, error) {
+	paths, err := filepath.Glob(filepath.Join(mpath, "*"+common.DayTopListExtension+".gz"))
+	if err != nil {
+		return nil, err
+	}
+	users := map[string]*common.NickDay{}
+	for _, path := range paths {
+		days, err := common.ReadDayTopList(path)
+		if err != nil {
+			return nil, err
+		}
+		common.AddNickDays(users, days)
+	}
+	return users, nil
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+func TestCreateTopList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mpath := filepath.Join(dir, "Foo chatlog", "March 2020")
+	if err := os.MkdirAll(mpath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	days := map[string]string{
+		"2020-03-01": "[2020-03-01 10:00:00 UTC] Bob: hello\n[2020-03-01 10:00:01 UTC] Alice: hi\n",
+		"2020-03-02": "[2020-03-02 08:00:00 UTC] Bob: again\n",
+	}
+	for date, data := range days {
+		if _, err := common.WriteCompressedFile(filepath.Join(mpath, date+".txt"), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// counters of a day the logger still has open
+	open := map[string]*common.NickDay{"Carl": {Date: "2020-03-03", Lines: 1, Bytes: 4, First: 1583193600, Last: 1583193600}}
+	if err := common.WriteDayTopList(filepath.Join(mpath, "2020-03-03.txt"), open); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CreateTopList(dir, "March 2020"); err != nil {
+		t.Fatal(err)
+	}
+	if day, err := common.ReadDayTopList(filepath.Join(mpath, "2020-03-02.txt")); err != nil || day["Bob"] == nil || day["Bob"].Lines != 1 {
+		t.Errorf("day toplist = %+v %v", day, err)
+	}
+
+	t1, err := common.ReadTopList(filepath.Join(mpath, common.TopListFile+".gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toplist := t1.Users
+	if len(toplist) != 3 || toplist[0].Username != "Bob" || toplist[0].Lines != 2 || toplist[0].Seen != 1583136000 || toplist[2].Username != "Carl" {
+		t.Errorf("toplist = %+v", toplist)
+	}
+}
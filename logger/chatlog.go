@@ -1,9 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,8 +20,16 @@ import (
 type ChatLog struct {
 	sync.Mutex
 	f        *os.File
+	records  *os.File
 	nicks    common.NickList
+	days     map[string]*common.NickDay
+	dirty    map[string]struct{}
+	counted  map[string]*common.NickDay
+	month    *monthTopList
+	stats    *common.DayStatsCounter
+	index    *common.SearchIndex
 	modified time.Time
+	closed   bool
 }
 
 // NewChatLog instantiates chat logs...
@@ -39,44 +50,229 @@ func NewChatLog(path string) (*ChatLog, error) {
 		return nil, err
 	}
 
+	if _, err := common.UncompressFile(recordPath(path)); !os.IsNotExist(err) && err != nil {
+		log.Printf("error reading records %s %s", path, err)
+	}
+	records, err := os.OpenFile(recordPath(path), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
 	nicks := common.NickList{}
 	common.ReadNickList(nicks, nickPath(path))
 
+	emotes, err := common.LoadEmoteRegistry(common.GetConfig().EmotesPath, channelName(path))
+	if err != nil {
+		log.Printf("error loading emotes of log %s %s", path, err)
+	}
+	index, days, stats, err := scanLog(path, emotes)
+	if err != nil {
+		log.Printf("error reading log %s %s", path, err)
+	}
+	dirty := make(map[string]struct{}, len(days))
+	for nick := range days {
+		dirty[nick] = struct{}{}
+	}
+	counted, err := common.ReadDayTopList(path)
+	if err != nil {
+		log.Printf("error reading toplist of log %s %s", path, err)
+		counted = map[string]*common.NickDay{}
+	}
+
 	return &ChatLog{
 		f:        f,
+		records:  records,
 		nicks:    nicks,
+		days:     days,
+		dirty:    dirty,
+		counted:  counted,
+		month:    topLists.Open(dir),
+		stats:    stats,
+		index:    index,
 		modified: time.Now(),
 	}, nil
 }
 
-// WriteNicks persist nick list
+// scanLog counts the nicks and stats of the lines already present in the log,
+// so the nick index, toplist and stats survive restarts, and indexes the
+// lines past the end of its persisted search index, keeping line numbers
+// aligned with the file. The log is read once.
+func scanLog(path string, emotes common.EmoteRegistry) (*common.SearchIndex, map[string]*common.NickDay, *common.DayStatsCounter, error) {
+	date := logDate(path)
+	index := common.NewSearchIndex()
+	days := map[string]*common.NickDay{}
+	stats := common.NewDayStatsCounter(date, emotes)
+	f, err := os.Open(path)
+	if err != nil {
+		return index, days, stats, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return index, days, stats, err
+	}
+	if i, err := common.ReadSearchIndex(indexPath(path)); err == nil && i.Size() >= 0 && i.Size() <= fi.Size() {
+		index = i
+	}
+
+	var offset int64
+	lines := common.NewLineReader(f)
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return index, days, stats, err
+		}
+		if offset >= index.Size() {
+			index.AddLine(string(line))
+		}
+		offset += int64(len(line))
+		m, err := common.ParseMessageLine(strings.TrimSuffix(string(line), "\n"))
+		if err != nil {
+			continue
+		}
+		d, ok := days[m.Nick]
+		if !ok {
+			d = &common.NickDay{Date: date}
+			days[m.Nick] = d
+		}
+		d.Count(m)
+		stats.AddLine(m)
+	}
+
+	records, err := os.Open(recordPath(path))
+	if err != nil {
+		return index, days, stats, nil
+	}
+	defer records.Close()
+	return index, days, stats, stats.AddRecords(records)
+}
+
+// WriteNicks persist nick list, the day stats and emote uses and the stats
+// of the nicks that spoke since the last write to the channel's nick index
+// and the month's toplist
 func (l *ChatLog) WriteNicks() {
 	l.Lock()
 	if err := l.nicks.WriteTo(nickPath(l.f.Name())); err != nil {
 		log.Printf("error writing nicks for %s %s", l.f.Name(), err)
 	}
+	days := make(map[string]common.NickDay, len(l.dirty))
+	dirty := make(map[string]struct{}, len(l.dirty))
+	for nick := range l.dirty {
+		days[nick] = *l.days[nick]
+		dirty[strings.ToLower(nick)] = struct{}{}
+	}
+	l.dirty = make(map[string]struct{})
+	// the nick index holds the day of every case variant of a dirty nick
+	indexed := make(map[string]common.NickDay, len(days))
+	if len(days) > 0 {
+		for nick, d := range common.MergeNickCases(l.days) {
+			if _, ok := dirty[strings.ToLower(nick)]; ok {
+				indexed[nick] = d
+			}
+		}
+	}
+	name := l.f.Name()
+	if len(days) > 0 {
+		if err := common.WriteDayTopList(name, l.days); err != nil {
+			log.Printf("error writing toplist for %s %s", name, err)
+		}
+		l.month.Update(l.counted, days)
+		if err := common.WriteDayStats(name, l.stats.Stats()); err != nil {
+			log.Printf("error writing stats for %s %s", name, err)
+		}
+		if err := common.WriteDayEmotes(name, l.stats.Emotes()); err != nil {
+			log.Printf("error writing emotes for %s %s", name, err)
+		}
+	}
+	l.Unlock()
+
+	if len(days) == 0 {
+		return
+	}
+	if err := common.NewNickIndex(channelPath(name)).Update(indexed); err != nil {
+		log.Printf("error updating nick index for %s %s", name, err)
+	}
+}
+
+// WriteIndex persist search index
+func (l *ChatLog) WriteIndex() {
+	l.Lock()
+	if err := l.index.WriteTo(indexPath(l.f.Name())); err != nil {
+		log.Printf("error writing search index for %s %s", l.f.Name(), err)
+	}
 	l.Unlock()
 }
 
-// Close release file handle
+// Close release file handle, the index is written once the log is compressed
+// so the server can tell it covers the whole day. Only the first call closes
+// the log.
 func (l *ChatLog) Close() {
+	l.Lock()
+	closed := l.closed
+	l.closed = true
+	l.Unlock()
+	if closed {
+		return
+	}
 	l.WriteNicks()
 	l.Lock()
 	l.f.Close()
-	if _, err := common.CompressFile(l.f.Name()); !os.IsNotExist(err) && err != nil {
+	if err := compressLog(l.f.Name()); !os.IsNotExist(err) && err != nil {
+		compressionFailures.Inc()
 		log.Printf("error compressing log %s %s", l.f.Name(), err)
 	}
+	l.records.Close()
+	if _, err := common.CompressFile(l.records.Name()); !os.IsNotExist(err) && err != nil {
+		compressionFailures.Inc()
+		log.Printf("error compressing records %s %s", l.records.Name(), err)
+	}
 	l.Unlock()
+	l.WriteIndex()
+	topLists.Release(l.month)
 }
 
-func (l *ChatLog) Write(timestamp time.Time, nick string, message string) {
+// Write appends the message to the log and its structured record to the
+// records file
+func (l *ChatLog) Write(m *common.Message) {
+	record, err := json.Marshal(common.NewRecord(m))
+	if err != nil {
+		log.Printf("error encoding record for %s %s", l.f.Name(), err)
+	}
 	l.Lock()
-	l.nicks.Add(nick)
-	l.f.WriteString(timestamp.Format("[2006-01-02 15:04:05 MST] ") + nick + ": " + message + "\n")
+	l.nicks.Add(m.Nick)
+	d, ok := l.days[m.Nick]
+	if !ok {
+		d = &common.NickDay{Date: logDate(l.f.Name())}
+		l.days[m.Nick] = d
+	}
+	d.Count(m)
+	l.dirty[m.Nick] = struct{}{}
+	l.stats.Add(m)
+	line := m.Time.Format("[2006-01-02 15:04:05 MST] ") + m.Nick + ": " + m.Data + "\n"
+	l.index.AddLine(line)
+	l.f.WriteString(line)
+	if record != nil {
+		l.records.Write(append(record, '\n'))
+	}
 	l.modified = time.Now()
 	l.Unlock()
 }
 
+// Sync flushes the log and records to disk
+func (l *ChatLog) Sync() {
+	l.Lock()
+	if err := l.f.Sync(); err != nil {
+		log.Printf("error syncing log %s %s", l.f.Name(), err)
+	}
+	if err := l.records.Sync(); err != nil {
+		log.Printf("error syncing records %s %s", l.records.Name(), err)
+	}
+	l.Unlock()
+}
+
 // Modified returns last modified time
 func (l *ChatLog) Modified() time.Time {
 	l.Lock()
@@ -84,11 +280,47 @@ func (l *ChatLog) Modified() time.Time {
 	return l.modified
 }
 
+// compressLog compresses a finished day log, into hourly frames if seekable
+// logs are enabled
+func compressLog(path string) error {
+	if c := common.GetConfig().Logger; c.SeekableLogs {
+		return common.CompressFileSeekable(path, c.FrameLines)
+	}
+	_, err := common.CompressFile(path)
+	return err
+}
+
+// logDate date of a day log eg. "2006-01-02"
+func logDate(path string) string {
+	name := filepath.Base(path)
+	return name[:len(name)-len(filepath.Ext(name))]
+}
+
+// channelPath channel directory of a day log
+func channelPath(path string) string {
+	return filepath.Dir(filepath.Dir(path))
+}
+
+// channelName channel of a day log eg. "Destinygg"
+func channelName(path string) string {
+	return strings.TrimSuffix(filepath.Base(channelPath(path)), " chatlog")
+}
+
 func nickPath(path string) string {
 	ext := filepath.Ext(path)
 	return path[:len(path)-len(ext)] + ".nicks"
 }
 
+func recordPath(path string) string {
+	ext := filepath.Ext(path)
+	return path[:len(path)-len(ext)] + ".jsonl"
+}
+
+func indexPath(path string) string {
+	ext := filepath.Ext(path)
+	return path[:len(path)-len(ext)] + ".index"
+}
+
 // ChatLogs chat log collection
 type ChatLogs struct {
 	logs *lru.Cache
@@ -110,16 +342,24 @@ func (l *ChatLogs) housekeeping() {
 	const interval = 2 * time.Minute
 	tick := time.NewTicker(interval)
 	for now := range tick.C {
-		for _, k := range l.logs.Keys() {
-			if v, ok := l.logs.Peek(k); ok {
-				c := v.(*ChatLog)
-				idle := now.Sub(c.Modified())
-				if idle > time.Hour {
-					l.logs.Remove(k)
-					c.Close()
-				} else if idle < interval {
-					c.WriteNicks()
-				}
+		l.tidy(now, interval)
+		topLists.Write()
+	}
+}
+
+// tidy closes the logs idle for an hour and persists the ones written to
+// within interval of now
+func (l *ChatLogs) tidy(now time.Time, interval time.Duration) {
+	for _, k := range l.logs.Keys() {
+		if v, ok := l.logs.Peek(k); ok {
+			c := v.(*ChatLog)
+			idle := now.Sub(c.Modified())
+			if idle > time.Hour {
+				// closed by HandleEvict
+				l.logs.Remove(k)
+			} else if idle < interval {
+				c.WriteNicks()
+				c.WriteIndex()
 			}
 		}
 	}
@@ -143,12 +383,24 @@ func (l *ChatLogs) Get(path string) (*ChatLog, error) {
 	return chatLog, nil
 }
 
-// Close close all open chat logs
-func (l *ChatLogs) Close() {
+// Sync flushes all open chat logs to disk, evicted logs are flushed when
+// they're closed
+func (l *ChatLogs) Sync() {
 	for _, k := range l.logs.Keys() {
-		if v, ok := l.logs.Get(k); ok {
-			l.logs.Remove(k)
-			v.(*ChatLog).Close()
+		if v, ok := l.logs.Peek(k); ok {
+			v.(*ChatLog).Sync()
 		}
 	}
 }
+
+// Len number of open chat logs
+func (l *ChatLogs) Len() int {
+	return l.logs.Len()
+}
+
+// Close close all open chat logs, HandleEvict closes each removed log
+func (l *ChatLogs) Close() {
+	for _, k := range l.logs.Keys() {
+		l.logs.Remove(k)
+	}
+}
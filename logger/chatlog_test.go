@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+func TestChatLogsEvictKeepsMonthTopList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chatlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(config, []byte("maxOpenLogs = 8\nemotesPath = \""+filepath.Join(dir, "emotes")+"\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	common.SetupConfig(config)
+
+	month := filepath.Join(dir, "Foo chatlog", "March 2020")
+	logs := NewChatLogs()
+	yesterday, err := logs.Get(filepath.Join(month, "2020-03-01.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	today, err := logs.Get(filepath.Join(month, "2020-03-02.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	yesterday.Write(&common.Message{Nick: "Bob", Data: "hi", Time: time.Date(2020, 3, 1, 23, 59, 0, 0, time.UTC)})
+	today.Write(&common.Message{Nick: "Bob", Data: "hello", Time: time.Date(2020, 3, 2, 0, 1, 0, 0, time.UTC)})
+
+	yesterday.Lock()
+	yesterday.modified = time.Now().Add(-2 * time.Hour)
+	yesterday.Unlock()
+	logs.tidy(time.Now(), 2*time.Minute)
+	if logs.Len() != 1 {
+		t.Fatalf("expected the idle log to be closed, %d open", logs.Len())
+	}
+	topLists.mu.Lock()
+	m, ok := topLists.months[month]
+	topLists.mu.Unlock()
+	if !ok || m.refs != 1 || m != today.month {
+		t.Fatalf("expected the month toplist to stay open for today's log, %+v", m)
+	}
+
+	today.Write(&common.Message{Nick: "Bob", Data: "bye", Time: time.Date(2020, 3, 2, 0, 2, 0, 0, time.UTC)})
+	today.WriteNicks()
+	topLists.Write()
+	list, err := common.ReadTopList(filepath.Join(month, common.TopListFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Users) != 1 || list.Users[0].Lines != 3 {
+		t.Errorf("toplist = %+v", list.Users)
+	}
+
+	logs.Close()
+	logs.Close()
+	today.Close()
+	topLists.mu.Lock()
+	defer topLists.mu.Unlock()
+	if len(topLists.months) != 0 || m.refs != 0 {
+		t.Errorf("expected the month toplist to be released once, refs %d", m.refs)
+	}
+}
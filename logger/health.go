@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+// activity last message times of every channel
+var activity = &channelActivity{seen: make(map[string]map[string]time.Time)}
+
+// channelActivity tracks the last message time per source and channel
+type channelActivity struct {
+	mu   sync.RWMutex
+	seen map[string]map[string]time.Time
+}
+
+// Seen records a message in channel
+func (a *channelActivity) Seen(source, channel string) {
+	a.mu.Lock()
+	channels, ok := a.seen[source]
+	if !ok {
+		channels = make(map[string]time.Time)
+		a.seen[source] = channels
+	}
+	channels[channel] = time.Now()
+	a.mu.Unlock()
+}
+
+// Ages seconds since the last message per channel of source
+func (a *channelActivity) Ages(source string, now time.Time) map[string]float64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	ages := make(map[string]float64, len(a.seen[source]))
+	for ch, t := range a.seen[source] {
+		ages[ch] = now.Sub(t).Seconds()
+	}
+	return ages
+}
+
+type (
+	healthReport struct {
+		Status  string         `json:"status"`
+		Logs    logsHealth     `json:"logs"`
+		Sources []sourceHealth `json:"sources"`
+	}
+	logsHealth struct {
+		Path     string `json:"path"`
+		Writable bool   `json:"writable"`
+		Error    string `json:"error,omitempty"`
+	}
+	sourceHealth struct {
+		Name           string             `json:"name"`
+		Ready          bool               `json:"ready"`
+		Connections    []connHealth       `json:"connections"`
+		LastMessageAge map[string]float64 `json:"lastMessageAge"`
+	}
+	connHealth struct {
+		Connected      bool    `json:"connected"`
+		LastMessageAge float64 `json:"lastMessageAge"`
+		Channels       int     `json:"channels"`
+	}
+)
+
+// newHealthReport checks the logs volume and collects the source status
+func newHealthReport(sources []common.ChatSource) *healthReport {
+	now := time.Now()
+	report := &healthReport{
+		Status: "ok",
+		Logs:   logsHealth{Path: LogsPath, Writable: true},
+	}
+	if err := checkWritable(LogsPath); err != nil {
+		report.Status = "fail"
+		report.Logs.Writable = false
+		report.Logs.Error = err.Error()
+	}
+	for _, source := range sources {
+		sh := sourceHealth{
+			Name:           source.Name(),
+			Ready:          true,
+			Connections:    []connHealth{},
+			LastMessageAge: activity.Ages(source.Name(), now),
+		}
+		for _, s := range source.Status() {
+			sh.Ready = sh.Ready && s.Connected
+			sh.Connections = append(sh.Connections, connHealth{
+				Connected:      s.Connected,
+				LastMessageAge: now.Sub(s.LastMessage).Seconds(),
+				Channels:       s.Channels,
+			})
+		}
+		report.Sources = append(report.Sources, sh)
+	}
+	return report
+}
+
+// ready whether the logs are writable and every connection is up
+func (r *healthReport) ready() bool {
+	if !r.Logs.Writable {
+		return false
+	}
+	for _, s := range r.Sources {
+		if !s.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".healthz")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// healthHandler reports the status, failing only when logs can't be written
+func healthHandler(sources []common.ChatSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := newHealthReport(sources)
+		status := http.StatusOK
+		if !report.Logs.Writable {
+			status = http.StatusServiceUnavailable
+		}
+		serveHealth(w, report, status)
+	}
+}
+
+// readyHandler reports the status, failing while any connection is down
+func readyHandler(sources []common.ChatSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := newHealthReport(sources)
+		status := http.StatusOK
+		if !report.ready() {
+			report.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+		serveHealth(w, report, status)
+	}
+}
+
+func serveHealth(w http.ResponseWriter, report *healthReport, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
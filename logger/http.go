@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/b-ggs/overrustlelogs/jobs"
+)
+
+// logger metrics
+var (
+	messagesReceived    = common.Metrics.Counter("orl_logger_messages_received_total", "Messages received from chat sources.", "source", "channel")
+	compressionFailures = common.Metrics.Counter("orl_logger_compression_failures_total", "Logs that failed to compress when closed.")
+)
+
+func registerSourceMetrics(source common.ChatSource, logs *ChatLogs, journal *common.Journal) {
+	labels := common.Labels{"source": source.Name()}
+	common.Metrics.GaugeFunc("orl_logger_open_logs", "Chat logs open in the cache.", labels, func() float64 {
+		return float64(logs.Len())
+	})
+	common.Metrics.CounterFunc("orl_logger_journal_failures_total", "Messages that couldn't be journaled.", labels, func() float64 {
+		return float64(journal.Failed())
+	})
+	common.Metrics.GaugeFunc("orl_logger_journal_pending_bytes", "Journaled bytes not committed to the logs yet.", labels, func() float64 {
+		return float64(journal.Pending())
+	})
+}
+
+// serveHTTP serves the metrics and health endpoints and the job status page
+// if jobs are scheduled
+func serveHTTP(addr string, sources []common.ChatSource, scheduler *jobs.Scheduler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", common.Metrics.Handler())
+	mux.Handle("/healthz", healthHandler(sources))
+	mux.Handle("/readyz", readyHandler(sources))
+	if scheduler != nil {
+		mux.Handle("/jobs", scheduler.StatusHandler())
+	}
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("error serving http %s", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/b-ggs/overrustlelogs/jobs"
+)
+
+// newScheduler schedules the configured jobs, named like the tool commands
+// running them by hand
+func newScheduler() (*jobs.Scheduler, error) {
+	c := common.GetConfig().Jobs
+	historyPath := c.HistoryPath
+	if historyPath == "" {
+		historyPath = jobs.DefaultHistoryPath
+	}
+	catchUp := c.CatchUp
+	if catchUp == 0 {
+		catchUp = jobs.DefaultCatchUp
+	}
+	s, err := jobs.NewScheduler(historyPath, catchUp)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, sc := range c.Schedule {
+		schedule, err := jobs.ParseSchedule(sc.Every, sc.At)
+		if err != nil {
+			return nil, fmt.Errorf("error scheduling %s %s", name, err)
+		}
+		var fn jobs.Func
+		switch name {
+		case "createtoplist":
+			fn = jobs.TopList(LogsPath)
+		case "createstats":
+			fn = jobs.Stats(LogsPath, common.GetConfig().EmotesPath)
+		case "cleanup":
+			fn = jobs.Cleanup(LogsPath, cleanupCompress)
+		case "uploadToBigQuery":
+			if c.BigQueryConfig == "" {
+				return nil, fmt.Errorf("error scheduling %s, bigQueryConfig isn't set", name)
+			}
+			fn = jobs.BigQuery(c.BigQueryConfig, LogsPath)
+		default:
+			return nil, fmt.Errorf("unknown job %s", name)
+		}
+		s.Add(name, schedule, fn)
+	}
+	return s, nil
+}
+
+// cleanupCompress compresses day logs like the logger does when closing them
+func cleanupCompress(path string) error {
+	if strings.HasSuffix(path, ".txt") {
+		return compressLog(path)
+	}
+	_, err := common.CompressFile(path)
+	return err
+}
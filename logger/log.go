@@ -16,77 +16,135 @@ const (
 	LogsPath = "/logs"
 )
 
+// LogSyncInterval how often open logs are synced and the journal is committed
+const LogSyncInterval = 10 * time.Second
+
+var giftRegex = regexp.MustCompile("^[a-zA-Z0-9_]+ gifted [a-zA-Z0-9_]+ a Tier (I|II|II|IV) subscription!")
+
 // Logger logger
 type Logger struct {
-	logs *ChatLogs
+	logs       *ChatLogs
+	journal    *common.Journal
+	subTrigger bool
+	done       chan struct{}
 }
 
 // NewLogger instantiates destiny chat logger
 func NewLogger(logs *ChatLogs) *Logger {
 	return &Logger{
 		logs: logs,
+		done: make(chan struct{}),
 	}
 }
 
-// DestinyLog starts logging loop
-func (l *Logger) DestinyLog(mc <-chan *common.Message) {
-	var subTrigger bool
-	giftRegex := regexp.MustCompile("^[a-zA-Z0-9_]+ gifted [a-zA-Z0-9_]+ a Tier (I|II|II|IV) subscription!")
-
-loop:
-	for m := range mc {
-		switch m.Type {
-		case "BAN":
-			l.writeLine(m.Time, m.Channel, "Ban", fmt.Sprintf("%s banned by %s", m.Data, m.Nick))
-		case "UNBAN":
-			l.writeLine(m.Time, m.Channel, "Ban", fmt.Sprintf("%s unbanned by %s", m.Data, m.Nick))
-		case "MUTE":
-			l.writeLine(m.Time, m.Channel, "Ban", fmt.Sprintf("%s muted by %s", m.Data, m.Nick))
-		case "UNMUTE":
-			l.writeLine(m.Time, m.Channel, "Ban", fmt.Sprintf("%s unmuted by %s", m.Data, m.Nick))
-		case "BROADCAST":
-			subMessages := []string{"subscriber!", "subscribed on Twitch!", "has resubscribed! Active for", "has resubscribed on Twitch! active"}
+// NewJournaledLogger logger that reads from a journal and commits it after
+// syncing the logs
+func NewJournaledLogger(logs *ChatLogs, journal *common.Journal) *Logger {
+	return &Logger{
+		logs:    logs,
+		journal: journal,
+		done:    make(chan struct{}),
+	}
+}
 
-			for _, smsg := range subMessages {
-				if strings.Contains(m.Data, smsg) {
-					l.writeLine(m.Time, m.Channel, "Subscriber", m.Data)
-					subTrigger = !subTrigger
-					continue loop
-				}
+// Log starts logging loop
+func (l *Logger) Log(mc <-chan *common.Message) {
+	defer close(l.done)
+	ticker := time.NewTicker(LogSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case m, ok := <-mc:
+			if !ok {
+				l.sync()
+				return
 			}
-			if giftRegex.MatchString(m.Data) {
-				l.writeLine(m.Time, m.Channel, "Subscriber", m.Data)
-				subTrigger = !subTrigger
-				continue loop
+			l.handle(m)
+			if l.journal != nil {
+				l.journal.Ack()
 			}
-
-			if subTrigger {
-				l.writeLine(m.Time, m.Channel, "SubscriberMessage", m.Data)
-				subTrigger = !subTrigger
-				continue
-			}
-			l.writeLine(m.Time, m.Channel, "Broadcast", m.Data)
-		case "MSG":
-			l.writeLine(m.Time, m.Channel, m.Nick, m.Data)
-			subTrigger = false
+		case <-ticker.C:
+			l.sync()
 		}
 	}
 }
 
-// TwitchLog starts logging loop
-func (l *Logger) TwitchLog(mc <-chan *common.Message) {
-	for m := range mc {
-		if m.Type == "MSG" {
-			l.writeLine(m.Time, m.Channel, m.Nick, m.Data)
+// Done is closed once the messages channel was drained
+func (l *Logger) Done() <-chan struct{} {
+	return l.done
+}
+
+// sync flushes the open logs to disk and commits the acknowledged messages
+func (l *Logger) sync() {
+	l.logs.Sync()
+	if l.journal == nil {
+		return
+	}
+	if err := l.journal.Commit(); err != nil {
+		log.Printf("error committing journal %s", err)
+	}
+}
+
+func (l *Logger) handle(m *common.Message) {
+	switch m.Type {
+	case "BAN":
+		l.writeLine(m, "Ban", fmt.Sprintf("%s banned by %s", m.Data, m.Nick))
+	case "UNBAN":
+		l.writeLine(m, "Ban", fmt.Sprintf("%s unbanned by %s", m.Data, m.Nick))
+	case "MUTE":
+		l.writeLine(m, "Ban", fmt.Sprintf("%s muted by %s", m.Data, m.Nick))
+	case "UNMUTE":
+		l.writeLine(m, "Ban", fmt.Sprintf("%s unmuted by %s", m.Data, m.Nick))
+	case "BROADCAST":
+		subMessages := []string{"subscriber!", "subscribed on Twitch!", "has resubscribed! Active for", "has resubscribed on Twitch! active"}
+
+		for _, smsg := range subMessages {
+			if strings.Contains(m.Data, smsg) {
+				l.writeLine(m, "Subscriber", m.Data)
+				l.subTrigger = !l.subTrigger
+				return
+			}
+		}
+		if giftRegex.MatchString(m.Data) {
+			l.writeLine(m, "Subscriber", m.Data)
+			l.subTrigger = !l.subTrigger
+			return
+		}
+
+		if l.subTrigger {
+			l.writeLine(m, "SubscriberMessage", m.Data)
+			l.subTrigger = !l.subTrigger
+			return
+		}
+		l.writeLine(m, "Broadcast", m.Data)
+	case "MSG":
+		l.writeLine(m, m.Nick, m.Data)
+		l.subTrigger = false
+	case "CLEARCHAT":
+		// an empty nick means the whole chat was cleared
+		if m.Nick == "" {
+			return
+		}
+		if m.Data == "" {
+			l.writeLine(m, "Ban", fmt.Sprintf("%s banned", m.Nick))
+			return
 		}
+		l.writeLine(m, "Ban", fmt.Sprintf("%s timed out for %s seconds", m.Nick, m.Data))
+	case "CLEARMSG":
+		l.writeLine(m, "Ban", fmt.Sprintf("message from %s deleted: %s", m.Nick, m.Data))
 	}
 }
 
-func (l *Logger) writeLine(timestamp time.Time, channel, nick, message string) {
-	logs, err := l.logs.Get(filepath.Join(LogsPath, strings.Title(channel)+" chatlog", timestamp.Format("January 2006"), timestamp.Format("2006-01-02")+".txt"))
+// writeLine writes m to the channel log as nick: message, synthetic nicks
+// like "Ban" keep the type and tags of the source message
+func (l *Logger) writeLine(m *common.Message, nick, message string) {
+	line := *m
+	line.Nick = nick
+	line.Data = message
+	logs, err := l.logs.Get(filepath.Join(LogsPath, strings.Title(m.Channel)+" chatlog", m.Time.Format("January 2006"), m.Time.Format("2006-01-02")+".txt"))
 	if err != nil {
 		log.Printf("error opening log %s", err)
 		return
 	}
-	logs.Write(timestamp, nick, message)
+	logs.Write(&line)
 }
@@ -5,41 +5,125 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"syscall"
+	"time"
 
 	//"overrustlelogs/common"
 	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/b-ggs/overrustlelogs/jobs"
 )
 
+// defaults for unset config values
+const (
+	DefaultJournalPath = "/logger/journal"
+	DefaultHTTPAddress = ":8081"
+)
+
+var journalNameUnsafe = regexp.MustCompile("[^a-zA-Z0-9_.-]")
+
+var configPath string
+
 func init() {
-	configPath := flag.String("config", "/logger/overrustlelogs.toml", "config path")
-	flag.Parse()
-	common.SetupConfig(*configPath)
+	flag.StringVar(&configPath, "config", "/logger/overrustlelogs.toml", "config path")
 }
 
 func main() {
+	flag.Parse()
+	common.SetupConfig(configPath)
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	logs := NewChatLogs()
+	sources, err := NewSources(common.GetConfig().Sources)
+	if err != nil {
+		log.Fatalf("error creating sources %s", err)
+	}
+	journalPath := common.GetConfig().Logger.JournalPath
+	if journalPath == "" {
+		journalPath = DefaultJournalPath
+	}
+	if err := os.MkdirAll(journalPath, 0755); err != nil {
+		log.Fatalf("error creating journal directory %s", err)
+	}
 
-	dc := common.NewDestiny()
-	dl := NewLogger(logs)
-	go dl.DestinyLog(dc.Messages())
-	go dc.Run()
+	logs := make([]*ChatLogs, len(sources))
+	loggers := make([]*Logger, len(sources))
+	journals := make([]*common.Journal, len(sources))
+	for i, source := range sources {
+		journal, err := common.OpenJournal(filepath.Join(journalPath, journalName(source.Name())))
+		if err != nil {
+			log.Fatalf("error opening journal for %s %s", source.Name(), err)
+		}
+		journals[i] = journal
+		logs[i] = NewChatLogs()
+		loggers[i] = NewJournaledLogger(logs[i], journal)
+		go loggers[i].Log(journal.Messages())
+		go consume(source, journal)
+		registerSourceMetrics(source, logs[i], journal)
+		go source.Run()
+		log.Printf("started %s source", source.Name())
+	}
+	go reportDropped(sources, journals)
 
-	twitchLogHandler := func(m <-chan *common.Message) {
-		NewLogger(NewChatLogs()).TwitchLog(m)
+	var scheduler *jobs.Scheduler
+	if common.GetConfig().Jobs.Enabled {
+		if scheduler, err = newScheduler(); err != nil {
+			log.Fatalf("error creating job scheduler %s", err)
+		}
+		go scheduler.Run()
 	}
 
-	tl := NewTwitchLogger(twitchLogHandler)
-	go tl.Start()
+	httpAddress := common.GetConfig().Logger.HTTPAddress
+	if httpAddress == "" {
+		httpAddress = DefaultHTTPAddress
+	}
+	go serveHTTP(httpAddress, sources, scheduler)
 
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 	<-sigint
-	logs.Close()
-	dc.Stop()
-	tl.Stop()
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+	for i, source := range sources {
+		source.Stop()
+		journals[i].Stop()
+		<-loggers[i].Done()
+		if err := journals[i].Close(); err != nil {
+			log.Printf("error closing journal for %s %s", source.Name(), err)
+		}
+		logs[i].Close()
+	}
 	log.Println("i love you guys, be careful")
 	os.Exit(0)
 }
+
+// consume journals the messages of a source until it's stopped
+func consume(source common.ChatSource, journal *common.Journal) {
+	for m := range source.Messages() {
+		messagesReceived.Inc(source.Name(), m.Channel)
+		activity.Seen(source.Name(), m.Channel)
+		if err := journal.Append(m); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func journalName(source string) string {
+	return journalNameUnsafe.ReplaceAllString(source, "_") + ".journal"
+}
+
+// reportDropped logs dropped message counters when they change
+func reportDropped(sources []common.ChatSource, journals []*common.Journal) {
+	dropped := make([]uint64, len(sources))
+	failed := make([]uint64, len(sources))
+	for range time.Tick(time.Minute) {
+		for i, source := range sources {
+			d, f := source.Dropped(), journals[i].Failed()
+			if d != dropped[i] || f != failed[i] {
+				log.Printf("%s dropped %d messages, failed to journal %d messages", source.Name(), d, f)
+			}
+			dropped[i], failed[i] = d, f
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+// sourceFactories chat sources by config type
+var sourceFactories = map[string]func(conf common.SourceConfig) (common.ChatSource, error){
+	"destinygg": func(conf common.SourceConfig) (common.ChatSource, error) {
+		return common.NewDestiny(), nil
+	},
+	"twitch": func(conf common.SourceConfig) (common.ChatSource, error) {
+		return NewTwitchHub(), nil
+	},
+	"irc": func(conf common.SourceConfig) (common.ChatSource, error) {
+		if conf.Server == "" {
+			return nil, errors.New("missing server")
+		}
+		if conf.Auth != "" && conf.Auth != "sasl" && conf.Auth != "nickserv" {
+			return nil, fmt.Errorf("unknown auth %q", conf.Auth)
+		}
+		return common.NewIRC(conf), nil
+	},
+}
+
+// defaultSources used when the config doesn't list any sources
+var defaultSources = []common.SourceConfig{
+	{Type: "destinygg"},
+	{Type: "twitch"},
+}
+
+// NewSources creates the chat sources listed in the config
+func NewSources(confs []common.SourceConfig) ([]common.ChatSource, error) {
+	if len(confs) == 0 {
+		confs = defaultSources
+	}
+	sources := make([]common.ChatSource, 0, len(confs))
+	for _, conf := range confs {
+		factory, ok := sourceFactories[conf.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown source type %q", conf.Type)
+		}
+		source, err := factory(conf)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s source: %v", conf.Type, err)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/b-ggs/overrustlelogs/jobs"
+)
+
+// topLists live toplists of the months with open logs
+var topLists = &liveTopLists{months: make(map[string]*monthTopList)}
+
+// liveTopLists month toplists shared by the open logs of each month
+type liveTopLists struct {
+	mu     sync.Mutex
+	months map[string]*monthTopList
+}
+
+// monthTopList totals of each nick in a month, the sum of the toplist
+// counters written for its days
+type monthTopList struct {
+	sync.Mutex
+	path    string
+	refs    int
+	users   map[string]*common.NickDay
+	dirty   bool
+	writing sync.Mutex
+}
+
+// Open returns the toplist of the month directory path, loading it from
+// the day counters on the first open. Each Open is paired with a Release.
+func (t *liveTopLists) Open(path string) *monthTopList {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m, ok := t.months[path]
+	if !ok {
+		users, err := jobs.SumDayTopLists(path)
+		if err != nil {
+			log.Printf("error reading toplists of %s %s", path, err)
+			users = map[string]*common.NickDay{}
+		}
+		m = &monthTopList{path: path, users: users}
+		t.months[path] = m
+	}
+	m.refs++
+	return m
+}
+
+// Release writes and forgets the toplist once the last log of its month is
+// closed
+func (t *liveTopLists) Release(m *monthTopList) {
+	t.mu.Lock()
+	m.refs--
+	if m.refs > 0 {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.months, m.path)
+	t.mu.Unlock()
+	m.Write()
+}
+
+// Write writes the toplists changed since the last write
+func (t *liveTopLists) Write() {
+	t.mu.Lock()
+	months := make([]*monthTopList, 0, len(t.months))
+	for _, m := range t.months {
+		months = append(months, m)
+	}
+	t.mu.Unlock()
+	for _, m := range months {
+		m.Write()
+	}
+}
+
+// Update replaces the counters of a day's nicks, counted holds what the
+// toplist already includes of the day and is updated to days
+func (m *monthTopList) Update(counted map[string]*common.NickDay, days map[string]common.NickDay) {
+	m.Lock()
+	defer m.Unlock()
+	for nick, d := range days {
+		u, ok := m.users[nick]
+		if !ok {
+			u = &common.NickDay{}
+			m.users[nick] = u
+		}
+		if c, ok := counted[nick]; ok {
+			u.Lines -= c.Lines
+			u.Bytes -= c.Bytes
+		}
+		u.Merge(d)
+		d := d
+		counted[nick] = &d
+	}
+	m.dirty = true
+}
+
+// Write writes the month's toplist if it changed
+func (m *monthTopList) Write() {
+	m.writing.Lock()
+	defer m.writing.Unlock()
+	m.Lock()
+	if !m.dirty {
+		m.Unlock()
+		return
+	}
+	users := make(map[string]*common.NickDay, len(m.users))
+	for nick, u := range m.users {
+		c := *u
+		users[nick] = &c
+	}
+	m.dirty = false
+	m.Unlock()
+
+	if err := common.WriteTopList(filepath.Join(m.path, common.TopListFile), common.NewTopList(users)); err != nil {
+		log.Printf("error writing toplist of %s %s", m.path, err)
+	}
+}
@@ -21,22 +21,23 @@ const (
 	ChannelListPath = "/logger/channels.json"
 )
 
-// TwitchHub ...
+// TwitchHub spreads the twitch channels over multiple chat connections
 type TwitchHub struct {
 	chatLock       sync.RWMutex
 	chats          []*common.Twitch
 	chLock         sync.RWMutex
 	channels       []string
-	logHandler     func(m <-chan *common.Message)
+	messages       chan *common.Message
+	handlers       sync.WaitGroup
 	admins         map[string]struct{}
 	commandChannel string
 	quit           chan struct{}
 }
 
-// NewTwitchLogger ...
-func NewTwitchLogger(f func(m <-chan *common.Message)) *TwitchHub {
+// NewTwitchHub ...
+func NewTwitchHub() *TwitchHub {
 	t := &TwitchHub{
-		logHandler:     f,
+		messages:       make(chan *common.Message, common.MessageBufferSize),
 		admins:         make(map[string]struct{}),
 		commandChannel: common.GetConfig().Twitch.CommandChannel,
 		quit:           make(chan struct{}, 1),
@@ -57,8 +58,42 @@ func NewTwitchLogger(f func(m <-chan *common.Message)) *TwitchHub {
 	return t
 }
 
-// Start ...
-func (t *TwitchHub) Start() {
+// Name source name
+func (t *TwitchHub) Name() string { return "twitch" }
+
+// Messages messages of all chats
+func (t *TwitchHub) Messages() <-chan *common.Message { return t.messages }
+
+// Dropped messages dropped by all chats
+func (t *TwitchHub) Dropped() uint64 {
+	t.chatLock.RLock()
+	defer t.chatLock.RUnlock()
+	var n uint64
+	for _, c := range t.chats {
+		n += c.Dropped()
+	}
+	return n
+}
+
+// Status state of every chat connection
+func (t *TwitchHub) Status() []common.ConnStatus {
+	t.chatLock.RLock()
+	defer t.chatLock.RUnlock()
+	status := make([]common.ConnStatus, 0, len(t.chats))
+	for _, c := range t.chats {
+		status = append(status, c.Status()...)
+	}
+	return status
+}
+
+// Join joins and saves a new channel
+func (t *TwitchHub) Join(ch string) error { return t.join(ch, true) }
+
+// Leave leaves and removes a channel
+func (t *TwitchHub) Leave(ch string) error { return t.leave(ch) }
+
+// Run joins the saved channels
+func (t *TwitchHub) Run() {
 	var c int
 	for _, channel := range t.channels {
 		select {
@@ -85,10 +120,15 @@ func (t *TwitchHub) Stop() {
 	wg.Add(len(t.chats))
 	for i, c := range t.chats {
 		log.Printf("stopping chat: %d\n", i)
-		go c.Stop(&wg)
+		go func(c *common.Twitch) {
+			c.Stop()
+			wg.Done()
+		}(c)
 	}
 	t.chatLock.Unlock()
 	wg.Wait()
+	t.handlers.Wait()
+	close(t.messages)
 }
 
 func (t *TwitchHub) runCommand(c *common.Twitch, m *common.Message) {
@@ -142,6 +182,7 @@ func (t *TwitchHub) join(ch string, init bool) error {
 		chat = common.NewTwitch()
 		chat.Run()
 		t.chats = append(t.chats, chat)
+		t.handlers.Add(1)
 		go t.msgHandler(chat)
 	}
 	t.chatLock.Unlock()
@@ -153,15 +194,16 @@ func (t *TwitchHub) join(ch string, init bool) error {
 }
 
 func (t *TwitchHub) msgHandler(c *common.Twitch) {
-	messages := make(chan *common.Message, common.MessageBufferSize)
-	go t.logHandler(messages)
+	defer t.handlers.Done()
 	for {
 		select {
 		case <-t.quit:
-			close(messages)
 			return
-		case m := <-c.Messages():
-			messages <- m
+		case m, ok := <-c.Messages():
+			if !ok {
+				return
+			}
+			t.messages <- m
 			if t.commandChannel == m.Channel {
 				go t.runCommand(c, m)
 			}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/api"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/gorilla/mux"
+)
+
+const fixtureMonth = "March 2020"
+
+var fixtureDays = map[string]string{
+	"2020-03-01": "[2020-03-01 10:00:00 UTC] Bob: hello chat\n" +
+		"[2020-03-01 10:00:01 UTC] Alice: hi Bob\n" +
+		"[2020-03-01 10:00:02 UTC] Bob: kappa time\n",
+	"2020-03-02": "[2020-03-02 08:00:00 UTC] Alice: morning\n" +
+		"[2020-03-02 08:00:01 UTC] Bob: kappa again\n",
+}
+
+// newFixtureServer serves the api over a logs directory with a Foo channel
+func newFixtureServer(t *testing.T) (*api.Client, func()) {
+	dir, err := ioutil.TempDir("", "overrustlelogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monthPath := filepath.Join(dir, "Foo chatlog", fixtureMonth)
+	if err := os.MkdirAll(monthPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for date, data := range fixtureDays {
+		writeFixtureDay(t, monthPath, date, data)
+	}
+
+	toplist := &common.TopList{Users: []common.TopListUser{
+		{Username: "Bob", Lines: 3, Bytes: 40, Seen: 1583136001},
+		{Username: "Alice", Lines: 2, Bytes: 20, Seen: 1583136000},
+		{Username: "Carl", Lines: 1, Bytes: 10, Seen: 1583136000},
+	}}
+	if err := common.WriteTopList(filepath.Join(monthPath, common.TopListFile), toplist); err != nil {
+		t.Fatal(err)
+	}
+
+	logsPath := LogsPath
+	LogsPath = dir
+	profileCache.Purge()
+	srv := httptest.NewServer(newRouter())
+	return api.NewClient(srv.URL), func() {
+		srv.Close()
+		LogsPath = logsPath
+		os.RemoveAll(dir)
+	}
+}
+
+// writeFixtureDay writes a compressed day log and its nick list
+func writeFixtureDay(t *testing.T, monthPath, date, data string) {
+	if err := os.MkdirAll(monthPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := common.WriteCompressedFile(filepath.Join(monthPath, date+".txt"), []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	nicks := common.NickList{}
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		m, err := common.ParseMessageLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nicks.Add(m.Nick)
+	}
+	if err := nicks.WriteTo(filepath.Join(monthPath, date+".nicks")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPIListings(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	channels, err := c.Channels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 1 || channels[0] != "Foo" {
+		t.Errorf("channels = %v", channels)
+	}
+
+	// the nick index isn't a month
+	if err := common.NewNickIndex(filepath.Join(LogsPath, "Foo chatlog")).Replace(nil); err != nil {
+		t.Fatal(err)
+	}
+	months, err := c.Months("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(months) != 1 || months[0] != fixtureMonth {
+		t.Errorf("months = %v", months)
+	}
+
+	days, err := c.Days("foo", fixtureMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inStrings(days, "2020-03-01.txt") || !inStrings(days, "2020-03-02.txt") {
+		t.Errorf("days = %v", days)
+	}
+
+	users, err := c.Users("foo", fixtureMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0] != "Alice.txt" || users[1] != "Bob.txt" {
+		t.Errorf("users = %v", users)
+	}
+
+	lines, err := c.Lines("foo", fixtureMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines.Data) != 2 || lines.Data[0].Lines != 3 || lines.Data[1].Lines != 2 {
+		t.Errorf("lines = %+v", lines)
+	}
+
+	if _, err := c.Months("nope"); !isAPIError(err, 404) {
+		t.Errorf("expected 404 for unknown channel, got %v", err)
+	}
+}
+
+func TestAPILogs(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	page, err := c.Day("foo", fixtureMonth, "2020-03-01", api.LogsQuery{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 2 || page.Next == "" {
+		t.Fatalf("first page = %+v", page)
+	}
+	if m := page.Messages[0]; m.Nick != "Bob" || m.Data != "hello chat" || m.Type != "MSG" {
+		t.Errorf("message = %+v", m)
+	}
+	page, err = c.Day("foo", fixtureMonth, "2020-03-01", api.LogsQuery{Limit: 2, Cursor: page.Next})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Next != "" || page.Messages[0].Data != "kappa time" {
+		t.Errorf("second page = %+v", page)
+	}
+
+	page, err = c.Day("foo", fixtureMonth, "2020-03-01", api.LogsQuery{Filter: "KAPPA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 {
+		t.Errorf("filtered = %+v", page)
+	}
+	page, err = c.Day("foo", fixtureMonth, "2020-03-01", api.LogsQuery{Filter: "nick:bob NOT re:^kap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Messages[0].Data != "hello chat" {
+		t.Errorf("query filtered = %+v", page)
+	}
+	if _, err := c.Day("foo", fixtureMonth, "2020-03-01", api.LogsQuery{Filter: "(kappa"}); !isAPIError(err, 400) {
+		t.Errorf("expected 400 for invalid filter, got %v", err)
+	}
+
+	var all []string
+	q := api.LogsQuery{Limit: 1}
+	for {
+		page, err := c.User("foo", fixtureMonth, "bob", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range page.Messages {
+			all = append(all, m.Data)
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	if strings.Join(all, "|") != "hello chat|kappa time|kappa again" {
+		t.Errorf("user messages = %v", all)
+	}
+
+	if _, err := c.Day("foo", fixtureMonth, "2020-03-01", api.LogsQuery{Cursor: "!"}); !isAPIError(err, 400) {
+		t.Errorf("expected 400 for invalid cursor, got %v", err)
+	}
+}
+
+func TestAPISeekableLogs(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	// one frame per line
+	path := filepath.Join(LogsPath, "Foo chatlog", fixtureMonth, "2020-03-01.txt")
+	if err := common.WriteSeekableFile(path, strings.NewReader(fixtureDays["2020-03-01"]), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var all []string
+	q := api.LogsQuery{Limit: 1}
+	for {
+		page, err := c.Day("foo", fixtureMonth, "2020-03-01", q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range page.Messages {
+			all = append(all, m.Data)
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	if strings.Join(all, "|") != "hello chat|hi Bob|kappa time" {
+		t.Errorf("day messages = %v", all)
+	}
+
+	page, err := c.Day("foo", fixtureMonth, "2020-03-01", api.LogsQuery{From: time.Date(2020, 3, 1, 10, 0, 1, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].Data != "hi Bob" {
+		t.Errorf("from page = %+v", page)
+	}
+
+	mentions, err := c.Mentions("foo", "bob", "2020-03-01", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mentions) != 1 || mentions[0].Nick != "Alice" {
+		t.Errorf("mentions = %+v", mentions)
+	}
+}
+
+func TestAPIUserQueries(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	// stalking scans back from today
+	today := time.Now().UTC()
+	writeFixtureDay(t, filepath.Join(LogsPath, "Foo chatlog", today.Format("January 2006")), today.Format("2006-01-02"),
+		"["+today.Format("2006-01-02")+" 00:00:00 UTC] Bob: first\n["+today.Format("2006-01-02")+" 00:00:01 UTC] Bob: second\n")
+	stalk, err := c.Stalk("foo", "bob", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stalk.Nick != "bob" || len(stalk.Lines) != 2 || stalk.Lines[1].Text != "second" {
+		t.Errorf("stalk = %+v", stalk)
+	}
+
+	mentions, err := c.Mentions("foo", "bob", "2020-03-01", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mentions) != 1 || mentions[0].Nick != "Alice" {
+		t.Errorf("mentions = %+v", mentions)
+	}
+
+	toplist, err := c.TopList("foo", fixtureMonth, 2, "username")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toplist.Users) != 2 || toplist.Users[0].Username != "Alice" || toplist.Sort != "username" {
+		t.Errorf("toplist = %+v", toplist)
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal([]byte(api.OpenAPI), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	err := newRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(tpl, "/api/v1/") {
+			return nil
+		}
+		path := strings.TrimPrefix(stripPathPatterns(tpl), "/api/v1")
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("route %s is missing from the openapi document", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stripPathPatterns turns "/{channel:[a-z]+}/x" into "/{channel}/x", the
+// literal " chatlog" suffix of channel patterns is kept outside the braces
+func stripPathPatterns(tpl string) string {
+	var b, pattern strings.Builder
+	depth := 0
+	inName := false
+	for _, c := range tpl {
+		switch {
+		case c == '{':
+			depth++
+			if depth == 1 {
+				b.WriteRune(c)
+				inName = true
+				pattern.Reset()
+				continue
+			}
+		case c == '}':
+			depth--
+			if depth == 0 {
+				b.WriteRune(c)
+				if strings.HasSuffix(pattern.String(), " chatlog") {
+					b.WriteString(" chatlog")
+				}
+				continue
+			}
+		case depth == 0:
+			b.WriteRune(c)
+			continue
+		case inName && c == ':':
+			inName = false
+			continue
+		case inName:
+			b.WriteRune(c)
+			continue
+		}
+		pattern.WriteRune(c)
+	}
+	return b.String()
+}
+
+func inStrings(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func isAPIError(err error, code int) bool {
+	e, ok := err.(*api.Error)
+	return ok && e.StatusCode == code
+}
+
+func TestAPIUserProfile(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	// a second channel answered by its nick index
+	barPath := filepath.Join(LogsPath, "Bar chatlog")
+	if err := os.MkdirAll(filepath.Join(barPath, "April 2020"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	e := &common.NickIndexEntry{}
+	e.Set("BOB", common.NickDay{Date: "2020-04-02", Lines: 2, First: 1585785600, Last: 1585789200})
+	if err := common.NewNickIndex(barPath).Replace(map[string]*common.NickIndexEntry{"bob": e}); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := c.UserProfile("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Nick != "BOB" || len(profile.Channels) != 2 {
+		t.Fatalf("profile = %+v", profile)
+	}
+	bar, foo := profile.Channels[0], profile.Channels[1]
+	if bar.Channel != "Bar" || bar.FirstSeen != 1585785600 || bar.LastSeen != 1585789200 || len(bar.Months) != 1 || bar.Months[0].Lines != 0 {
+		t.Errorf("bar = %+v", bar)
+	}
+	if foo.Channel != "Foo" || foo.FirstSeen != 1583020800 || foo.LastSeen != 1583136001 || foo.Lines != 3 || foo.Bytes != 40 {
+		t.Errorf("foo = %+v", foo)
+	}
+	if len(foo.Months) != 1 || foo.Months[0].URL != "/Foo chatlog/"+fixtureMonth+"/userlogs/Bob" {
+		t.Errorf("foo months = %+v", foo.Months)
+	}
+
+	if _, err := c.UserProfile("nobody"); !isAPIError(err, 404) {
+		t.Errorf("expected 404 for unknown nick, got %v", err)
+	}
+
+	// profiles are reused until they expire
+	if err := os.RemoveAll(barPath); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := fixtureGet(t, c.BaseURL, "/api/v1/users/Bob.json", nil)
+	if res.Header.Get("Cache-control") != LiveCacheControl {
+		t.Errorf("profile cache control = %q", res.Header.Get("Cache-control"))
+	}
+	if profile, err := c.UserProfile("bob"); err != nil || len(profile.Channels) != 2 {
+		t.Errorf("cached profile = %+v %v", profile, err)
+	}
+	v, _ := profileCache.Get("bob")
+	v.(*cachedProfile).built = time.Now().Add(-ProfileCacheTTL)
+	if profile, err := c.UserProfile("bob"); err != nil || len(profile.Channels) != 1 {
+		t.Errorf("expired profile = %+v %v", profile, err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cache control of logs that are still being written, of past days, which
+// the logger reopens for late or journal replayed messages, and of days older
+// than ImmutableAfter, well beyond any journal replay
+const (
+	LiveCacheControl      = "max-age=60"
+	PastCacheControl      = "public, max-age=3600"
+	ImmutableCacheControl = "public, max-age=31536000, immutable"
+	ImmutableAfter        = 30 * 24 * time.Hour
+)
+
+// logFile stored day log, compressed files hold a single zstd stream
+type logFile struct {
+	os.FileInfo
+	path       string
+	compressed bool
+}
+
+// statLogFile finds the stored file of the day log at path, the .txt(.gz)
+// extension is optional
+func statLogFile(path string) (*logFile, error) {
+	path = LogExtension.ReplaceAllString(path, "") + ".txt"
+	fi, err := os.Stat(path + ".gz")
+	if err == nil {
+		return &logFile{fi, path + ".gz", true}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	fi, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{fi, path, false}, nil
+}
+
+// etag strong validator of the stored bytes, encoding distinguishes the
+// decompressed and pass-through representations
+func (f *logFile) etag(encoding string) string {
+	if encoding != "" {
+		return fmt.Sprintf(`"%x-%x-%s"`, f.ModTime().UnixNano(), f.Size(), encoding)
+	}
+	return fmt.Sprintf(`"%x-%x"`, f.ModTime().UnixNano(), f.Size())
+}
+
+// cacheControl compressed past days are cached longer, and as immutable once
+// they're older than ImmutableAfter
+func (f *logFile) cacheControl(date string, now time.Time) string {
+	now = now.UTC()
+	switch {
+	case !f.compressed || date >= now.Format("2006-01-02"):
+		return LiveCacheControl
+	case date < now.Add(-ImmutableAfter).Format("2006-01-02"):
+		return ImmutableCacheControl
+	}
+	return PastCacheControl
+}
+
+// serveLogFile serves a whole day log with conditional request support,
+// compressed files are passed through to clients accepting zstd. Ranges of
+// the decompressed text are only served for plain logs, as the decompressed
+// size of compressed logs isn't stored.
+func serveLogFile(w http.ResponseWriter, r *http.Request, f *logFile, date string) {
+	w.Header().Set("Content-type", "text/plain; charset=UTF-8")
+	w.Header().Set("Cache-control", f.cacheControl(date, time.Now()))
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	if f.compressed && acceptsEncoding(r, "zstd") {
+		file, err := os.Open(f.path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		w.Header().Set("ETag", f.etag("zstd"))
+		w.Header().Set("Content-Encoding", "zstd")
+		http.ServeContent(w, r, "", f.ModTime(), file)
+		return
+	}
+
+	w.Header().Set("ETag", f.etag(""))
+	if !f.compressed {
+		file, err := os.Open(f.path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		http.ServeContent(w, r, "", f.ModTime(), file)
+		return
+	}
+	if checkNotModified(w, r, f.etag(""), f.ModTime()) {
+		return
+	}
+	w.Header().Set("Accept-Ranges", "none")
+	data, err := openLogFile(f.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer data.Close()
+	_, _ = io.Copy(w, data)
+}
+
+// logDirValidators etag and last modified time of the logs in path, derived
+// from the names, sizes and mtimes of the stored files
+func logDirValidators(path string, names []string) (string, time.Time) {
+	h := fnv.New64a()
+	var modtime time.Time
+	for _, name := range names {
+		fi, err := os.Stat(filepath.Join(path, name))
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s %d %d\n", name, fi.Size(), fi.ModTime().UnixNano())
+		if fi.ModTime().After(modtime) {
+			modtime = fi.ModTime()
+		}
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum64()), modtime
+}
+
+// checkNotModified writes a 304 response when the request's If-None-Match or
+// If-Modified-Since validators match, validation headers must already be set
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, modtime time.Time) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	if !modtime.IsZero() {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatch(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modtime.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || modtime.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch weak comparison of an If-None-Match header against etag
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding checks if the request's Accept-Encoding allows encoding
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(v, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), encoding) {
+			continue
+		}
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				q, err := strconv.ParseFloat(p[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
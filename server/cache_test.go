@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/datadog/zstd"
+)
+
+func fixtureGet(t *testing.T, base, path string, header http.Header) (*http.Response, string) {
+	u := &url.URL{Path: path}
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		u = &url.URL{Path: path[:i], RawQuery: path[i+1:]}
+	}
+	req, err := http.NewRequest("GET", base+u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(body)
+}
+
+func TestDayConditionalGet(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	path := "/Foo chatlog/" + fixtureMonth + "/2020-03-01.txt"
+	res, body := fixtureGet(t, c.BaseURL, path, nil)
+	if res.StatusCode != http.StatusOK || body != fixtureDays["2020-03-01"] {
+		t.Fatalf("day = %d %q", res.StatusCode, body)
+	}
+	etag := res.Header.Get("ETag")
+	if etag == "" || res.Header.Get("Last-Modified") == "" {
+		t.Errorf("missing validators %v", res.Header)
+	}
+	if res.Header.Get("Cache-control") != ImmutableCacheControl {
+		t.Errorf("past day cache control = %q", res.Header.Get("Cache-control"))
+	}
+
+	res, _ = fixtureGet(t, c.BaseURL, path, http.Header{"If-None-Match": {etag}})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match status = %d", res.StatusCode)
+	}
+	res, _ = fixtureGet(t, c.BaseURL, path, http.Header{"If-Modified-Since": {time.Now().UTC().Format(http.TimeFormat)}})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("If-Modified-Since status = %d", res.StatusCode)
+	}
+
+	res, body = fixtureGet(t, c.BaseURL, path, http.Header{"Range": {"bytes=0-9"}})
+	if res.StatusCode != http.StatusOK || body != fixtureDays["2020-03-01"] || res.Header.Get("Accept-Ranges") != "none" {
+		t.Errorf("compressed range = %d %q %v", res.StatusCode, body, res.Header)
+	}
+
+	res, body = fixtureGet(t, c.BaseURL, path, http.Header{"Accept-Encoding": {"gzip, zstd"}})
+	if res.Header.Get("Content-Encoding") != "zstd" || res.Header.Get("ETag") == etag {
+		t.Fatalf("zstd headers = %v", res.Header)
+	}
+	data, err := zstd.Decompress(nil, []byte(body))
+	if err != nil || string(data) != fixtureDays["2020-03-01"] {
+		t.Errorf("zstd body = %q %v", data, err)
+	}
+	res, _ = fixtureGet(t, c.BaseURL, path, http.Header{"Accept-Encoding": {"zstd;q=0"}})
+	if res.Header.Get("Content-Encoding") != "" {
+		t.Errorf("zstd sent with q=0")
+	}
+}
+
+func TestUserLogsConditionalGet(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	path := "/Foo chatlog/" + fixtureMonth + "/userlogs/Bob.txt"
+	res, body := fixtureGet(t, c.BaseURL, path, nil)
+	if res.StatusCode != http.StatusOK || body == "" {
+		t.Fatalf("user logs = %d %q", res.StatusCode, body)
+	}
+	res, _ = fixtureGet(t, c.BaseURL, path, http.Header{"If-None-Match": {res.Header.Get("ETag")}})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match status = %d", res.StatusCode)
+	}
+	res, _ = fixtureGet(t, c.BaseURL, path+"?filter=kappa", http.Header{"If-None-Match": {`"stale"`}})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("stale etag status = %d", res.StatusCode)
+	}
+}
+
+func TestDayRange(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	data := "[2020-03-03 10:00:00 UTC] Bob: still writing\n"
+	if err := ioutil.WriteFile(filepath.Join(LogsPath, "Foo chatlog", fixtureMonth, "2020-03-03.txt"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := "/Foo chatlog/" + fixtureMonth + "/2020-03-03.txt"
+	res, body := fixtureGet(t, c.BaseURL, path, http.Header{"Range": {"bytes=0-9"}})
+	if res.StatusCode != http.StatusPartialContent || body != data[:10] {
+		t.Errorf("range = %d %q", res.StatusCode, body)
+	}
+	if res.Header.Get("Cache-control") != LiveCacheControl {
+		t.Errorf("plain day cache control = %q", res.Header.Get("Cache-control"))
+	}
+}
+
+func TestLogCacheControl(t *testing.T) {
+	now := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	compressed := &logFile{compressed: true}
+	cases := []struct {
+		f    *logFile
+		date string
+		want string
+	}{
+		{compressed, "2020-03-20", LiveCacheControl},
+		{&logFile{}, "2020-03-19", LiveCacheControl},
+		{compressed, "2020-03-19", PastCacheControl},
+		{compressed, "2020-02-19", PastCacheControl},
+		{compressed, "2020-02-18", ImmutableCacheControl},
+	}
+	for _, c := range cases {
+		if got := c.f.cacheControl(c.date, now); got != c.want {
+			t.Errorf("cacheControl(%s, compressed %t) = %q, want %q", c.date, c.f.compressed, got, c.want)
+		}
+	}
+}
+
+func TestDayFilterNick(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	path := "/Foo chatlog/" + fixtureMonth + "/2020-03-01.txt"
+	res, body := fixtureGet(t, c.BaseURL, path+"?filter=alice", nil)
+	if res.StatusCode != http.StatusOK || body != "[2020-03-01 10:00:01 UTC] Alice: hi Bob\n" {
+		t.Errorf("nick filter = %d %q", res.StatusCode, body)
+	}
+	res, body = fixtureGet(t, c.BaseURL, path+"?filter=bob", nil)
+	if res.StatusCode != http.StatusOK || body != fixtureDays["2020-03-01"] {
+		t.Errorf("nick and text filter = %d %q", res.StatusCode, body)
+	}
+}
+
+func TestFilterBudget(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+	budget := common.QueryRegexBudget
+	defer func() { common.QueryRegexBudget = budget }()
+
+	day := "/Foo chatlog/" + fixtureMonth + "/2020-03-01.txt?filter=NOT%20re:zzz"
+	user := "/Foo chatlog/" + fixtureMonth + "/userlogs/Bob.txt?filter=NOT%20re:zzz"
+	common.QueryRegexBudget = 15
+	res, body := fixtureGet(t, c.BaseURL, day, nil)
+	if res.StatusCode != http.StatusOK || body != "[2020-03-01 10:00:00 UTC] Bob: hello chat\n" || res.Trailer.Get(QueryTruncatedTrailer) != "true" {
+		t.Errorf("truncated day filter = %d %q %v", res.StatusCode, body, res.Trailer)
+	}
+	res, body = fixtureGet(t, c.BaseURL, user, nil)
+	if res.StatusCode != http.StatusOK || body != "[2020-03-01 10:00:00 UTC] Bob: hello chat\n" || res.Trailer.Get(QueryTruncatedTrailer) != "true" {
+		t.Errorf("truncated user filter = %d %q %v", res.StatusCode, body, res.Trailer)
+	}
+
+	common.QueryRegexBudget = 5
+	for _, path := range []string{day, user} {
+		if res, _ := fixtureGet(t, c.BaseURL, path, nil); res.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s = %d, expected %d", path, res.StatusCode, http.StatusUnprocessableEntity)
+		}
+	}
+
+	common.QueryRegexBudget = budget
+	res, body = fixtureGet(t, c.BaseURL, day, nil)
+	if res.StatusCode != http.StatusOK || body != fixtureDays["2020-03-01"] || res.Trailer.Get(QueryTruncatedTrailer) != "" {
+		t.Errorf("day filter = %d %q %v", res.StatusCode, body, res.Trailer)
+	}
+}
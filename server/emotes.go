@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/api"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/gorilla/mux"
+	lru "github.com/hashicorp/golang-lru"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNoEmotes month without day emote uses
+var ErrNoEmotes = errors.New("no emotes counted for this month")
+
+// emotesCache month emote uses by month path and lower case nick, entries
+// are reused while the etag of their sources matches
+var emotesCache, _ = lru.New(StatsCacheSize)
+
+type cachedEmotes struct {
+	etag    string
+	modtime time.Time
+	emotes  *api.Emotes
+}
+
+// emotesPayload ranked emotes page
+type emotesPayload struct {
+	Emotes      []api.EmoteUsage
+	Breadcrumbs []breadcrumb
+}
+
+// EmotesHandle shows the most used emotes of a month
+func EmotesHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channel := convertChannelCase(vars["channel"])
+	c, err := monthEmotes(filepath.Join(LogsPath, channel), strings.TrimSuffix(channel, " chatlog"), vars["month"], "")
+	if err == ErrNoEmotes {
+		serveError(w, ErrNotFound)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	t, err := view.GetTemplate("emotes")
+	if err != nil {
+		serveError(w, errors.New("failed loading emotes template"))
+		return
+	}
+	payload := emotesPayload{
+		Emotes: c.emotes.Emotes,
+		Breadcrumbs: []breadcrumb{
+			{"/" + channel, channel},
+			{"/" + channel + "/" + vars["month"], vars["month"]},
+			{"/" + channel + "/" + vars["month"] + "/emotes", "Emotes"},
+		},
+	}
+	w.Header().Set("Content-type", "text/html")
+	if err := t.Execute(w, nil, payload); err != nil {
+		serveError(w, errors.New("failed executing emotes template"))
+		return
+	}
+}
+
+// EmotesAPIHandle serves the emote uses of a month, summed from the day emote
+// uses the logger writes next to the nick lists
+func EmotesAPIHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channel := strings.Title(strings.ToLower(vars["channel"]))
+	c, err := monthEmotes(filepath.Join(LogsPath, channel+" chatlog"), channel, vars["month"], r.URL.Query().Get("nick"))
+	if err == ErrNotFound || err == ErrNoEmotes {
+		serveAPIError(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Error(err)
+		serveAPIError(w, "failed reading emotes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-control", LiveCacheControl)
+	w.Header().Set("ETag", c.etag)
+	if checkNotModified(w, r, c.etag, c.modtime) {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(c.emotes)
+}
+
+// monthEmotes returns the cached emote uses of month by nick, or of every
+// nick if it's empty, summing the day emote uses when they changed
+func monthEmotes(channelPath, channel, month, nick string) (*cachedEmotes, error) {
+	files, err := readDirIndex(filepath.Join(channelPath, month))
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, file := range files {
+		if strings.HasSuffix(file, common.DayEmotesExtension+".gz") {
+			days = append(days, file)
+		}
+	}
+	if len(days) == 0 {
+		return nil, ErrNoEmotes
+	}
+
+	key := filepath.Join(channelPath, month) + "\x00" + strings.ToLower(nick)
+	etag, modtime := logDirValidators(filepath.Join(channelPath, month), days)
+	if v, ok := emotesCache.Get(key); ok && v.(*cachedEmotes).etag == etag {
+		return v.(*cachedEmotes), nil
+	}
+	emotes, err := sumDayEmotes(filepath.Join(channelPath, month), days, nick)
+	if err != nil {
+		return nil, err
+	}
+	emotes.Channel = channel
+	emotes.Month = month
+	emotes.Nick = nick
+	c := &cachedEmotes{etag, modtime, emotes}
+	emotesCache.Add(key, c)
+	return c, nil
+}
+
+// sumDayEmotes sums the emote uses files days of the month at path in date
+// order, of nick only unless it's empty
+func sumDayEmotes(path string, days []string, nick string) (*api.Emotes, error) {
+	usage := map[string]*api.EmoteUsage{}
+	users := map[string]common.NickListLower{}
+	for _, file := range days {
+		d, err := common.ReadDayEmotes(filepath.Join(path, file))
+		if err != nil {
+			return nil, err
+		}
+		counts := map[string]int{}
+		for n, uses := range d.Nicks {
+			if nick != "" && !strings.EqualFold(n, nick) {
+				continue
+			}
+			for emote, count := range uses {
+				counts[emote] += count
+				if users[emote] == nil {
+					users[emote] = common.NickListLower{}
+				}
+				users[emote].Add(n)
+			}
+		}
+		for emote, count := range counts {
+			u, ok := usage[emote]
+			if !ok {
+				u = &api.EmoteUsage{Emote: emote}
+				usage[emote] = u
+			}
+			u.Count += count
+			u.Days = append(u.Days, api.DayCount{Date: d.Date, Count: count})
+		}
+	}
+
+	emotes := &api.Emotes{Emotes: make([]api.EmoteUsage, 0, len(usage))}
+	for emote, u := range usage {
+		u.Users = len(users[emote])
+		emotes.Emotes = append(emotes.Emotes, *u)
+	}
+	sort.Slice(emotes.Emotes, func(i, j int) bool {
+		a, b := emotes.Emotes[i], emotes.Emotes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Emote < b.Emote
+	})
+	return emotes, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+)
+
+// LoggerURL base url of the logger http listener, its health report is
+// included in the server report
+var LoggerURL = "http://logger:8081"
+
+var healthClient = http.Client{Timeout: 2 * time.Second}
+
+type serverHealth struct {
+	Status string          `json:"status"`
+	Logs   serverLogs      `json:"logs"`
+	Logger json.RawMessage `json:"logger,omitempty"`
+	Error  string          `json:"loggerError,omitempty"`
+}
+
+type serverLogs struct {
+	Path     string `json:"path"`
+	Readable bool   `json:"readable"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthHandle reports the logs volume state and the logger health
+func HealthHandle(w http.ResponseWriter, r *http.Request) {
+	report := newServerHealth(true)
+	status := http.StatusOK
+	if !report.Logs.Readable {
+		status = http.StatusServiceUnavailable
+	}
+	serveHealth(w, report, status)
+}
+
+// ReadyHandle fails while the logs can't be served, the logger state doesn't
+// affect readiness
+func ReadyHandle(w http.ResponseWriter, r *http.Request) {
+	report := newServerHealth(false)
+	status := http.StatusOK
+	if !report.Logs.Readable || view == nil {
+		report.Status = "fail"
+		status = http.StatusServiceUnavailable
+	}
+	serveHealth(w, report, status)
+}
+
+func newServerHealth(withLogger bool) *serverHealth {
+	report := &serverHealth{
+		Status: "ok",
+		Logs:   serverLogs{Path: LogsPath},
+	}
+	if f, err := os.Open(LogsPath); err != nil {
+		report.Status = "fail"
+		report.Logs.Error = err.Error()
+	} else {
+		_, err := f.Readdirnames(1)
+		f.Close()
+		if err != nil {
+			report.Status = "fail"
+			report.Logs.Error = err.Error()
+		} else {
+			report.Logs.Readable = true
+		}
+	}
+
+	if withLogger && LoggerURL != "" {
+		res, err := healthClient.Get(LoggerURL + "/healthz")
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		defer res.Body.Close()
+		var logger json.RawMessage
+		if err := json.NewDecoder(res.Body).Decode(&logger); err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		report.Logger = logger
+	}
+	return report
+}
+
+func serveHealth(w http.ResponseWriter, report interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(report)
+}
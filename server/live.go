@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/api"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// live tail settings
+const (
+	LivePollInterval = time.Second
+	LivePingInterval = 30 * time.Second
+	LiveBufferSize   = 256
+	MaxLiveClients   = 1000
+)
+
+var live = &liveHub{tails: make(map[string]*liveTail)}
+
+var liveUpgrader = websocket.Upgrader{
+	HandshakeTimeout: 10 * time.Second,
+	CheckOrigin:      func(r *http.Request) bool { return true },
+}
+
+// liveHub shares one tail per channel between all clients
+type liveHub struct {
+	mu      sync.Mutex
+	tails   map[string]*liveTail
+	clients int
+}
+
+// liveTail polls the current day log of a channel for new lines
+type liveTail struct {
+	channelPath string
+	subscribers map[chan []byte]struct{}
+	quit        chan struct{}
+}
+
+// subscribe returns a channel receiving new lines of the channel log, nil
+// if there are too many clients
+func (h *liveHub) subscribe(channelPath string) chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients >= MaxLiveClients {
+		return nil
+	}
+	h.clients++
+	t, ok := h.tails[channelPath]
+	if !ok {
+		t = &liveTail{
+			channelPath: channelPath,
+			subscribers: make(map[chan []byte]struct{}),
+			quit:        make(chan struct{}),
+		}
+		h.tails[channelPath] = t
+		go t.run(h)
+	}
+	c := make(chan []byte, LiveBufferSize)
+	t.subscribers[c] = struct{}{}
+	return c
+}
+
+func (h *liveHub) unsubscribe(channelPath string, c chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.tails[channelPath]
+	if !ok {
+		return
+	}
+	if _, ok := t.subscribers[c]; !ok {
+		return
+	}
+	h.clients--
+	delete(t.subscribers, c)
+	if len(t.subscribers) == 0 {
+		close(t.quit)
+		delete(h.tails, channelPath)
+	}
+}
+
+// publish sends a line to every subscriber, slow clients miss lines instead
+// of blocking the tail
+func (h *liveHub) publish(t *liveTail, line []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range t.subscribers {
+		select {
+		case c <- line:
+		default:
+		}
+	}
+}
+
+func (t *liveTail) run(h *liveHub) {
+	ticker := time.NewTicker(LivePollInterval)
+	defer ticker.Stop()
+
+	day := time.Now().UTC()
+	path := t.dayPath(day)
+	offset := currentLogSize(path)
+	var partial []byte
+	for {
+		select {
+		case <-t.quit:
+			return
+		case <-ticker.C:
+		}
+
+		if now := time.Now().UTC(); now.Format("2006-01-02") != day.Format("2006-01-02") {
+			// flush the rest of the previous day before switching
+			t.read(h, path, &offset, &partial)
+			day = now
+			path = t.dayPath(day)
+			offset = 0
+			partial = nil
+		}
+		t.read(h, path, &offset, &partial)
+	}
+}
+
+func (t *liveTail) dayPath(day time.Time) string {
+	return filepath.Join(t.channelPath, day.Format("January 2006"), day.Format("2006-01-02")+".txt")
+}
+
+// read publishes the complete lines appended to path since offset. The log
+// may be compressed while idle, its uncompressed size stays the same when
+// the logger reopens it.
+func (t *liveTail) read(h *liveHub, path string, offset *int64, partial *[]byte) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.Size() <= *offset {
+		return
+	}
+	data := make([]byte, stat.Size()-*offset)
+	n, err := f.ReadAt(data, *offset)
+	if err != nil && err != io.EOF {
+		log.Errorf("error reading %s %s", path, err)
+		return
+	}
+	*offset += int64(n)
+	data = append(*partial, data[:n]...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			break
+		}
+		h.publish(t, data[:i])
+		data = data[i+1:]
+	}
+	*partial = append([]byte(nil), data...)
+}
+
+// currentLogSize size of the uncompressed day log, lines before it are
+// already served by the day handler
+func currentLogSize(path string) int64 {
+	if stat, err := os.Stat(path); err == nil {
+		return stat.Size()
+	}
+	f, err := openLogFile(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	n, _ := io.Copy(ioutil.Discard, f)
+	return n
+}
+
+// liveFilter nick and keyword filter of a live client
+type liveFilter struct {
+	nicks map[string]struct{}
+	query *common.Query
+}
+
+func newLiveFilter(r *http.Request) (*liveFilter, error) {
+	f := &liveFilter{}
+	if v := r.URL.Query().Get("filter"); v != "" {
+		q, err := common.ParseQuery(v)
+		if err != nil {
+			return nil, err
+		}
+		f.query = q
+	}
+	if v := r.URL.Query().Get("nick"); v != "" {
+		f.nicks = make(map[string]struct{})
+		for _, nick := range strings.Split(v, ",") {
+			f.nicks[strings.ToLower(strings.TrimSpace(nick))] = struct{}{}
+		}
+	}
+	return f, nil
+}
+
+// match returns the message of a line passing the filter
+func (f *liveFilter) match(line []byte) (*common.Message, bool) {
+	m, err := common.ParseMessageLine(string(line))
+	if err != nil {
+		return nil, false
+	}
+	if f.nicks != nil {
+		if _, ok := f.nicks[strings.ToLower(m.Nick)]; !ok {
+			return nil, false
+		}
+	}
+	if f.query != nil {
+		// lines arrive slowly, the budget only guards each line
+		f.query.ResetBudget()
+		if !f.query.MatchMessage(m) {
+			return nil, false
+		}
+	}
+	return m, true
+}
+
+func liveEvent(m *common.Message) []byte {
+	data, _ := json.Marshal(api.SearchResult{
+		Timestamp: m.Time.Unix(),
+		Nick:      m.Nick,
+		Text:      m.Data,
+	})
+	return data
+}
+
+// LiveAPIHandle streams new lines of a channel as json objects
+// - websocket when the request is an upgrade, server-sent events otherwise
+// - nick (comma separated) and filter (see common.ParseQuery) queries
+func LiveAPIHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channelPath := filepath.Join(LogsPath, convertChannelCase(vars["channel"]))
+	if _, err := os.Stat(channelPath); err != nil {
+		serveAPIError(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	filter, err := newLiveFilter(r)
+	if err != nil {
+		serveAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lines := live.subscribe(channelPath)
+	if lines == nil {
+		serveAPIError(w, "too many live clients", http.StatusServiceUnavailable)
+		return
+	}
+	defer live.unsubscribe(channelPath, lines)
+
+	if websocket.IsWebSocketUpgrade(r) {
+		serveLiveWebSocket(w, r, lines, filter)
+		return
+	}
+	serveLiveEvents(w, r, lines, filter)
+}
+
+func serveLiveWebSocket(w http.ResponseWriter, r *http.Request, lines chan []byte, filter *liveFilter) {
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// the client doesn't send anything, reading detects the close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(LivePingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(common.SocketWriteTimeout)); err != nil {
+				return
+			}
+		case line := <-lines:
+			m, ok := filter.match(line)
+			if !ok {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(common.SocketWriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, liveEvent(m)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveLiveEvents streams server-sent events. The connection is hijacked so
+// the server write timeout doesn't end the stream.
+func serveLiveEvents(w http.ResponseWriter, r *http.Request, lines chan []byte, filter *liveFilter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		serveAPIError(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Time{})
+
+	write := func(s string) bool {
+		conn.SetWriteDeadline(time.Now().Add(common.SocketWriteTimeout))
+		if _, err := rw.WriteString(s); err != nil {
+			return false
+		}
+		return rw.Flush() == nil
+	}
+	if !write("HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/event-stream\r\n" +
+		"Cache-Control: no-cache\r\n" +
+		"X-Accel-Buffering: no\r\n" +
+		"Connection: close\r\n\r\n" +
+		"retry: 5000\n\n") {
+		return
+	}
+
+	// the client doesn't send anything, reading detects the close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		buf := make([]byte, 512)
+		for {
+			if _, err := rw.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(LivePingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if !write(": ping\n\n") {
+				return
+			}
+		case line := <-lines:
+			m, ok := filter.match(line)
+			if !ok {
+				continue
+			}
+			if !write(fmt.Sprintf("data: %s\n\n", liveEvent(m))) {
+				return
+			}
+		}
+	}
+}
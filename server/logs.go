@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/api"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxLogsPageSize maximum number of messages in a logs api page
+const MaxLogsPageSize = 1000
+
+// errors
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// logsQuery pagination and filters shared by the logs api handlers
+type logsQuery struct {
+	cursor logsCursor
+	limit  int
+	from   time.Time
+	to     time.Time
+	query  *common.Query
+}
+
+// logsCursor position of the next message, line number n of the log of date
+type logsCursor struct {
+	date string
+	n    int
+}
+
+func (c logsCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.date + ":" + strconv.Itoa(c.n)))
+}
+
+func parseLogsCursor(v string) (logsCursor, error) {
+	if v == "" {
+		return logsCursor{}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return logsCursor{}, ErrInvalidCursor
+	}
+	i := bytes.IndexByte(b, ':')
+	if i == -1 {
+		return logsCursor{}, ErrInvalidCursor
+	}
+	date := string(b[:i])
+	if _, err := time.Parse(common.MessageDateLayout, date); err != nil {
+		return logsCursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.Atoi(string(b[i+1:]))
+	if err != nil || n < 0 {
+		return logsCursor{}, ErrInvalidCursor
+	}
+	return logsCursor{date: date, n: n}, nil
+}
+
+// parseLogsTime parses unix seconds or RFC 3339 timestamps
+func parseLogsTime(v string) (time.Time, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func parseLogsQuery(r *http.Request) (*logsQuery, error) {
+	query := r.URL.Query()
+	q := &logsQuery{}
+
+	var err error
+	if v := query.Get("filter"); v != "" {
+		if q.query, err = common.ParseQuery(v); err != nil {
+			return nil, err
+		}
+	}
+	if q.cursor, err = parseLogsCursor(query.Get("cursor")); err != nil {
+		return nil, err
+	}
+	if q.limit, err = parseIntQuery(query.Get("limit"), 100); err != nil || q.limit < 1 {
+		return nil, errors.New("limit query is not a positive integer")
+	}
+	if q.limit > MaxLogsPageSize {
+		q.limit = MaxLogsPageSize
+	}
+	if v := query.Get("from"); v != "" {
+		if q.from, err = parseLogsTime(v); err != nil {
+			return nil, errors.New("invalid from time")
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if q.to, err = parseLogsTime(v); err != nil {
+			return nil, errors.New("invalid to time")
+		}
+	}
+	if !q.from.IsZero() && !q.to.IsZero() && q.from.After(q.to) {
+		return nil, errors.New("from is after to")
+	}
+	return q, nil
+}
+
+// inRange checks the message time against the from and to bounds
+func (q *logsQuery) inRange(t time.Time) bool {
+	if !q.from.IsZero() && t.Before(q.from) {
+		return false
+	}
+	if !q.to.IsZero() && t.After(q.to) {
+		return false
+	}
+	return true
+}
+
+// dayInRange checks if any message of date can be within the bounds
+func (q *logsQuery) dayInRange(date string) bool {
+	day, err := time.Parse(common.MessageDateLayout, date)
+	if err != nil {
+		return false
+	}
+	if !q.from.IsZero() && day.AddDate(0, 0, 1).Before(q.from) {
+		return false
+	}
+	if !q.to.IsZero() && day.After(q.to) {
+		return false
+	}
+	return true
+}
+
+// collect appends the messages of a day log matching match and the filter
+// query to the payload, starting at line start. It returns false once the
+// page is full.
+func (q *logsQuery) collect(p *api.Logs, path, date string, start int, match func(*common.Message) bool) (bool, error) {
+	data, first, err := openLogFileAt(path, start, q.from)
+	if err != nil {
+		return true, err
+	}
+	defer data.Close()
+	reader := common.NewLineReader(data)
+	for n := first; ; n++ {
+		line, err := reader.Next()
+		if err != nil {
+			if err != io.EOF {
+				log.Errorf("error reading bytes %s", err)
+			}
+			return true, nil
+		}
+		if n < start {
+			continue
+		}
+		m, err := common.ParseMessageLine(strings.TrimSuffix(string(line), "\n"))
+		if err != nil {
+			continue
+		}
+		if !q.inRange(m.Time) || !match(m) {
+			continue
+		}
+		if q.query != nil && !q.query.MatchMessage(m) {
+			if err := q.query.Err(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if len(p.Messages) == q.limit {
+			p.Next = logsCursor{date: date, n: n}.String()
+			return false, nil
+		}
+		m.Type = "MSG"
+		m.Channel = p.Channel
+		p.Messages = append(p.Messages, m)
+	}
+}
+
+func serveLogsError(w http.ResponseWriter, err error) {
+	switch err {
+	case common.ErrQueryBudgetExceeded:
+		serveAPIError(w, err.Error(), http.StatusUnprocessableEntity)
+	case ErrNotFound:
+		serveAPIError(w, err.Error(), http.StatusNotFound)
+	default:
+		serveAPIError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// DayAPIHandle parsed messages of a day log
+// - cursor, limit, from, to (unix seconds or RFC 3339), filter
+func DayAPIHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	q, err := parseLogsQuery(r)
+	if err != nil {
+		serveAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date := vars["date"]
+	if q.cursor.date != "" && q.cursor.date != date {
+		serveAPIError(w, ErrInvalidCursor.Error(), http.StatusBadRequest)
+		return
+	}
+
+	channel := convertChannelCase(vars["channel"])
+	payload := api.Logs{
+		Channel:  strings.TrimSuffix(channel, " chatlog"),
+		Messages: []*common.Message{},
+	}
+	path := filepath.Join(LogsPath, channel, vars["month"], date)
+	if _, err := q.collect(&payload, path, date, q.cursor.n, func(*common.Message) bool { return true }); err != nil {
+		serveLogsError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-control", "max-age=60")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// UserAPIHandle parsed messages of a user in a month
+// - cursor, limit, from, to (unix seconds or RFC 3339), filter
+func UserAPIHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	q, err := parseLogsQuery(r)
+	if err != nil {
+		serveAPIError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	channel := convertChannelCase(vars["channel"])
+	nick, ok := userInMonth(channel, vars["nick"], vars["month"])
+	if !ok {
+		serveAPIError(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	monthPath := filepath.Join(LogsPath, channel, vars["month"])
+	logs, err := readLogDir(monthPath)
+	if err != nil {
+		serveAPIError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	payload := api.Logs{
+		Channel:  strings.TrimSuffix(channel, " chatlog"),
+		Messages: []*common.Message{},
+	}
+	isNick := func(m *common.Message) bool { return m.Nick == nick }
+	var last string
+	for _, name := range logs {
+		date := LogExtension.ReplaceAllString(name, "")
+		if date == last || date < q.cursor.date || !q.dayInRange(date) {
+			continue
+		}
+		last = date
+		dayPath := filepath.Join(monthPath, date)
+		nicks := common.NickList{}
+		if err := common.ReadNickList(nicks, dayPath+".nicks"); err == nil {
+			if _, ok := nicks[nick]; !ok {
+				continue
+			}
+		}
+		start := 0
+		if date == q.cursor.date {
+			start = q.cursor.n
+		}
+		more, err := q.collect(&payload, dayPath, date, start, isNick)
+		if err != nil {
+			serveLogsError(w, err)
+			return
+		}
+		if !more {
+			break
+		}
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Cache-control", "max-age=60")
+	_ = json.NewEncoder(w).Encode(payload)
+}
@@ -3,13 +3,12 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -24,6 +23,7 @@ import (
 	"time"
 
 	"github.com/CloudyKit/jet"
+	"github.com/b-ggs/overrustlelogs/api"
 	"github.com/b-ggs/overrustlelogs/common"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -34,8 +34,14 @@ const (
 	LogLinePrefixLength = len("[2017-01-10 08:57:47 UTC] ")
 	ViewsPath           = "./views"
 	MaxStalkLines       = 200
+	MaxSearchDays       = 366
+	MaxSearchResults    = 1000
 )
 
+// QueryTruncatedTrailer trailer of filtered text logs cut short by the
+// filter's regex budget, filters that match nothing before fail with a 422
+const QueryTruncatedTrailer = "X-Query-Truncated"
+
 // errors
 var (
 	ErrUserNotFound      = errors.New("didn't find any logs for this user")
@@ -44,6 +50,7 @@ var (
 	ErrSearchKeyNotFound = errors.New("didn't find what you were looking for")
 	ErrNoSubscribers     = errors.New("no subscribers for this month")
 	ErrNoMentions        = errors.New("couldn't find any mentions")
+	ErrNoSearchTerms     = errors.New("no search terms supplied")
 )
 
 // log file extension pattern
@@ -53,11 +60,6 @@ var (
 	LogsPath       = "/logs"
 )
 
-// APIError ...
-type APIError struct {
-	Message string `json:"message"`
-}
-
 var dev = false
 
 var view *jet.Set
@@ -65,11 +67,12 @@ var view *jet.Set
 func init() {
 	flag.BoolVar(&dev, "dev", false, "for jet template hot reloading and local asset loading")
 	flag.StringVar(&LogsPath, "logs", "/logs", "logs path for easier development")
-	flag.Parse()
+	flag.StringVar(&LoggerURL, "logger", LoggerURL, "logger http address for health reports, empty to disable")
 }
 
 // Start server
 func main() {
+	flag.Parse()
 	log.SetFormatter(&log.TextFormatter{
 		ForceColors:   true,
 		FullTimestamp: true,
@@ -78,14 +81,37 @@ func main() {
 	view.SetDevelopmentMode(dev)
 	setupViewGlobals()
 
+	srv := &http.Server{
+		Addr:         ":8080",
+		Handler:      newRouter(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil {
+			log.Errorf("%v", err)
+		}
+	}()
+
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	<-sigint
+	log.Info("i love you guys, be careful")
+	os.Exit(0)
+}
+
+// newRouter registers the page and api routes
+func newRouter() *mux.Router {
 	r := mux.NewRouter()
 	r.Use(logger)
+	r.Use(instrument)
 	r.StrictSlash(true)
 	r.HandleFunc("/", BaseHandle).Methods("GET")
 	r.HandleFunc("/contact", ContactHandle).Methods("GET")
 	r.HandleFunc("/changelog", ChangelogHandle).Methods("GET")
 	r.HandleFunc("/stalk", StalkerHandle).Methods("GET").Queries("channel", "{channel:[a-zA-Z0-9_-]+}", "nick", "{nick:@?[a-zA-Z0-9_-]+}")
 	r.HandleFunc("/stalk", StalkerHandle).Methods("GET")
+	r.HandleFunc("/user/{nick:[a-zA-Z0-9_-]{1,25}}", UserProfileHandle).Methods("GET")
 	r.HandleFunc("/mentions/{nick:[a-zA-Z0-9_-]{1,25}}.txt", MentionsHandle).Methods("GET").Queries("date", "{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}")
 	r.HandleFunc("/mentions/{nick:[a-zA-Z0-9_-]{1,25}}.txt", MentionsHandle).Methods("GET")
 	r.HandleFunc("/mentions/{nick:[a-zA-Z0-9_-]{1,25}}", MentionsWrapperHandle).Methods("GET").Queries("date", "{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}")
@@ -101,6 +127,7 @@ func main() {
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}", WrapperHandle).Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/top{limit:[0-9]{1,9}}", TopListHandle).Methods("GET").Queries("sort", "{sort:[a-z]+}")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/top{limit:[0-9]{1,9}}", TopListHandle).Methods("GET")
+	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/emotes", EmotesHandle).Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/userlogs", UsersHandle).Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/userlogs/{nick:[a-zA-Z0-9_-]{1,25}}.txt", UserHandle).Queries("filter", "{filter:.+}").Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/userlogs/{nick:[a-zA-Z0-9_-]{1,25}}.txt", UserHandle).Methods("GET")
@@ -114,52 +141,46 @@ func main() {
 	r.HandleFunc("/Destinygg chatlog/{month:[a-zA-Z]+ [0-9]{4}}/subscribers.txt", DestinySubscriberHandle).Methods("GET").Queries("filter", "{filter:.+}").Methods("GET")
 	r.HandleFunc("/Destinygg chatlog/{month:[a-zA-Z]+ [0-9]{4}}/subscribers.txt", DestinySubscriberHandle).Methods("GET")
 	r.HandleFunc("/Destinygg chatlog/{month:[a-zA-Z]+ [0-9]{4}}/subscribers", WrapperHandle).Methods("GET")
-	r.HandleFunc("/Destinygg chatlog/{month:[a-zA-Z]+ [0-9]{4}}/bans.txt", DestinyBanHandle).Methods("GET").Queries("filter", "{filter:.+}").Methods("GET")
-	r.HandleFunc("/Destinygg chatlog/{month:[a-zA-Z]+ [0-9]{4}}/bans.txt", DestinyBanHandle).Methods("GET")
-	r.HandleFunc("/Destinygg chatlog/{month:[a-zA-Z]+ [0-9]{4}}/bans", WrapperHandle).Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/broadcaster.txt", BroadcasterHandle).Methods("GET").Queries("filter", "{filter:.+}").Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/broadcaster.txt", BroadcasterHandle).Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/broadcaster", WrapperHandle).Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/subscribers.txt", SubscriberHandle).Methods("GET").Queries("filter", "{filter:.+}").Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/subscribers.txt", SubscriberHandle).Methods("GET")
 	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/subscribers", WrapperHandle).Methods("GET")
+	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/bans.txt", BanHandle).Methods("GET").Queries("filter", "{filter:.+}").Methods("GET")
+	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/bans.txt", BanHandle).Methods("GET")
+	r.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/bans", WrapperHandle).Methods("GET")
+	r.Handle("/metrics", common.Metrics.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", HealthHandle).Methods("GET")
+	r.HandleFunc("/readyz", ReadyHandle).Methods("GET")
 	r.NotFoundHandler = http.HandlerFunc(NotFoundHandle)
 	if dev || os.Getenv("DEV") == "true" {
 		r.PathPrefix("/assets/").Handler(http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets"))))
 	}
 
-	api := r.PathPrefix("/api/v1").Subrouter()
-	api.HandleFunc("/channels.json", ChannelsAPIHandle).Methods("GET")
-	api.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/months.json", MonthsAPIHandle).Methods("GET")
-	api.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/days.json", DaysAPIHandle).Methods("GET")
-	api.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/users.json", UsersAPIHandle).Methods("GET")
-	api.HandleFunc("/{channel:[a-zA-Z0-9_-]+} chatlog/{month:[a-zA-Z]+ [0-9]{4}}/lines.json", LinesAPIHandle).Methods("GET")
-	api.HandleFunc("/stalk/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", StalkHandle).Queries("limit", "{limit:[0-9]+}").Methods("GET")
-	api.HandleFunc("/stalk/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", StalkHandle).Methods("GET")
-	api.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Queries("date", "{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}", "limit", "{limit:[0-9]+}").Methods("GET")
-	api.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Queries("limit", "{limit:[0-9]+}").Methods("GET")
-	api.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Queries("date", "{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}").Methods("GET")
-	api.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Methods("GET")
-	api.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/top{limit:[0-9]{1,9}}.json", TopListAPIHandle).Methods("GET").Queries("sort", "{sort:[a-z]+}")
-	api.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/top{limit:[0-9]{1,9}}.json", TopListAPIHandle).Methods("GET")
-
-	srv := &http.Server{
-		Addr:         ":8080",
-		Handler:      r,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-	}
-	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			log.Errorf("%v", err)
-		}
-	}()
-
-	sigint := make(chan os.Signal, 1)
-	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
-	<-sigint
-	log.Info("i love you guys, be careful")
-	os.Exit(0)
+	v1 := r.PathPrefix("/api/v1").Subrouter()
+	v1.HandleFunc("/openapi.json", OpenAPIHandle).Methods("GET")
+	v1.HandleFunc("/channels.json", ChannelsAPIHandle).Methods("GET")
+	v1.HandleFunc("/search", SearchAPIHandle).Methods("GET")
+	v1.HandleFunc("/users/{nick:[a-zA-Z0-9_-]{1,25}}.json", UserProfileAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/live", LiveAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/months.json", MonthsAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/days.json", DaysAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/users.json", UsersAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/users/{nick:[a-zA-Z0-9_-]{1,25}}.json", UserAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/stats.json", StatsAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/emotes.json", EmotesAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+}/{month:[a-zA-Z]+ [0-9]{4}}/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}.json", DayAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+} chatlog/{month:[a-zA-Z]+ [0-9]{4}}/lines.json", LinesAPIHandle).Methods("GET")
+	v1.HandleFunc("/stalk/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", StalkHandle).Queries("limit", "{limit:[0-9]+}").Methods("GET")
+	v1.HandleFunc("/stalk/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", StalkHandle).Methods("GET")
+	v1.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Queries("date", "{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}", "limit", "{limit:[0-9]+}").Methods("GET")
+	v1.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Queries("limit", "{limit:[0-9]+}").Methods("GET")
+	v1.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Queries("date", "{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}").Methods("GET")
+	v1.HandleFunc("/mentions/{channel:[a-zA-Z0-9_-]+}/{nick:[a-zA-Z0-9_-]+}.json", MentionsAPIHandle).Methods("GET")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/top{limit:[0-9]{1,9}}.json", TopListAPIHandle).Methods("GET").Queries("sort", "{sort:[a-z]+}")
+	v1.HandleFunc("/{channel:[a-zA-Z0-9_-]+ chatlog}/{month:[a-zA-Z]+ [0-9]{4}}/top{limit:[0-9]{1,9}}.json", TopListAPIHandle).Methods("GET")
+	return r
 }
 
 func setupViewGlobals() {
@@ -190,6 +211,51 @@ func logger(h http.Handler) http.Handler {
 	})
 }
 
+var requestDuration = common.Metrics.Histogram("orl_server_request_duration_seconds", "HTTP request latency by route.", common.DefaultBuckets, "route", "method", "code")
+
+// instrument records the request latency per route template
+func instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		route := "unknown"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		requestDuration.Observe(time.Since(start).Seconds(), route, r.Method, strconv.Itoa(sw.status))
+	})
+}
+
+// statusWriter records the response status code
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush implements http.Flusher
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	return h.Hijack()
+}
+
 // NotFoundHandle channel index
 func NotFoundHandle(w http.ResponseWriter, r *http.Request) {
 	serveError(w, ErrNotFound)
@@ -285,10 +351,7 @@ func MonthHandle(w http.ResponseWriter, r *http.Request) {
 		serveError(w, err)
 		return
 	}
-	metaPaths := []string{"userlogs", "broadcaster.txt", "subscribers.txt"}
-	if vars["channel"] == "Destinygg chatlog" {
-		metaPaths = append(metaPaths, "bans.txt")
-	}
+	metaPaths := []string{"userlogs", "broadcaster.txt", "subscribers.txt", "bans.txt"}
 	sort.Sort(byDay(paths))
 	paths = append(paths, metaPaths...)
 	copy(paths[len(metaPaths):], paths)
@@ -302,35 +365,55 @@ func MonthHandle(w http.ResponseWriter, r *http.Request) {
 // DayHandle channel index
 func DayHandle(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	data, err := readLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), vars["month"], vars["date"]))
+	f, err := statLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), vars["month"], vars["date"]))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	_, ok := vars["filter"]
+	if !ok {
+		serveLogFile(w, r, f, vars["date"])
+		return
+	}
 
-	w.Header().Set("Content-type", "text/plain; charset=UTF-8")
-	w.Header().Set("Cache-control", "max-age=60")
-	var ok bool
-	var filter = func(l []byte, f string) bool { return true }
-	if _, ok = vars["filter"]; ok {
-		filter = filterKey
+	query, err := common.ParseQuery(vars["filter"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	w.Header().Set("Cache-control", f.cacheControl(vars["date"], time.Now()))
+	w.Header().Set("ETag", f.etag(""))
+	if checkNotModified(w, r, f.etag(""), f.ModTime()) {
+		return
+	}
+	data, err := openLogFile(f.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer data.Close()
+
+	w.Header().Set("Content-type", "text/plain; charset=UTF-8")
+	w.Header().Set("Trailer", QueryTruncatedTrailer)
 	var lineCount int
-	reader := bufio.NewReaderSize(bytes.NewReader(data), len(data))
+	reader := common.NewLineReader(data)
 	for {
-		line, err := reader.ReadSlice('\n')
+		line, err := reader.Next()
 		if err != nil {
 			if err != io.EOF {
 				log.Errorf("error reading bytes %s", err)
 			}
 			break
 		}
-		if filter(line, vars["filter"]) {
+		if query.Match(string(line)) {
 			_, _ = w.Write(line)
 			lineCount++
 		}
 	}
-	if lineCount == 0 && ok {
+	if serveQueryErr(w, query, lineCount) {
+		return
+	}
+	if lineCount == 0 {
 		http.Error(w, ErrSearchKeyNotFound.Error(), http.StatusNotFound)
 	}
 }
@@ -372,10 +455,10 @@ func UserHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if _, ok := vars["filter"]; ok {
-		serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), searchKey(nick, vars["filter"]))
+		serveSearchLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nick, vars["filter"])
 		return
 	}
-	serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
+	serveFilteredLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
 }
 
 func userInMonth(channel, nick, month string) (string, bool) {
@@ -401,10 +484,10 @@ func BroadcasterHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if _, ok := vars["filter"]; ok {
-		serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), searchKey(nick, vars["filter"]))
+		serveSearchLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nick, vars["filter"])
 		return
 	}
-	serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
+	serveFilteredLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
 }
 
 // SubscriberHandle channel index
@@ -417,10 +500,10 @@ func SubscriberHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if _, ok := vars["filter"]; ok {
-		serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), searchKey(nick, vars["filter"]))
+		serveSearchLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nick, vars["filter"])
 		return
 	}
-	serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
+	serveFilteredLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
 }
 
 // DestinyBroadcasterHandle destiny logs
@@ -433,10 +516,10 @@ func DestinyBroadcasterHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if _, ok := vars["filter"]; ok {
-		serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), searchKey(nick, vars["filter"]))
+		serveSearchLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nick, vars["filter"])
 		return
 	}
-	serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
+	serveFilteredLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
 }
 
 // DestinySubscriberHandle destiny subscriber logs
@@ -449,26 +532,26 @@ func DestinySubscriberHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if _, ok := vars["filter"]; ok {
-		serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), searchKey(nick, vars["filter"]))
+		serveSearchLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nick, vars["filter"])
 		return
 	}
-	serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
+	serveFilteredLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
 }
 
-// DestinyBanHandle channel ban list
-func DestinyBanHandle(w http.ResponseWriter, r *http.Request) {
+// BanHandle channel ban list
+func BanHandle(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	vars["channel"] = "Destinygg chatlog"
+	vars["channel"] = convertChannelCase(vars["channel"])
 	nick, ok := userInMonth(vars["channel"], "Ban", vars["month"])
 	if !ok {
 		http.Error(w, ErrUserNotFound.Error(), http.StatusInternalServerError)
 		return
 	}
 	if _, ok := vars["filter"]; ok {
-		serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), searchKey(nick, vars["filter"]))
+		serveSearchLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nick, vars["filter"])
 		return
 	}
-	serveFilteredLogs(w, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
+	serveFilteredLogs(w, r, filepath.Join(LogsPath, vars["channel"], vars["month"]), nickFilter(nick))
 }
 
 // CurrentBaseHandle shows the most recent months logs directly on the subdomain
@@ -557,15 +640,15 @@ func MentionsWrapperHandle(w http.ResponseWriter, r *http.Request) {
 			Name: day.Format("2006-01-02"),
 		}
 		payload.Days = append(payload.Days, &d)
-		data, err := readLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), day.Format("January 2006"), day.Format("2006-01-02")))
+		data, err := openLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), day.Format("January 2006"), day.Format("2006-01-02")))
 		if err != nil {
 			d.Log = err.Error()
 			continue
 		}
 		var lineCount int
-		reader := bufio.NewReaderSize(bytes.NewReader(data), len(data))
+		reader := common.NewLineReader(data)
 		for {
-			line, err := reader.ReadSlice('\n')
+			line, err := reader.Next()
 			if err != nil {
 				if err != io.EOF {
 					log.Errorf("error reading bytes %s", err)
@@ -577,6 +660,7 @@ func MentionsWrapperHandle(w http.ResponseWriter, r *http.Request) {
 				lineCount++
 			}
 		}
+		data.Close()
 		if lineCount == 0 {
 			d.Log = ErrNoMentions.Error()
 		}
@@ -609,16 +693,17 @@ func MentionsHandle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "can't look into the future", http.StatusNotFound)
 		return
 	}
-	data, err := readLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), t.Format("January 2006"), t.Format("2006-01-02")))
+	data, err := openLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), t.Format("January 2006"), t.Format("2006-01-02")))
 	if err != nil {
 		http.Error(w, ErrDayNotFound.Error(), http.StatusNotFound)
 		return
 	}
+	defer data.Close()
 	w.Header().Set("Content-type", "text/plain; charset=UTF-8")
 	var lineCount int
-	reader := bufio.NewReaderSize(bytes.NewReader(data), len(data))
+	reader := common.NewLineReader(data)
 	for {
-		line, err := reader.ReadSlice('\n')
+		line, err := reader.Next()
 		if err != nil {
 			if err != io.EOF {
 				log.Errorf("error reading bytes %s", err)
@@ -641,7 +726,7 @@ func isMentioned(nick, line []byte) bool {
 	if err != nil {
 		return false
 	}
-	parts := strings.Split(msg.Data, " ")
+	parts := strings.Fields(msg.Data)
 	for _, part := range parts {
 		if strings.EqualFold(part, string(nick)) {
 			return true
@@ -673,65 +758,42 @@ func MentionsAPIHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := readLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), t.Format("January 2006"), t.Format("2006-01-02")))
-	if err != nil {
-		serveAPIError(w, ErrDayNotFound.Error(), http.StatusNotFound)
-		return
-	}
-
-	var lines [][]byte
-	reader := bufio.NewReaderSize(bytes.NewReader(data), len(data))
-	for {
-		line, err := reader.ReadSlice('\n')
-		if err != nil {
-			if err != io.EOF {
-				log.Errorf("error reading bytes %s", err)
-			}
-			break
-		}
-		if isMentioned([]byte(vars["nick"]), line) {
-			lines = append(lines, line)
-		}
-	}
-	if len(lines) == 0 {
-		serveAPIError(w, ErrNoMentions.Error(), http.StatusNotFound)
-		return
-	}
-
 	var limit int
-	_, ok := vars["limit"]
-	if !ok {
-		limit = len(lines)
-	} else {
+	if _, ok := vars["limit"]; ok {
 		l, err := strconv.Atoi(vars["limit"])
 		if err != nil {
 			log.Error(err)
 			serveAPIError(w, "limit query is not a integer", http.StatusBadRequest)
 			return
 		}
-		limit = l
+		if l > 0 {
+			limit = l
+		}
 	}
 
-	var buf = lines
-	if len(lines)-limit > 0 {
-		buf = lines[len(lines)-limit:]
+	lines, err := lastLines(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), t.Format("January 2006"), t.Format("2006-01-02")), limit, func(line []byte) bool {
+		return isMentioned([]byte(vars["nick"]), line)
+	})
+	if err == ErrNotFound {
+		serveAPIError(w, ErrDayNotFound.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Errorf("error reading bytes %s", err)
 	}
-
-	type msg struct {
-		Date int64  `json:"date"`
-		Text string `json:"text"`
-		Nick string `json:"nick"`
+	if len(lines) == 0 {
+		serveAPIError(w, ErrNoMentions.Error(), http.StatusNotFound)
+		return
 	}
 
-	mentions := make([]msg, 0)
-	for _, line := range buf {
+	mentions := make([]api.Mention, 0)
+	for _, line := range lines {
 		t, err := time.Parse("2006-01-02 15:04:05 MST", string(line[1:24]))
 		if err != nil {
 			continue
 		}
 
 		i := bytes.Index(line[LogLinePrefixLength:], []byte(":"))
-		data := msg{
+		data := api.Mention{
 			Date: t.Unix(),
 			Nick: string(line[LogLinePrefixLength : LogLinePrefixLength+i]),
 			Text: strings.TrimSpace(string(line[i+LogLinePrefixLength+2:])),
@@ -743,6 +805,13 @@ func MentionsAPIHandle(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(mentions)
 }
 
+// OpenAPIHandle serves the api description
+func OpenAPIHandle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = io.WriteString(w, api.OpenAPI)
+}
+
 // ChannelsAPIHandle lists the channels
 func ChannelsAPIHandle(w http.ResponseWriter, r *http.Request) {
 
@@ -786,14 +855,11 @@ func DaysAPIHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metaLogs := []string{"broadcaster.txt", "subscribers.txt"}
-	if strings.EqualFold(convertChannelCase(vars["channel"]), "destinygg") {
-		metaLogs = append(metaLogs, "bans.txt")
-	}
+	metaLogs := []string{"broadcaster.txt", "subscribers.txt", "bans.txt"}
 
 	var temp []string
 	for _, v := range files {
-		if strings.Contains(v, ".nicks") {
+		if !LogExtension.MatchString(v) {
 			continue
 		}
 		if strings.Contains(v, ".gz") {
@@ -819,27 +885,23 @@ func LinesAPIHandle(w http.ResponseWriter, r *http.Request) {
 		serveAPIError(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	var temp linesData
+	var temp api.Lines
 	for _, v := range files {
 		if strings.Contains(v, ".nicks") {
 			continue
 		}
 		if strings.Contains(v, ".txt.gz") {
-			b, err := readLogFile(filepath.Join(monthPath, v))
+			lines, err := countLines(filepath.Join(monthPath, v))
 			if err != nil {
 				continue
 			}
-			lines := bytes.Count(b, []byte("\n"))
 			df := "2006-01-02"
 			d, err := time.Parse(df, v[:len(df)])
 			if err != nil {
 				continue
 			}
 			date := d.UTC().UTC().Format("2006-01-02T15:04:05-0700")
-			temp.Data = append(temp.Data, struct {
-				Date  string `json:"date"`
-				Lines int    `json:"lines"`
-			}{Date: date, Lines: lines})
+			temp.Data = append(temp.Data, api.DayLines{Date: date, Lines: lines})
 		}
 	}
 	sort.Sort(ByDate(temp))
@@ -849,14 +911,7 @@ func LinesAPIHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 // ByDate ...
-type ByDate linesData
-
-type linesData struct {
-	Data []struct {
-		Date  string `json:"date"`
-		Lines int    `json:"lines"`
-	} `json:"data"`
-}
+type ByDate api.Lines
 
 func (a ByDate) Len() int      { return len(a.Data) }
 func (a ByDate) Swap(i, j int) { a.Data[i], a.Data[j] = a.Data[j], a.Data[i] }
@@ -925,29 +980,16 @@ ScanLogs:
 			serveAPIError(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		data, err := readLogFile(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), rs.Month(), rs.Day()))
-		if err != nil {
+		lines, err := lastLines(filepath.Join(LogsPath, convertChannelCase(vars["channel"]), rs.Month(), rs.Day()), int(index), nickFilter(rs.Nick()))
+		if err == ErrNotFound {
 			serveAPIError(w, err.Error(), http.StatusNotFound)
 			return
-		}
-		var lines [][]byte
-		r := bufio.NewReaderSize(bytes.NewReader(data), len(data))
-		filter := nickFilter(rs.Nick())
-		for {
-			line, err := r.ReadSlice('\n')
-			if err != nil {
-				if err != io.EOF {
-					log.Errorf("error reading bytes %s", err)
-				}
-				break
-			}
-			if filter(line) {
-				lines = append(lines, line[0:len(line)-1])
-			}
+		} else if err != nil {
+			log.Errorf("error reading bytes %s", err)
 		}
 		for i := len(lines) - 1; i >= 0; i-- {
 			index--
-			buf[index] = string(lines[i])
+			buf[index] = strings.TrimSuffix(string(lines[i]), "\n")
 			if index == 0 {
 				break ScanLogs
 			}
@@ -958,15 +1000,8 @@ ScanLogs:
 		serveAPIError(w, ErrUserNotFound.Error(), http.StatusNotFound)
 		return
 	}
-	type Line struct {
-		Timestamp int64  `json:"timestamp"`
-		Text      string `json:"text"`
-	}
-	data := struct {
-		Nick  string `json:"nick"`
-		Lines []Line `json:"lines"`
-	}{
-		Lines: []Line{},
+	data := api.Stalk{
+		Lines: []api.StalkLine{},
 	}
 	data.Nick = strings.ToLower(vars["nick"])
 	for i := int(index); i < len(buf); i++ {
@@ -975,7 +1010,7 @@ ScanLogs:
 			continue
 		}
 		ci := strings.Index(buf[i][LogLinePrefixLength:], ":")
-		data.Lines = append(data.Lines, Line{
+		data.Lines = append(data.Lines, api.StalkLine{
 			Timestamp: t.Unix(),
 			Text:      buf[i][ci+LogLinePrefixLength+2:],
 		})
@@ -1025,15 +1060,23 @@ func gzPath(path string) string {
 	return path
 }
 
+// readDirIndex sorted directory listing without dotfiles such as the nick
+// index
 func readDirIndex(path string) ([]string, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, ErrNotFound
 	}
-	names, err := f.Readdirnames(0)
+	files, err := f.Readdirnames(0)
 	if err != nil {
 		return nil, err
 	}
+	names := make([]string, 0, len(files))
+	for _, name := range files {
+		if !strings.HasPrefix(name, ".") {
+			names = append(names, name)
+		}
+	}
 	sort.Strings(names)
 	return names, nil
 }
@@ -1057,23 +1100,120 @@ func readLogDir(path string) ([]string, error) {
 	return names, nil
 }
 
-func readLogFile(path string) ([]byte, error) {
-	var buf []byte
+// openLogFile opens a day log for streaming, the .txt(.gz) extension is
+// optional
+func openLogFile(path string) (io.ReadCloser, error) {
 	path = LogExtension.ReplaceAllString(path, "")
-	buf, err := common.ReadCompressedFile(path + ".txt")
+	r, err := common.OpenCompressedFile(path + ".txt")
 	if os.IsNotExist(err) {
 		f, err := os.Open(path + ".txt")
 		if os.IsNotExist(err) {
 			return nil, ErrNotFound
 		}
-		buf, err = ioutil.ReadAll(f)
-		if err != nil {
-			return nil, err
+		return f, err
+	}
+	return r, err
+}
+
+// openLogFileAt opens a day log for streaming from the frame holding line
+// start and the first lines at or after from, seekable logs skip the frames
+// before. It returns the number of the first line read.
+func openLogFileAt(path string, start int, from time.Time) (io.ReadCloser, int, error) {
+	s, err := common.OpenSeekable(LogExtension.ReplaceAllString(path, "") + ".txt")
+	if err != nil {
+		f, err := openLogFile(path)
+		return f, 0, err
+	}
+	i := sort.Search(len(s.Frames), func(i int) bool { return s.Frames[i].Line > start }) - 1
+	if !from.IsZero() {
+		if j := s.SeekTime(from); j > i {
+			i = j
 		}
-	} else if err != nil {
+	}
+	if i < 0 {
+		i = 0
+	}
+	line := 0
+	if i < len(s.Frames) {
+		line = s.Frames[i].Line
+	}
+	return &seekableReader{s.FramesReader(i), s}, line, nil
+}
+
+// seekableReader frames reader closing its seekable log
+type seekableReader struct {
+	io.ReadCloser
+	s *common.SeekableFile
+}
+
+func (r *seekableReader) Close() error {
+	r.ReadCloser.Close()
+	return r.s.Close()
+}
+
+// lastLines returns up to limit of the last lines of a day log passing match
+// in file order, a limit of 0 returns every matching line. Seekable logs are
+// read backwards from their last frame.
+func lastLines(path string, limit int, match func([]byte) bool) ([][]byte, error) {
+	var lines [][]byte
+	if s, err := common.OpenSeekable(LogExtension.ReplaceAllString(path, "") + ".txt"); err == nil && limit > 0 {
+		defer s.Close()
+		err := s.ReadBackwards(func(line []byte) bool {
+			if match(line) {
+				lines = append(lines, append([]byte(nil), line...))
+			}
+			return len(lines) < limit
+		})
+		for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+			lines[i], lines[j] = lines[j], lines[i]
+		}
+		return lines, err
+	} else if err == nil {
+		s.Close()
+	}
+
+	f, err := openLogFile(path)
+	if err != nil {
 		return nil, err
 	}
-	return buf, nil
+	defer f.Close()
+	r := common.NewLineReader(f)
+	for {
+		line, err := r.Next()
+		if err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return lines, err
+		}
+		if !match(line) {
+			continue
+		}
+		if limit > 0 && len(lines) == limit {
+			copy(lines, lines[1:])
+			lines = lines[:limit-1]
+		}
+		lines = append(lines, append([]byte(nil), line...))
+	}
+}
+
+// countLines counts the newline terminated lines of a day log
+func countLines(path string) (int, error) {
+	f, err := openLogFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var n int
+	buf := make([]byte, 32<<10)
+	for {
+		c, err := f.Read(buf)
+		n += bytes.Count(buf[:c], []byte("\n"))
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
 }
 
 func nickFilter(nick string) func([]byte) bool {
@@ -1086,23 +1226,22 @@ func nickFilter(nick string) func([]byte) bool {
 	}
 }
 
-func searchKey(nick, filter string) func([]byte) bool {
+func searchKey(nick string, query *common.Query) func([]byte) bool {
 	return func(line []byte) bool {
-		msg, err := common.ParseMessageLine(string(line))
+		if query.Err() != nil {
+			return false
+		}
+		msg, err := common.ParseMessageLine(strings.TrimSuffix(string(line), "\n"))
 		if err != nil {
 			return false
 		}
 		if !strings.EqualFold(nick, msg.Nick) {
 			return false
 		}
-		return strings.Contains(strings.ToLower(msg.Data), strings.ToLower(filter))
+		return query.MatchMessage(msg)
 	}
 }
 
-func filterKey(line []byte, f string) bool {
-	return bytes.Contains(bytes.ToLower(line), bytes.ToLower([]byte(f)))
-}
-
 // serveError ...
 func serveError(w http.ResponseWriter, e error) {
 	tpl, err := view.GetTemplate("error")
@@ -1178,24 +1317,62 @@ func serveDirIndex(w http.ResponseWriter, base []string, paths []string) {
 	}
 }
 
-func serveFilteredLogs(w http.ResponseWriter, path string, filter func([]byte) bool) {
+// serveSearchLogs serves the lines of nick matching the filter query
+func serveSearchLogs(w http.ResponseWriter, r *http.Request, path, nick, filter string) {
+	query, err := common.ParseQuery(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if n := serveFilteredLogs(w, r, path, searchKey(nick, query)); n != -1 {
+		serveQueryErr(w, query, n)
+	}
+}
+
+// serveQueryErr reports a filter query that used up its regex budget after n
+// lines were written, with a 422 if none were and QueryTruncatedTrailer
+// otherwise. It returns whether the query ran out.
+func serveQueryErr(w http.ResponseWriter, query *common.Query, n int) bool {
+	err := query.Err()
+	if err == nil {
+		return false
+	}
+	if n == 0 {
+		w.Header().Del("Trailer")
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return true
+	}
+	w.Header().Set(QueryTruncatedTrailer, "true")
+	return true
+}
+
+// serveFilteredLogs serves the lines of the logs in path passing filter and
+// returns the number of lines written, or -1 if the client's copy is current
+func serveFilteredLogs(w http.ResponseWriter, r *http.Request, path string, filter func([]byte) bool) int {
 	logs, err := readLogDir(path)
 	if err != nil {
 		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
-		return
+		return 0
 	}
 
+	w.Header().Set("Cache-control", LiveCacheControl)
+	etag, modtime := logDirValidators(path, logs)
+	w.Header().Set("ETag", etag)
+	if checkNotModified(w, r, etag, modtime) {
+		return -1
+	}
 	w.Header().Set("Content-type", "text/plain; charset=UTF-8")
-	w.Header().Set("Cache-control", "max-age=60")
+	w.Header().Set("Trailer", QueryTruncatedTrailer)
+	var n int
 	for _, name := range logs {
-		data, err := readLogFile(filepath.Join(path, name))
+		data, err := openLogFile(filepath.Join(path, name))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return n
 		}
-		r := bufio.NewReaderSize(bytes.NewReader(data), len(data))
+		br := common.NewLineReader(data)
 		for {
-			line, err := r.ReadSlice('\n')
+			line, err := br.Next()
 			if err != nil {
 				if err != io.EOF {
 					log.Errorf("error reading bytes %s", err)
@@ -1204,16 +1381,19 @@ func serveFilteredLogs(w http.ResponseWriter, path string, filter func([]byte) b
 			}
 			if filter(line) {
 				_, _ = w.Write(line)
+				n++
 			}
 		}
+		data.Close()
 	}
+	return n
 }
 
 // serveAPIError servers a error with given message and status code
 func serveAPIError(w http.ResponseWriter, error string, code int) {
-	apiError := APIError{Message: error}
-	w.WriteHeader(code)
+	apiError := api.Error{Message: error}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(apiError)
 }
 
@@ -1259,28 +1439,17 @@ func TopListAPIHandle(w http.ResponseWriter, r *http.Request) {
 
 func getToplistPayload(channel, month, limitquery, sortquery string) (topListPayload, error) {
 	var tpl topListPayload
-	path := filepath.Join(LogsPath, convertChannelCase(channel), month, "toplist.json.gz")
+	path := filepath.Join(LogsPath, convertChannelCase(channel), month, common.TopListFile+".gz")
 
 	tpl.Breadcrumbs = append(tpl.Breadcrumbs, breadcrumb{"/" + channel, channel})
 	tpl.Breadcrumbs = append(tpl.Breadcrumbs, breadcrumb{"/" + channel + "/" + month, month})
 	tpl.Breadcrumbs = append(tpl.Breadcrumbs, breadcrumb{"/" + channel + "/" + month + "/top" + limitquery, "Top" + limitquery})
 
-	fi, err := os.Stat(path)
-	if err != nil {
-		return tpl, errors.New("check back at the end of the month")
-	}
-	tpl.Generated = fi.ModTime().UTC().Format("2006-01-02 15:04:05 MST")
-
-	data, err := common.ReadCompressedFile(path)
+	toplist, generated, err := readTopList(path)
 	if err != nil {
-		return tpl, errors.New("failed reading toplist file")
-	}
-
-	var toplist []*user
-	err = gob.NewDecoder(bytes.NewBuffer(data)).Decode(&toplist)
-	if err != nil {
-		return tpl, errors.New("failed decoding toplist file")
+		return tpl, err
 	}
+	tpl.Generated = generated.UTC().Format("2006-01-02 15:04:05 MST")
 	tpl.MaxLimit = len(toplist) - 1
 
 	limit := 100
@@ -1311,7 +1480,7 @@ func getToplistPayload(channel, month, limitquery, sortquery string) (topListPay
 		}
 		tpl.Sort = sortquery
 	}
-	tpl.TopList = toplist
+	tpl.Users = toplist
 
 	for _, u := range toplist {
 		u.KiloBytes = fmt.Sprintf("%.1f", float32(u.Bytes)/1024)
@@ -1325,32 +1494,49 @@ func getToplistPayload(channel, month, limitquery, sortquery string) (topListPay
 	return tpl, nil
 }
 
-type (
-	user struct {
-		Username   string
-		Lines      int
-		Bytes      int
-		Seen       int64
-		SeenString string
-		KiloBytes  string
+// readTopList reads the toplist at path and the time it was generated
+func readTopList(path string) ([]*api.TopListUser, time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, errors.New("check back at the end of the month")
 	}
+
+	t, err := common.ReadTopList(path)
+	if err != nil {
+		log.Error(err)
+		return nil, time.Time{}, errors.New("failed reading toplist file")
+	}
+
+	toplist := make([]*api.TopListUser, len(t.Users))
+	for i, u := range t.Users {
+		toplist[i] = &api.TopListUser{
+			Username: u.Username,
+			Lines:    u.Lines,
+			Bytes:    u.Bytes,
+			Seen:     u.Seen,
+		}
+	}
+	generated := fi.ModTime()
+	if t.Generated != 0 {
+		generated = time.Unix(t.Generated, 0)
+	}
+	return toplist, generated, nil
+}
+
+type (
 	topListPayload struct {
-		Sort        string       `json:"sort"`
-		Limit       int          `json:"limit"`
-		MaxLimit    int          `json:"maxLimit"`
+		api.TopList
 		Path        string       `json:"-"`
 		Breadcrumbs []breadcrumb `json:"-"`
-		Generated   string       `json:"generated"`
-		TopList     []*user      `json:"topList"`
 	}
 	breadcrumb struct {
 		Path string
 		Name string
 	}
 
-	byBytes    []*user
-	bySeen     []*user
-	byUsername []*user
+	byBytes    []*api.TopListUser
+	bySeen     []*api.TopListUser
+	byUsername []*api.TopListUser
 )
 
 func (a byBytes) Len() int           { return len(a) }
@@ -1395,6 +1581,10 @@ func StalkerHandle(w http.ResponseWriter, r *http.Request) {
 		serveError(w, fmt.Errorf("couldn't find channel: %s ", channel))
 		return
 	}
+	if search, err := common.NewNickSearch(path, nick); err == nil && search.Indexed() {
+		months = nil
+		spl.Months = search.Months()
+	}
 
 	workers := runtime.NumCPU()
 	monthChan := make(chan string, len(months))
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/api"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/gorilla/mux"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// profiles kept in memory and how long they're reused, building one reads
+// the nick lists or index and the toplists of every channel
+const (
+	ProfileCacheSize = 1024
+	ProfileCacheTTL  = time.Minute
+)
+
+// profileCache user profiles by lower case nick
+var profileCache, _ = lru.New(ProfileCacheSize)
+
+type cachedProfile struct {
+	built   time.Time
+	profile *api.UserProfile
+}
+
+// UserProfileHandle channels a nick spoke in
+func UserProfileHandle(w http.ResponseWriter, r *http.Request) {
+	nick := mux.Vars(r)["nick"]
+
+	t, err := view.GetTemplate("user")
+	if err != nil {
+		serveError(w, errors.New("failed loading user template"))
+		return
+	}
+
+	var upl userProfilePayload
+	upl.Profile, err = userProfile(nick)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if len(upl.Profile.Channels) == 0 {
+		upl.Error = fmt.Sprintf("Couldn't find Nick: %s in any channel", nick)
+	}
+	for _, c := range upl.Profile.Channels {
+		row := userChannelRow{
+			UserChannel: c,
+			FirstSeen:   formatSeen(c.FirstSeen),
+			LastSeen:    formatSeen(c.LastSeen),
+			KiloBytes:   kiloBytes(c.Bytes),
+		}
+		for _, m := range c.Months {
+			row.Months = append(row.Months, userMonthRow{m, kiloBytes(m.Bytes)})
+		}
+		upl.Channels = append(upl.Channels, row)
+	}
+
+	w.Header().Set("Content-type", "text/html")
+	w.Header().Set("Cache-control", LiveCacheControl)
+	if err := t.Execute(w, nil, upl); err != nil {
+		serveError(w, errors.New("failed executing user template"))
+	}
+}
+
+// UserProfileAPIHandle channels a nick spoke in
+func UserProfileAPIHandle(w http.ResponseWriter, r *http.Request) {
+	nick := mux.Vars(r)["nick"]
+	profile, err := userProfile(nick)
+	if err != nil {
+		serveAPIError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-control", LiveCacheControl)
+	if len(profile.Channels) == 0 {
+		serveAPIError(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	_ = json.NewEncoder(w).Encode(profile)
+}
+
+type (
+	userProfilePayload struct {
+		Profile  *api.UserProfile
+		Channels []userChannelRow
+		Error    string
+	}
+	userChannelRow struct {
+		api.UserChannel
+		Months                         []userMonthRow
+		FirstSeen, LastSeen, KiloBytes string
+	}
+	userMonthRow struct {
+		api.UserMonth
+		KiloBytes string
+	}
+)
+
+func formatSeen(t int64) string {
+	if t == 0 {
+		return "Unknown"
+	}
+	return time.Unix(t, 0).UTC().Format("2006-01-02 15:04:05 MST")
+}
+
+func kiloBytes(b int) string {
+	return fmt.Sprintf("%.1f", float32(b)/1024)
+}
+
+// userProfile returns the cached profile of nick, profiles are rebuilt once
+// they're older than ProfileCacheTTL
+func userProfile(nick string) (*api.UserProfile, error) {
+	key := strings.ToLower(nick)
+	if v, ok := profileCache.Get(key); ok && time.Since(v.(*cachedProfile).built) < ProfileCacheTTL {
+		return v.(*cachedProfile).profile, nil
+	}
+	profile, err := buildUserProfile(nick)
+	if err != nil {
+		return nil, err
+	}
+	profileCache.Add(key, &cachedProfile{time.Now(), profile})
+	return profile, nil
+}
+
+// buildUserProfile checks every channel for nick, the profile's nick takes
+// the case of the most recently active channel
+func buildUserProfile(nick string) (*api.UserProfile, error) {
+	channels, err := readDirIndex(LogsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &api.UserProfile{Nick: nick, Channels: []api.UserChannel{}}
+	nicks := map[string]string{}
+	workers := runtime.NumCPU()
+	channelChan := make(chan string, len(channels))
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	var profileMutex sync.Mutex
+	for i := 0; i < workers; i++ {
+		go func() {
+			for c := range channelChan {
+				uc, n, ok := userChannel(c, nick)
+				if ok {
+					profileMutex.Lock()
+					profile.Channels = append(profile.Channels, uc)
+					nicks[uc.Channel] = n
+					profileMutex.Unlock()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	for _, c := range channels {
+		if strings.HasSuffix(c, " chatlog") {
+			channelChan <- c
+		}
+	}
+	close(channelChan)
+	wg.Wait()
+
+	sort.Slice(profile.Channels, func(i, j int) bool {
+		a, b := profile.Channels[i], profile.Channels[j]
+		if a.LastSeen != b.LastSeen {
+			return a.LastSeen > b.LastSeen
+		}
+		return a.Channel < b.Channel
+	})
+	if len(profile.Channels) > 0 {
+		profile.Nick = nicks[profile.Channels[0].Channel]
+	}
+	return profile, nil
+}
+
+// userChannel activity of nick in the channel directory dir and the case of
+// its nick there. Months and seen times come from the nick index when it is
+// complete, otherwise from the daily nick lists with seen times rounded to
+// the day unless the month's toplist knows better.
+func userChannel(dir, nick string) (api.UserChannel, string, bool) {
+	uc := api.UserChannel{Channel: strings.TrimSuffix(dir, " chatlog")}
+	path := filepath.Join(LogsPath, dir)
+	search, err := common.NewNickSearch(path, nick)
+	if err != nil {
+		return uc, "", false
+	}
+
+	var months []string
+	if search.Indexed() {
+		months = search.Months()
+		if len(months) == 0 {
+			return uc, "", false
+		}
+		if e, err := common.NewNickIndex(path).Lookup(nick); err == nil && e != nil {
+			nick = e.Nick
+			uc.FirstSeen = e.Days[len(e.Days)-1].First
+			uc.LastSeen = e.Days[0].Last
+		}
+	} else {
+		all, err := readDirIndex(path)
+		if err != nil {
+			return uc, "", false
+		}
+		cases := map[string]string{}
+		for _, m := range all {
+			if n, err := search.Month(m); err == nil {
+				cases[m] = n
+				months = append(months, m)
+			}
+		}
+		if len(months) == 0 {
+			return uc, "", false
+		}
+		sort.Sort(byMonth(months))
+		nick = cases[months[0]]
+		if days := monthNickDays(path, months[len(months)-1], nick); len(days) > 0 {
+			uc.FirstSeen = days[0].Unix()
+		}
+		if days := monthNickDays(path, months[0], nick); len(days) > 0 {
+			uc.LastSeen = days[len(days)-1].Unix()
+		}
+	}
+
+	for _, m := range months {
+		um := api.UserMonth{
+			Month: m,
+			URL:   "/" + dir + "/" + m + "/userlogs/" + nick,
+		}
+		toplist, _, err := readTopList(filepath.Join(path, m, common.TopListFile+".gz"))
+		if err == nil {
+			for _, u := range toplist {
+				if strings.EqualFold(u.Username, nick) {
+					um.Lines = u.Lines
+					um.Bytes = u.Bytes
+					if u.Seen > uc.LastSeen {
+						uc.LastSeen = u.Seen
+					}
+					break
+				}
+			}
+		}
+		uc.Lines += um.Lines
+		uc.Bytes += um.Bytes
+		uc.Months = append(uc.Months, um)
+	}
+	return uc, nick, true
+}
+
+// monthNickDays dates of the days of month whose nick list holds nick,
+// oldest first
+func monthNickDays(path, month, nick string) []time.Time {
+	f, err := os.Open(filepath.Join(path, month))
+	if err != nil {
+		return nil
+	}
+	names, err := f.Readdirnames(0)
+	f.Close()
+	if err != nil {
+		return nil
+	}
+	sort.Strings(names)
+	var days []time.Time
+	for _, name := range names {
+		if !strings.Contains(name, ".nicks") || len(name) < 10 {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", name[:10])
+		if err != nil {
+			continue
+		}
+		nicks := common.NickListLower{}
+		if err := common.ReadNickList(nicks, filepath.Join(path, month, name)); err != nil {
+			continue
+		}
+		if _, ok := nicks[strings.ToLower(nick)]; ok {
+			days = append(days, date)
+		}
+	}
+	return days
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/api"
+	"github.com/b-ggs/overrustlelogs/common"
+	log "github.com/sirupsen/logrus"
+)
+
+var searchChannelPattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// SearchAPIHandle searches the indexed logs of a channel
+// - channel, q (required), nick, from, to (YYYY-MM-DD), offset, limit
+// - results are returned newest first
+func SearchAPIHandle(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	channel := query.Get("channel")
+	if !searchChannelPattern.MatchString(channel) {
+		serveAPIError(w, "invalid channel", http.StatusBadRequest)
+		return
+	}
+	terms := common.SearchTerms(query.Get("q"))
+	if len(terms) == 0 {
+		serveAPIError(w, ErrNoSearchTerms.Error(), http.StatusBadRequest)
+		return
+	}
+	nick := query.Get("nick")
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			serveAPIError(w, "invalid to date", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -30)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			serveAPIError(w, "invalid from date", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		serveAPIError(w, "from is after to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) > MaxSearchDays*24*time.Hour {
+		serveAPIError(w, "date range is too large", http.StatusBadRequest)
+		return
+	}
+
+	offset, err := parseIntQuery(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		serveAPIError(w, "offset query is not a positive integer", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseIntQuery(query.Get("limit"), 100)
+	if err != nil || limit < 1 {
+		serveAPIError(w, "limit query is not a positive integer", http.StatusBadRequest)
+		return
+	}
+	if limit > MaxSearchResults {
+		limit = MaxSearchResults
+	}
+
+	channelPath := filepath.Join(LogsPath, convertChannelCase(channel))
+	payload := api.SearchResults{
+		Channel: channel,
+		Results: []api.SearchResult{},
+	}
+	skip := offset
+
+ScanDays:
+	for day := to; !day.Before(from); day = day.AddDate(0, 0, -1) {
+		dayPath := filepath.Join(channelPath, day.Format("January 2006"), day.Format("2006-01-02"))
+		if nick != "" {
+			nicks := common.NickListLower{}
+			if err := common.ReadNickList(nicks, dayPath+".nicks"); err != nil {
+				continue
+			}
+			if _, ok := nicks[strings.ToLower(nick)]; !ok {
+				continue
+			}
+		}
+		matches, err := searchDay(dayPath, terms, nick)
+		if err != nil {
+			continue
+		}
+		for i := len(matches) - 1; i >= 0; i-- {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(payload.Results) == limit {
+				payload.Next = offset + limit
+				break ScanDays
+			}
+			payload.Results = append(payload.Results, api.SearchResult{
+				Timestamp: matches[i].Time.Unix(),
+				Nick:      matches[i].Nick,
+				Text:      matches[i].Data,
+			})
+		}
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// searchDay returns the lines of a day log containing all terms. The index
+// is read first, days it fully covers without candidates aren't read and
+// seekable logs are decompressed from the frame of the first candidate. Lines
+// past the end of the persisted index are matched directly.
+func searchDay(path string, terms []string, nick string) ([]*common.Message, error) {
+	f, err := statLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []uint32
+	var data io.ReadCloser
+	indexed, start := 0, 0
+	if index, complete := readDayIndex(path, f); index != nil {
+		candidates = index.Lookup(terms)
+		indexed = index.Lines()
+		switch {
+		case len(candidates) == 0 && complete:
+			return nil, nil
+		case len(candidates) == 0 && !f.compressed && index.Size() >= 0 && index.Size() <= f.Size():
+			data, err = openLogTail(f.path, index.Size())
+			start = indexed
+		case len(candidates) > 0:
+			data, start, err = openLogFileAt(path, int(candidates[0]), time.Time{})
+		}
+	}
+	if data == nil && err == nil {
+		data, err = openLogFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	var matches []*common.Message
+	reader := common.NewLineReader(data)
+	for n := start; ; n++ {
+		line, err := reader.Next()
+		if err != nil {
+			if err != io.EOF {
+				log.Errorf("error reading bytes %s", err)
+			}
+			break
+		}
+		if n < indexed {
+			for len(candidates) > 0 && int(candidates[0]) < n {
+				candidates = candidates[1:]
+			}
+			if len(candidates) == 0 || int(candidates[0]) != n {
+				continue
+			}
+		}
+		msg, err := common.ParseMessageLine(strings.TrimSuffix(string(line), "\n"))
+		if err != nil {
+			continue
+		}
+		if nick != "" && !strings.EqualFold(msg.Nick, nick) {
+			continue
+		}
+		if n >= indexed && !containsTerms(msg.Data, terms) {
+			continue
+		}
+		matches = append(matches, msg)
+	}
+	return matches, nil
+}
+
+// readDayIndex reads the search index of the day log f, complete if it covers
+// every line. Compressed logs are covered by indexes the logger wrote after
+// compressing them, plain logs by indexes of their size.
+func readDayIndex(path string, f *logFile) (*common.SearchIndex, bool) {
+	index, err := common.ReadSearchIndex(path + ".index")
+	if err != nil {
+		return nil, false
+	}
+	if !f.compressed {
+		return index, index.Size() == f.Size()
+	}
+	fi, err := os.Stat(path + ".index.gz")
+	return index, err == nil && !fi.ModTime().Before(f.ModTime())
+}
+
+// openLogTail opens a plain day log at offset
+func openLogTail(path string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func containsTerms(text string, terms []string) bool {
+	found := make(map[string]struct{})
+	for _, term := range common.SearchTerms(text) {
+		found[term] = struct{}{}
+	}
+	for _, term := range terms {
+		if _, ok := found[term]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func parseIntQuery(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+func TestSearchDay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrustlelogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log := "[2020-03-01 10:00:00 UTC] Bob: hello chat\n" +
+		"[2020-03-01 10:00:01 UTC] Alice: hi Bob\n"
+	index, err := common.BuildSearchIndex(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := filepath.Join(dir, "2020-03-01")
+	if _, err := common.WriteCompressedFile(past+".txt", []byte(log)); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.WriteTo(past + ".index"); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := statLogFile(past); f == nil {
+		t.Fatal("missing fixture log")
+	} else if _, complete := readDayIndex(past, f); !complete {
+		t.Error("index written after compressing doesn't cover the log")
+	}
+	if m, err := searchDay(past, []string{"hi"}, ""); err != nil || len(m) != 1 || m[0].Nick != "Alice" {
+		t.Errorf("search = %v %v", m, err)
+	}
+	if m, err := searchDay(past, []string{"missing"}, ""); err != nil || len(m) != 0 {
+		t.Errorf("search without candidates = %v %v", m, err)
+	}
+
+	// the live log grew since its index was written
+	live := filepath.Join(dir, "2020-03-02")
+	appended := "[2020-03-01 10:00:02 UTC] Carl: hi all\n"
+	if err := ioutil.WriteFile(live+".txt", []byte(log+appended), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.WriteTo(live + ".index"); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := searchDay(live, []string{"all"}, ""); err != nil || len(m) != 1 || m[0].Nick != "Carl" {
+		t.Errorf("search of appended lines = %v %v", m, err)
+	}
+	if m, err := searchDay(live, []string{"hi"}, ""); err != nil || len(m) != 2 {
+		t.Errorf("search of indexed and appended lines = %v %v", m, err)
+	}
+
+	// an index written before the log was compressed may be missing lines
+	stale := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(past+".index.gz", stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := statLogFile(past); f != nil {
+		if _, complete := readDayIndex(past, f); complete {
+			t.Error("stale index covers the log")
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/api"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/gorilla/mux"
+	lru "github.com/hashicorp/golang-lru"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatsCacheSize months whose stats are kept in memory
+const StatsCacheSize = 512
+
+// ErrNoStats month without day stats
+var ErrNoStats = errors.New("no stats for this month")
+
+// statsCache month stats by month path, entries are reused while the etag
+// of their sources matches
+var statsCache, _ = lru.New(StatsCacheSize)
+
+type cachedStats struct {
+	etag    string
+	modtime time.Time
+	stats   *api.Stats
+}
+
+// StatsAPIHandle serves the activity stats of a month, summed from the day
+// stats the logger writes next to the nick lists
+func StatsAPIHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channel := strings.Title(strings.ToLower(vars["channel"]))
+	channelPath := filepath.Join(LogsPath, channel+" chatlog")
+	c, err := monthStats(channelPath, channel, vars["month"])
+	if err == ErrNotFound || err == ErrNoStats {
+		serveAPIError(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Error(err)
+		serveAPIError(w, "failed reading stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-control", LiveCacheControl)
+	w.Header().Set("ETag", c.etag)
+	if checkNotModified(w, r, c.etag, c.modtime) {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(c.stats)
+}
+
+// monthStats returns the cached stats of month or sums its day stats when
+// they, or the nick lists of the previous month, changed
+func monthStats(channelPath, channel, month string) (*cachedStats, error) {
+	files, err := readDirIndex(filepath.Join(channelPath, month))
+	if err != nil {
+		return nil, err
+	}
+	var days, sources []string
+	for _, file := range files {
+		if strings.HasSuffix(file, common.DayStatsExtension+".gz") {
+			days = append(days, file)
+			sources = append(sources, filepath.Join(month, file))
+		}
+	}
+	if len(days) == 0 {
+		return nil, ErrNoStats
+	}
+	t, err := time.Parse("January 2006", month)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	prevMonth := t.AddDate(0, -1, 0).Format("January 2006")
+	var prevNicks []string
+	if files, err := readDirIndex(filepath.Join(channelPath, prevMonth)); err == nil {
+		for _, file := range files {
+			if NicksExtension.MatchString(file) {
+				prevNicks = append(prevNicks, file)
+				sources = append(sources, filepath.Join(prevMonth, file))
+			}
+		}
+	}
+
+	etag, modtime := logDirValidators(channelPath, sources)
+	if v, ok := statsCache.Get(filepath.Join(channelPath, month)); ok && v.(*cachedStats).etag == etag {
+		return v.(*cachedStats), nil
+	}
+
+	prev := common.NickListLower{}
+	for _, file := range prevNicks {
+		if err := common.ReadNickList(prev, filepath.Join(channelPath, prevMonth, file)); err != nil {
+			log.Warnf("error reading nicks %s %s", file, err)
+		}
+	}
+	stats, err := sumDayStats(filepath.Join(channelPath, month), days, prev)
+	if err != nil {
+		return nil, err
+	}
+	stats.Channel = channel
+	stats.Month = month
+	c := &cachedStats{etag, modtime, stats}
+	statsCache.Add(filepath.Join(channelPath, month), c)
+	return c, nil
+}
+
+// sumDayStats sums the stats files days of the month at path in date order,
+// prev holds the lower case nicks of the previous month
+func sumDayStats(path string, days []string, prev common.NickListLower) (*api.Stats, error) {
+	stats := &api.Stats{Days: make([]api.DayStats, 0, len(days))}
+	seen := common.NickListLower{}
+	words := map[string]int{}
+	emotes := map[string]int{}
+	for _, file := range days {
+		d, err := common.ReadDayStats(filepath.Join(path, file))
+		if err != nil {
+			return nil, err
+		}
+		day := api.DayStats{
+			Date:          d.Date,
+			Lines:         d.Lines,
+			Hours:         d.Hours,
+			BusiestMinute: d.BusiestMinute,
+		}
+		chatters := common.NickListLower{}
+		for _, nick := range d.Chatters {
+			chatters.Add(nick)
+		}
+		for nick := range chatters {
+			day.Chatters++
+			if _, ok := seen[nick]; ok {
+				day.ReturningChatters++
+				continue
+			}
+			seen[nick] = struct{}{}
+			if _, ok := prev[nick]; ok {
+				day.ReturningChatters++
+				stats.ReturningChatters++
+			} else {
+				day.NewChatters++
+				stats.NewChatters++
+			}
+		}
+		stats.Days = append(stats.Days, day)
+
+		stats.Lines += d.Lines
+		for h, n := range d.Hours {
+			stats.Hours[h] += n
+		}
+		if d.BusiestMinute.Lines > stats.BusiestMinute.Lines {
+			stats.BusiestMinute = d.BusiestMinute
+		}
+		for _, w := range d.Words {
+			words[w.Term] += w.Count
+		}
+		for _, e := range d.Emotes {
+			emotes[e.Term] += e.Count
+		}
+	}
+	stats.Chatters = len(seen)
+	stats.Words = common.TopTerms(words, common.StatsTopTerms)
+	stats.Emotes = common.TopTerms(emotes, common.StatsTopTerms)
+	return stats, nil
+}
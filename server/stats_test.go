@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/b-ggs/overrustlelogs/common"
+)
+
+func TestAPIStats(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	if _, err := c.Stats("foo", fixtureMonth); !isAPIError(err, 404) {
+		t.Errorf("expected 404 without day stats, got %v", err)
+	}
+
+	channelPath := filepath.Join(LogsPath, "Foo chatlog")
+	writeFixtureDay(t, filepath.Join(channelPath, "February 2020"), "2020-02-28", "[2020-02-28 10:00:00 UTC] alice: hey\n")
+	for date := range fixtureDays {
+		path := filepath.Join(channelPath, fixtureMonth, date+".txt.gz")
+		s, err := common.BuildDayStats(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := common.WriteDayStats(path, s.Stats()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := c.Stats("foo", fixtureMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Lines != 5 || stats.Chatters != 2 || stats.NewChatters != 1 || stats.ReturningChatters != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.Hours[10] != 3 || stats.Hours[8] != 2 {
+		t.Errorf("hours = %v", stats.Hours)
+	}
+	if stats.BusiestMinute.Time != 1583056800 || stats.BusiestMinute.Lines != 3 {
+		t.Errorf("busiest minute = %+v", stats.BusiestMinute)
+	}
+	if len(stats.Words) == 0 || stats.Words[0].Term != "kappa" || stats.Words[0].Count != 2 {
+		t.Errorf("words = %+v", stats.Words)
+	}
+	if len(stats.Days) != 2 {
+		t.Fatalf("days = %+v", stats.Days)
+	}
+	// alice spoke in february, bob is new on the first and returning after
+	if d := stats.Days[0]; d.Date != "2020-03-01" || d.Chatters != 2 || d.NewChatters != 1 || d.ReturningChatters != 1 {
+		t.Errorf("first day = %+v", d)
+	}
+	if d := stats.Days[1]; d.Date != "2020-03-02" || d.Chatters != 2 || d.NewChatters != 0 || d.ReturningChatters != 2 {
+		t.Errorf("second day = %+v", d)
+	}
+
+	res, _ := fixtureGet(t, c.BaseURL, "/api/v1/foo/"+fixtureMonth+"/stats.json", nil)
+	etag := res.Header.Get("ETag")
+	res, _ = fixtureGet(t, c.BaseURL, "/api/v1/foo/"+fixtureMonth+"/stats.json", http.Header{"If-None-Match": {etag}})
+	if etag == "" || res.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match status = %d etag %q", res.StatusCode, etag)
+	}
+}
+
+func TestAPIEmotes(t *testing.T) {
+	c, done := newFixtureServer(t)
+	defer done()
+
+	if _, err := c.Emotes("foo", fixtureMonth, ""); !isAPIError(err, 404) {
+		t.Errorf("expected 404 without day emotes, got %v", err)
+	}
+
+	registry := common.EmoteRegistry{"kappa": {}, "Bob": {}}
+	for date := range fixtureDays {
+		path := filepath.Join(LogsPath, "Foo chatlog", fixtureMonth, date+".txt.gz")
+		s, err := common.BuildDayStats(path, registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := common.WriteDayEmotes(path, s.Emotes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	emotes, err := c.Emotes("foo", fixtureMonth, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emotes.Channel != "Foo" || len(emotes.Emotes) != 2 {
+		t.Fatalf("emotes = %+v", emotes)
+	}
+	if e := emotes.Emotes[0]; e.Emote != "kappa" || e.Count != 2 || e.Users != 1 || len(e.Days) != 2 {
+		t.Errorf("kappa = %+v", e)
+	}
+	if e := emotes.Emotes[1]; e.Emote != "Bob" || e.Count != 1 || e.Users != 1 || len(e.Days) != 1 || e.Days[0].Date != "2020-03-01" {
+		t.Errorf("Bob = %+v", e)
+	}
+
+	emotes, err = c.Emotes("foo", fixtureMonth, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emotes.Nick != "alice" || len(emotes.Emotes) != 1 || emotes.Emotes[0].Emote != "Bob" {
+		t.Errorf("alice emotes = %+v", emotes)
+	}
+}
+
+// the month's top terms are summed from every term of the days, not the
+// days' top terms
+func TestSumDayStatsTerms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrustlelogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var days []string
+	for i, prefix := range []string{"w", "x"} {
+		date := fmt.Sprintf("2020-03-0%d", i+1)
+		c := common.NewDayStatsCounter(date, nil)
+		for j := 0; j < common.StatsTopTerms; j++ {
+			text := fmt.Sprintf("%s%03d %s%03d", prefix, j, prefix, j)
+			c.AddLine(&common.Message{Nick: "Bob", Data: text, Time: time.Unix(1583020800, 0)})
+		}
+		c.AddLine(&common.Message{Nick: "Bob", Data: "rare", Time: time.Unix(1583020800, 0)})
+		if err := common.WriteDayStats(filepath.Join(dir, date+".txt"), c.Stats()); err != nil {
+			t.Fatal(err)
+		}
+		days = append(days, date+common.DayStatsExtension+".gz")
+	}
+
+	stats, err := sumDayStats(dir, days, common.NickListLower{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Words) != common.StatsTopTerms || stats.Words[0] != (common.TermCount{Term: "rare", Count: 2}) {
+		t.Errorf("words = %+v", stats.Words[:3])
+	}
+}
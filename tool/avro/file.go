@@ -0,0 +1,42 @@
+package avro
+
+import (
+	"os"
+
+	"github.com/actgardner/gogen-avro/container"
+)
+
+// FileWriter writes messages to an avro object container file
+type FileWriter struct {
+	f *os.File
+	w *container.Writer
+}
+
+// CreateFile creates the container file at path, messages are written in
+// blocks of recordsPerBlock compressed with codec
+func CreateFile(path string, codec container.Codec, recordsPerBlock int64) (*FileWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewMessageWriter(f, codec, recordsPerBlock)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileWriter{f, w}, nil
+}
+
+// Write appends m to the file
+func (w *FileWriter) Write(m *Message) error {
+	return w.w.WriteRecord(m)
+}
+
+// Close writes the last block and closes the file
+func (w *FileWriter) Close() error {
+	err := w.w.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
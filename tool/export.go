@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/b-ggs/overrustlelogs/common"
+	"github.com/b-ggs/overrustlelogs/tool/avro"
+	"github.com/b-ggs/overrustlelogs/tool/parquet"
+	pb "gopkg.in/cheggaaa/pb.v1"
+)
+
+// export row counts of parquet row groups and avro blocks
+const (
+	exportRowsPerGroup    = 100000
+	exportRecordsPerBlock = 10000
+)
+
+// exportExtensions file extension of each export format
+var exportExtensions = map[string]string{
+	"parquet": ".parquet",
+	"csv":     ".csv",
+	"ndjson":  ".ndjson",
+	"avro":    ".avro",
+}
+
+var (
+	dayLogFile    = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2})\.txt(\.gz)?$`)
+	exportColumns = []parquet.Column{
+		{Name: "time", Type: parquet.Int64},
+		{Name: "channel", Type: parquet.String},
+		{Name: "nick", Type: parquet.String},
+		{Name: "message", Type: parquet.String},
+	}
+)
+
+// exportWriter writes the messages of a day to an export file
+type exportWriter interface {
+	Write(m *avro.Message) error
+	Close() error
+}
+
+// ./tool export --format parquet --channel Destinygg --from 2020-01-01 --to 2020-01-31 --out /path/to/export/
+func export() error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "ndjson", "output format, parquet, csv, ndjson or avro")
+	channel := flags.String("channel", "", "channel to export")
+	from := flags.String("from", "", "first day to export, 2006-01-02")
+	to := flags.String("to", "", "last day to export, 2006-01-02")
+	out := flags.String("out", "", "output directory")
+	logsPath := flags.String("logs", "/logs", "logs directory")
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+	ext, ok := exportExtensions[*format]
+	if !ok {
+		return fmt.Errorf("unsupported format %s", *format)
+	}
+	if *channel == "" || *out == "" {
+		return errors.New("channel and out are required")
+	}
+	for _, d := range []string{*from, *to} {
+		if _, err := time.Parse(dateFormat, d); d != "" && err != nil {
+			return fmt.Errorf("invalid date %s", d)
+		}
+	}
+
+	files, err := exportFiles(*logsPath, *channel, *from, *to)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no logs found")
+	}
+	var lines int
+	bar := pb.StartNew(len(files))
+	for _, file := range files {
+		n, err := exportFile(file, *out, *format, ext)
+		if err != nil {
+			bar.Finish()
+			return fmt.Errorf("error exporting %s %v", file, err)
+		}
+		lines += n
+		bar.Increment()
+	}
+	bar.Finish()
+	log.Printf("exported %d lines of %d days to %s", lines, len(files), *out)
+	return nil
+}
+
+// exportFiles day logs of channel between the dates from and to, either may
+// be empty, a plain log is preferred to its compressed version
+func exportFiles(logsPath, channel, from, to string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(logsPath, strings.Title(strings.ToLower(channel))+" chatlog", "*", "*.txt*"))
+	if err != nil {
+		return nil, err
+	}
+	days := map[string]string{}
+	for _, path := range paths {
+		match := dayLogFile.FindStringSubmatch(filepath.Base(path))
+		if match == nil || from != "" && match[1] < from || to != "" && match[1] > to {
+			continue
+		}
+		if _, ok := days[match[1]]; !ok || match[2] == "" {
+			days[match[1]] = path
+		}
+	}
+	files := make([]string, 0, len(days))
+	for _, path := range days {
+		files = append(files, path)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return filepath.Base(files[i]) < filepath.Base(files[j])
+	})
+	return files, nil
+}
+
+// exportFile writes the messages of the day log at path to
+// out/<channel>/<2006-01>/<2006-01-02><ext>, days without messages are
+// skipped
+func exportFile(path, out, format, ext string) (int, error) {
+	channel, err := common.ExtractChannelFromPath(path)
+	if err != nil {
+		return 0, err
+	}
+	var r io.ReadCloser
+	if strings.HasSuffix(path, ".gz") {
+		r, err = common.OpenCompressedFile(path)
+	} else {
+		r, err = os.Open(path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	date := dayLogFile.FindStringSubmatch(filepath.Base(path))[1]
+	dir := filepath.Join(out, channel, date[:7])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	dst := filepath.Join(dir, date+ext)
+	w, err := newExportWriter(format, dst+".writing")
+	if err != nil {
+		os.Remove(dst + ".writing")
+		return 0, err
+	}
+
+	n, err := writeExport(w, r, channel)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst + ".writing")
+		return n, err
+	}
+	if n == 0 {
+		return 0, os.Remove(dst + ".writing")
+	}
+	return n, os.Rename(dst+".writing", dst)
+}
+
+// writeExport writes the messages of the log r to w and returns their count
+func writeExport(w exportWriter, r io.Reader, channel string) (int, error) {
+	var n int
+	lines := common.NewLineReader(r)
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		m, err := common.ParseMessageLine(strings.TrimSuffix(string(line), "\n"))
+		if err != nil {
+			continue
+		}
+		if err := w.Write(avro.NewMessageFromCommonMessage(channel, m)); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func newExportWriter(format, path string) (exportWriter, error) {
+	if format == "avro" {
+		return avro.CreateFile(path, container.Snappy, exportRecordsPerBlock)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "parquet":
+		w, err := parquet.NewWriter(f, exportColumns, exportRowsPerGroup)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &parquetExport{f, w}, nil
+	case "csv":
+		w := csv.NewWriter(f)
+		if err := w.Write([]string{"time", "channel", "nick", "message"}); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &csvExport{f, w}, nil
+	}
+	b := bufio.NewWriter(f)
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	return &ndjsonExport{f, b, enc}, nil
+}
+
+type parquetExport struct {
+	f *os.File
+	w *parquet.Writer
+}
+
+func (e *parquetExport) Write(m *avro.Message) error {
+	return e.w.Write(m.Time, m.Channel, m.Nick, m.Message)
+}
+
+func (e *parquetExport) Close() error {
+	return closeExport(e.w.Close(), e.f)
+}
+
+type csvExport struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func (e *csvExport) Write(m *avro.Message) error {
+	return e.w.Write([]string{strconv.FormatInt(m.Time, 10), m.Channel, m.Nick, m.Message})
+}
+
+func (e *csvExport) Close() error {
+	e.w.Flush()
+	return closeExport(e.w.Error(), e.f)
+}
+
+// exportRecord ndjson line of a message
+type exportRecord struct {
+	Time    int64  `json:"time"`
+	Channel string `json:"channel"`
+	Nick    string `json:"nick"`
+	Message string `json:"message"`
+}
+
+type ndjsonExport struct {
+	f   *os.File
+	b   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *ndjsonExport) Write(m *avro.Message) error {
+	return e.enc.Encode(exportRecord{m.Time, m.Channel, m.Nick, m.Message})
+}
+
+func (e *ndjsonExport) Close() error {
+	return closeExport(e.b.Flush(), e.f)
+}
+
+// closeExport closes f returning err or else the close error
+func closeExport(err error, f *os.File) error {
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,250 @@
+// Package parquet writes flat parquet files of required int64 and string
+// columns, pages are plain encoded and snappy compressed
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// magic starts and ends parquet files
+const magic = "PAR1"
+
+// CreatedBy writer name stored in the footer
+const CreatedBy = "overrustlelogs"
+
+// ColumnType value type of a column
+type ColumnType int
+
+// column types, strings are UTF8 byte arrays
+const (
+	Int64 ColumnType = iota
+	String
+)
+
+// parquet enum values used by the writer
+const (
+	typeInt64          = 2
+	typeByteArray      = 6
+	repetitionRequired = 0
+	convertedUTF8      = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecSnappy        = 1
+	pageData           = 0
+)
+
+// Column required column of a file
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Writer writes rows to a parquet file, rows are buffered and written as a
+// row group every rowsPerGroup rows and on Close
+type Writer struct {
+	w            io.Writer
+	columns      []Column
+	rowsPerGroup int
+	values       []bytes.Buffer
+	rows         int
+	offset       int64
+	numRows      int64
+	groups       []rowGroup
+}
+
+type rowGroup struct {
+	rows   int64
+	size   int64
+	chunks []columnChunk
+}
+
+type columnChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+// NewWriter starts a parquet file of columns on w
+func NewWriter(w io.Writer, columns []Column, rowsPerGroup int) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("parquet files need at least one column")
+	}
+	if rowsPerGroup < 1 {
+		rowsPerGroup = 1
+	}
+	pw := &Writer{
+		w:            w,
+		columns:      columns,
+		rowsPerGroup: rowsPerGroup,
+		values:       make([]bytes.Buffer, len(columns)),
+	}
+	if err := pw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Write adds a row, an int64 or string value for each column
+func (w *Writer) Write(row ...interface{}) error {
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(row), len(w.columns))
+	}
+	for i, c := range w.columns {
+		switch v := row[i].(type) {
+		case int64:
+			if c.Type != Int64 {
+				return fmt.Errorf("int64 value for column %s", c.Name)
+			}
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], uint64(v))
+			w.values[i].Write(b[:])
+		case string:
+			if c.Type != String {
+				return fmt.Errorf("string value for column %s", c.Name)
+			}
+			var b [4]byte
+			binary.LittleEndian.PutUint32(b[:], uint32(len(v)))
+			w.values[i].Write(b[:])
+			w.values[i].WriteString(v)
+		default:
+			return fmt.Errorf("unsupported value %T for column %s", v, c.Name)
+		}
+	}
+	w.rows++
+	if w.rows >= w.rowsPerGroup {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes the buffered rows and the footer, it doesn't close the
+// underlying writer
+func (w *Writer) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	footer := w.footer()
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	for _, b := range [][]byte{footer, length[:], []byte(magic)} {
+		if err := w.write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group of one page per column
+func (w *Writer) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	g := rowGroup{rows: int64(w.rows), chunks: make([]columnChunk, len(w.columns))}
+	for i := range w.columns {
+		data := w.values[i].Bytes()
+		compressed := snappy.Encode(nil, data)
+
+		t := &thriftWriter{}
+		t.begin()
+		t.i32(1, pageData)
+		t.i32(2, int32(len(data)))
+		t.i32(3, int32(len(compressed)))
+		t.structField(5)
+		t.i32(1, int32(w.rows))
+		t.i32(2, encodingPlain)
+		t.i32(3, encodingRLE)
+		t.i32(4, encodingRLE)
+		t.end()
+		t.end()
+
+		header := t.buf.Bytes()
+		g.chunks[i] = columnChunk{
+			offset:       w.offset,
+			uncompressed: int64(len(header) + len(data)),
+			compressed:   int64(len(header) + len(compressed)),
+		}
+		g.size += g.chunks[i].uncompressed
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(compressed); err != nil {
+			return err
+		}
+		w.values[i].Reset()
+	}
+	w.groups = append(w.groups, g)
+	w.numRows += int64(w.rows)
+	w.rows = 0
+	return nil
+}
+
+// footer file metadata of the written row groups
+func (w *Writer) footer() []byte {
+	t := &thriftWriter{}
+	t.begin()
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(w.columns)+1)
+	t.begin()
+	t.string(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.end()
+	for _, c := range w.columns {
+		t.begin()
+		t.i32(1, c.physicalType())
+		t.i32(3, repetitionRequired)
+		t.string(4, c.Name)
+		if c.Type == String {
+			t.i32(6, convertedUTF8)
+		}
+		t.end()
+	}
+	t.i64(3, w.numRows)
+	t.list(4, thriftStruct, len(w.groups))
+	for _, g := range w.groups {
+		t.begin()
+		t.list(1, thriftStruct, len(g.chunks))
+		for i, chunk := range g.chunks {
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, w.columns[i].physicalType())
+			t.list(2, thriftI32, 2)
+			t.i32Value(encodingPlain)
+			t.i32Value(encodingRLE)
+			t.list(3, thriftBinary, 1)
+			t.stringValue(w.columns[i].Name)
+			t.i32(4, codecSnappy)
+			t.i64(5, g.rows)
+			t.i64(6, chunk.uncompressed)
+			t.i64(7, chunk.compressed)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, g.size)
+		t.i64(3, g.rows)
+		t.end()
+	}
+	t.string(6, CreatedBy)
+	t.end()
+	return t.buf.Bytes()
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return err
+}
+
+func (c Column) physicalType() int32 {
+	if c.Type == Int64 {
+		return typeInt64
+	}
+	return typeByteArray
+}
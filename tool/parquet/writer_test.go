@@ -0,0 +1,141 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+// thriftReader decodes compact protocol structs into maps of field ids
+type thriftReader struct {
+	b []byte
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case thriftList:
+		h := r.b[0]
+		r.b = r.b[1:]
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		l := make([]interface{}, n)
+		for i := range l {
+			l[i] = r.value(h & 0x0f)
+		}
+		return l
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic("unexpected thrift type")
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	s := map[int16]interface{}{}
+	var id int16
+	for {
+		h := r.b[0]
+		r.b = r.b[1:]
+		if h == 0 {
+			return s
+		}
+		if d := h >> 4; d != 0 {
+			id += int16(d)
+		} else {
+			id = int16(r.varint())
+		}
+		s[id] = r.value(h & 0x0f)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{{"time", Int64}, {"nick", String}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []struct {
+		time int64
+		nick string
+	}{{1, "Bob"}, {2, "Alice"}, {-3, "Eve"}}
+	for _, row := range rows {
+		if err := w.Write(row.time, row.nick); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write("Bob", int64(1)); err == nil {
+		t.Error("expected error writing mistyped row")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if string(b[:4]) != magic || string(b[len(b)-4:]) != magic {
+		t.Fatal("missing magic")
+	}
+	length := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	footer := (&thriftReader{b[len(b)-8-length : len(b)-8]}).readStruct()
+	if footer[3].(int64) != 3 {
+		t.Errorf("expected 3 rows, got %v", footer[3])
+	}
+	schema := footer[2].([]interface{})
+	if len(schema) != 3 || schema[2].(map[int16]interface{})[4] != "nick" {
+		t.Errorf("unexpected schema %v", schema)
+	}
+
+	groups := footer[4].([]interface{})
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 row groups, got %d", len(groups))
+	}
+	var times []int64
+	var nicks []string
+	for _, g := range groups {
+		chunks := g.(map[int16]interface{})[1].([]interface{})
+		for i, c := range chunks {
+			meta := c.(map[int16]interface{})[3].(map[int16]interface{})
+			r := &thriftReader{b[meta[9].(int64):]}
+			page := r.readStruct()
+			data, err := snappy.Decode(nil, r.b[:page[3].(int64)])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for len(data) > 0 {
+				if i == 0 {
+					times = append(times, int64(binary.LittleEndian.Uint64(data)))
+					data = data[8:]
+					continue
+				}
+				n := binary.LittleEndian.Uint32(data)
+				nicks = append(nicks, string(data[4:4+n]))
+				data = data[4+n:]
+			}
+		}
+	}
+	for i, row := range rows {
+		if i >= len(times) || i >= len(nicks) || times[i] != row.time || nicks[i] != row.nick {
+			t.Fatalf("expected rows %v, got %v %v", rows, times, nicks)
+		}
+	}
+}
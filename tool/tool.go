@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
@@ -14,15 +13,14 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
-	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/b-ggs/overrustlelogs/common"
-	"github.com/b-ggs/overrustlelogs/tool/avro"
-	"github.com/actgardner/gogen-avro/container"
+	"github.com/b-ggs/overrustlelogs/jobs"
 	lz4 "github.com/cloudflare/golz4"
 	"github.com/pkg/profile"
 	pb "gopkg.in/cheggaaa/pb.v1"
@@ -36,11 +34,17 @@ var commands = map[string]command{
 	"read":             read,
 	"readnicks":        readNicks,
 	"nicks":            nicks,
+	"index":            searchIndex,
 	"migrate":          migrate,
 	"namechange":       namechange,
 	"cleanup":          cleanup,
 	"convert":          convertToZSTD,
 	"createtoplist":    createTopList,
+	"createstats":      createStats,
+	"export":           export,
+	"migratetoplists":  migrateTopLists,
+	"reframe":          reframe,
+	"nickindex":        nickIndex,
 	"uploadToBigQuery": uploadToBigQuery,
 }
 
@@ -89,25 +93,16 @@ func nicks() error {
 		return errors.New("not enough args")
 	}
 	path := os.Args[2]
-	var data []byte
-	data, err := common.ReadCompressedFile(path)
-	if os.IsNotExist(err) {
-		f, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		data, err = ioutil.ReadAll(f)
-		if err != nil {
-			return err
-		}
-	} else if err != nil {
+	data, err := openLog(path)
+	if err != nil {
 		return err
 	}
-	r := bufio.NewReaderSize(bytes.NewReader(data), len(data))
+	defer data.Close()
+	r := common.NewLineReader(data)
 	nick := regexp.MustCompile("^\\[[^\\]]+\\]\\s*([a-zA-Z0-9\\_\\-]+):")
 	nicks := common.NickList{}
 	for {
-		line, err := r.ReadSlice('\n')
+		line, err := r.Next()
 		if err != nil {
 			if err != io.EOF {
 				return err
@@ -122,17 +117,38 @@ func nicks() error {
 	return nicks.WriteTo(regexp.MustCompile("\\.txt(\\.gz)?$").ReplaceAllString(path, ".nicks"))
 }
 
+// ./tool index "/path/to/logs/Destinygg chatlog/March 2020/2020-03-01.txt.gz"
+func searchIndex() error {
+	if len(os.Args) < 3 {
+		return errors.New("not enough args")
+	}
+	path := os.Args[2]
+	data, err := openLog(path)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	index, err := common.BuildSearchIndex(data)
+	if err != nil {
+		return err
+	}
+	return index.WriteTo(regexp.MustCompile("\\.txt(\\.gz)?$").ReplaceAllString(path, ".index"))
+}
+
 func read() error {
 	if len(os.Args) < 3 {
 		return errors.New("not enough args")
 	}
 	path := os.Args[2]
 	if regexp.MustCompile("\\.txt\\.gz$").MatchString(path) {
-		buf, err := common.ReadCompressedFile(path)
+		r, err := common.OpenCompressedFile(path)
 		if err != nil {
 			return err
 		}
-		os.Stdout.Write(buf)
+		defer r.Close()
+		if _, err := io.Copy(os.Stdout, r); err != nil {
+			return err
+		}
 	} else {
 		return errors.New("invalid file")
 	}
@@ -206,48 +222,66 @@ func namechange() error {
 
 	log = strings.Replace(log, "nicks", "txt", 1)
 
-	d, err := common.ReadCompressedFile(log)
-	if err != nil {
-		fmt.Println(err)
+	if err := rewriteLog(log, func(line []byte, w io.Writer) error {
+		_, err := replacer.WriteString(w, string(line))
 		return err
-	}
-
-	newData := []byte(replacer.Replace(string(d)))
-	f, err := common.WriteCompressedFile(log, newData)
-	if err != nil {
+	}); err != nil {
 		fmt.Println(err)
 		return err
 	}
-	fmt.Println("replaced nicks in", f.Name())
-	f.Close()
+	fmt.Println("replaced nicks in", log)
 	return nil
 }
 
-func cleanup() error {
-	now := time.Now()
-
-	logsPath := os.Args[2]
+// openLog opens a log for streaming, compressed or not
+func openLog(path string) (io.ReadCloser, error) {
+	r, err := common.OpenCompressedFile(path)
+	if os.IsNotExist(err) {
+		return os.Open(path)
+	}
+	return r, err
+}
 
-	filepaths, err := filepath.Glob(filepath.Join(logsPath, "/*/*/*"))
+// rewriteLog streams the lines of a compressed log through fn into a new
+// file which then replaces the log
+func rewriteLog(path string, fn func(line []byte, w io.Writer) error) error {
+	path = strings.TrimSuffix(path, ".gz")
+	r, err := common.OpenCompressedFile(path)
 	if err != nil {
-		log.Printf("error getting filepaths: %v", err)
 		return err
 	}
-	log.Printf("found %d files, starting cleanup...", len(filepaths))
-
-	r := regexp.MustCompile(`\.gz$`)
-
-	for _, fp := range filepaths {
-		if r.MatchString(fp) || strings.Contains(fp, now.Format("2006-01-02")) {
-			continue
+	defer r.Close()
+	w, err := common.CreateCompressedFile(path + ".new")
+	if err != nil {
+		return err
+	}
+	lines := common.NewLineReader(r)
+	for {
+		line, err := lines.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = fn(line, w)
 		}
-		_, err := common.CompressFile(fp)
 		if err != nil {
-			log.Panicf("error writing compressed file: %v", err)
+			w.Close()
+			os.Remove(path + ".new.gz")
+			return err
 		}
-		log.Println("compressed", fp)
 	}
-	return nil
+	if err := w.Close(); err != nil {
+		os.Remove(path + ".new.gz")
+		return err
+	}
+	return os.Rename(path+".new.gz", path+".gz")
+}
+
+func cleanup() error {
+	return jobs.CleanupLogs(os.Args[2], func(path string) error {
+		_, err := common.CompressFile(path)
+		return err
+	})
 }
 
 func convertToZSTD() error {
@@ -332,113 +366,218 @@ func lz4Path(path string) string {
 	return path
 }
 
-// ./tool createToplist /path/to/logs/ "September *"
-func createTopList() error {
-
-	month := os.Args[3]
-	logsPath := os.Args[2]
-
-	filepaths, err := filepath.Glob(filepath.Join(logsPath, "/*", month))
+// ./tool reframe "/path/to/logs/*/*/*.txt.gz" [frame lines]
+// rewrites compressed logs into seekable hourly frames, logs that already
+// have a frame index are skipped
+func reframe() error {
+	if len(os.Args) < 3 {
+		return errors.New("not enough args")
+	}
+	frameLines := common.SeekableFrameLines
+	if len(os.Args) > 3 {
+		n, err := strconv.Atoi(os.Args[3])
+		if err != nil {
+			return fmt.Errorf("invalid frame lines %s", os.Args[3])
+		}
+		frameLines = n
+	}
+	files, err := filepath.Glob(os.Args[2])
 	if err != nil {
-		log.Printf("error getting filepaths: %v", err)
 		return err
 	}
 
-	for _, mpath := range filepaths {
-		fmt.Printf("creating toplist for %s\n", mpath)
-		toplist := make(map[string]*user)
-
-		files, err := ioutil.ReadDir(mpath)
+	bar := pb.StartNew(len(files))
+	var reframed int
+	for _, path := range files {
+		bar.Increment()
+		if !strings.HasSuffix(path, ".txt.gz") {
+			continue
+		}
+		s, err := common.OpenSeekable(path)
+		if err == nil {
+			s.Close()
+			continue
+		} else if err != common.ErrNotSeekable {
+			log.Println(err, path)
+			continue
+		}
+		r, err := common.OpenCompressedFile(path)
 		if err != nil {
-			fmt.Printf("error reading folder: %s with: %v", mpath, err)
+			log.Println(err, path)
 			continue
 		}
+		err = common.WriteSeekableFile(path, r, frameLines)
+		r.Close()
+		if err != nil {
+			log.Println(err, path)
+			continue
+		}
+		reframed++
+	}
+	bar.Finish()
+	log.Printf("reframed %d of %d logs", reframed, len(files))
+	return nil
+}
 
-		for _, file := range files {
-			if !strings.HasSuffix(file.Name(), ".txt.gz") {
-				continue
-			}
-			b, err := common.ReadCompressedFile(filepath.Join(mpath, file.Name()))
-			if err != nil {
-				fmt.Printf("error: %v reading file %s", err, file.Name())
-				continue
-			}
-
-			buf := bytes.NewBuffer(b)
-			scanner := bufio.NewScanner(buf)
-
-			for scanner.Scan() {
-				line := scanner.Bytes()
-				// some 2016 files are borked
-				if !strings.HasPrefix(scanner.Text(), "[") {
-					continue
-				}
-
-				endofdate := bytes.Index(line, []byte("UTC] "))
-				if len(line) <= endofdate || endofdate < 6 {
-					continue
-				}
-				endofdate += 5
-				endofnick := bytes.Index(line[endofdate:], []byte(":"))
-				if endofnick == -1 {
-					continue
-				}
-
-				nick := line[endofdate : endofnick+endofdate]
+// ./tool nickindex "/path/to/logs/Destinygg chatlog"
+// rebuilds the channel's nick index from its logs and marks it complete, the
+// logger keeps it current afterwards. The days the logger may have written
+// during the rebuild are recounted right before the index is replaced.
+func nickIndex() error {
+	if len(os.Args) < 3 {
+		return errors.New("not enough args")
+	}
+	channelPath := os.Args[2]
+	since := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	files, err := nickIndexFiles(channelPath, "")
+	if err != nil {
+		return err
+	}
 
+	entries := map[string]*common.NickIndexEntry{}
+	bar := pb.StartNew(len(files))
+	for _, path := range files {
+		bar.Increment()
+		addNickIndexDay(entries, path)
+	}
+	bar.Finish()
 
-				if _, ok := toplist[string(nick)]; !ok {
-					toplist[string(nick)] = &user{
-						Lines:    1,
-						Bytes:    len(line[endofnick+endofdate:]),
-						Username: string(nick),
-					}
-					continue
-				}
+	recent, err := nickIndexFiles(channelPath, since)
+	if err != nil {
+		return err
+	}
+	for _, path := range recent {
+		addNickIndexDay(entries, path)
+	}
 
-				toplist[string(nick)].Lines++
-				toplist[string(nick)].Bytes += len(line[endofnick+endofdate:])
-			}
+	log.Printf("writing index of %d nicks", len(entries))
+	return common.NewNickIndex(channelPath).Replace(entries)
+}
 
-			if err := scanner.Err(); err != nil {
-				fmt.Fprintln(os.Stderr, "reading standard input:", err)
-			}
+// nickIndexFiles day logs of the channel at path dated since or later
+func nickIndexFiles(channelPath, since string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(channelPath, "*", "*.txt*"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, path := range paths {
+		if !regexp.MustCompile("\\.txt(\\.gz)?$").MatchString(path) || filepath.Base(path) < since {
+			continue
 		}
+		files = append(files, path)
+	}
+	return files, nil
+}
 
-		users := []*user{}
-		for _, u := range toplist {
-			users = append(users, u)
+// addNickIndexDay sets the day of each nick of the day log at path, case
+// variants are merged
+func addNickIndexDay(entries map[string]*common.NickIndexEntry, path string) {
+	days, err := countNickDay(path)
+	if err != nil {
+		log.Println(err, path)
+		return
+	}
+	for nick, d := range common.MergeNickCases(days) {
+		lower := strings.ToLower(nick)
+		e, ok := entries[lower]
+		if !ok {
+			e = &common.NickIndexEntry{Nick: nick}
+			entries[lower] = e
 		}
-		sort.Sort(ByLines(users))
+		e.Set(nick, d)
+	}
+}
 
-		var buf bytes.Buffer
-		err = gob.NewEncoder(&buf).Encode(users)
-		if err != nil {
-			fmt.Printf("error encoding users: %v", err)
+// countNickDay line stats of each nick in a day log
+func countNickDay(path string) (map[string]*common.NickDay, error) {
+	name := filepath.Base(path)
+	date := name[:strings.Index(name, ".")]
+	r, err := openLog(strings.TrimSuffix(path, ".gz"))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return common.CountNickDays(r, date)
+}
+
+// ./tool migratetoplists "/path/to/logs/*/*/toplist.json.gz"
+// converts gob encoded toplists to the versioned json format, toplists that
+// already are are skipped
+func migrateTopLists() error {
+	if len(os.Args) < 3 {
+		return errors.New("not enough args")
+	}
+	files, err := filepath.Glob(os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	var migrated int
+	for _, path := range files {
+		if _, err := common.ReadTopList(path); err == nil {
 			continue
 		}
-
-		_, err = common.WriteCompressedFile(filepath.Join(mpath, "toplist.json.gz"), buf.Bytes())
-		if err != nil {
-			fmt.Printf("error writing toplist file: %v", err)
+		if err := migrateTopList(path); err != nil {
+			log.Println(err, path)
+			continue
 		}
+		migrated++
 	}
-
+	log.Printf("migrated %d of %d toplists", migrated, len(files))
 	return nil
 }
 
-type user struct {
+// legacyTopListUser fields of the gob encoded toplists, older files lack Seen
+type legacyTopListUser struct {
 	Username string
 	Lines    int
 	Bytes    int
+	Seen     int64
 }
 
-// ByLines sort impelmentation for user line count aggregates
-type ByLines []*user
+func migrateTopList(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := common.ReadCompressedFile(path)
+	if err != nil {
+		return err
+	}
+	var users []*legacyTopListUser
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&users); err != nil {
+		return fmt.Errorf("error decoding gob toplist %v", err)
+	}
 
-func (a ByLines) Len() int           { return len(a) }
-func (a ByLines) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a ByLines) Less(i, j int) bool { return a[i].Lines > a[j].Lines }
+	t := &common.TopList{
+		Generated: fi.ModTime().Unix(),
+		Users:     make([]common.TopListUser, 0, len(users)),
+	}
+	for _, u := range users {
+		t.Users = append(t.Users, common.TopListUser{
+			Username: u.Username,
+			Lines:    u.Lines,
+			Bytes:    u.Bytes,
+			Seen:     u.Seen,
+		})
+	}
+	return common.WriteTopList(path, t)
+}
+
+// ./tool createToplist /path/to/logs/ "September *"
+func createTopList() error {
+	return jobs.CreateTopList(os.Args[2], os.Args[3])
+}
+
+// ./tool createstats /path/to/logs/ "September *" [/path/to/emotes/]
+func createStats() error {
+	var emotesPath string
+	if len(os.Args) > 4 {
+		emotesPath = os.Args[4]
+	}
+	return jobs.CreateStats(os.Args[2], emotesPath, os.Args[3])
+}
 
 func uncompressAll() error {
 	logsPath := os.Args[2]
@@ -546,30 +685,13 @@ func delete() error {
 
 				path = strings.Replace(path, ".nicks", ".txt", -1)
 
-				b, err := common.ReadCompressedFile(path)
+				var deletedLines int64
+				err := rewriteLog(path, removeUserFromLog(nicksToDelete, &deletedLines))
 				if err != nil {
 					log.Println(err, path)
 					continue
 				}
-
-				lines := strings.Split(string(b), "\n")
-				deletedLines, d, err := removeUserFromLog(lines, nicksToDelete)
-				if err != nil {
-					continue
-				}
-				if deletedLines > 0 {
-					atomic.AddInt64(&deletedLinesCount, int64(deletedLines))
-				}
-
-				f, err := common.WriteCompressedFile(path+".new", d)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
-				if err := os.Rename(f.Name(), path); err != nil {
-					log.Println(err)
-					os.Remove(path + ".new")
-				}
+				atomic.AddInt64(&deletedLinesCount, deletedLines)
 			}
 			wg.Done()
 		}(i, queue)
@@ -587,27 +709,21 @@ func delete() error {
 	return nil
 }
 
-func removeUserFromLog(lines []string, nicksToDelete map[string]struct{}) (int, []byte, error) {
-	buf := bytes.NewBuffer([]byte{})
-
-	var linesDeletedCount int
-	for _, line := range lines {
-		msg, err := common.ParseMessageLine(line)
+// removeUserFromLog rewriteLog line func dropping the lines of nicksToDelete
+// and counting them in deleted
+func removeUserFromLog(nicksToDelete map[string]struct{}, deleted *int64) func([]byte, io.Writer) error {
+	return func(line []byte, w io.Writer) error {
+		msg, err := common.ParseMessageLine(strings.TrimSuffix(string(line), "\n"))
 		if err != nil {
-			continue
+			return nil
 		}
 		if _, ok := nicksToDelete[msg.Nick]; ok {
-			linesDeletedCount++
-			continue
+			*deleted++
+			return nil
 		}
-		buf.WriteString(line)
-		buf.WriteString("\n")
-	}
-
-	if linesDeletedCount == 0 {
-		return 0, nil, errors.New("no lines were removed")
+		_, err = w.Write(line)
+		return err
 	}
-	return linesDeletedCount, buf.Bytes(), nil
 }
 
 func removeNick(nicks map[string]struct{}, path string) (bool, error) {
@@ -633,111 +749,5 @@ func removeNick(nicks map[string]struct{}, path string) (bool, error) {
 
 //tool uploadToBigQuery bqconfig.json /path/to/logs/ "2018-01-01"
 func uploadToBigQuery() error {
-	logsPath := os.Args[3]
-	if logsPath == "" {
-		return fmt.Errorf("didn't provide a path to the logs")
-	}
-
-	date := os.Args[4]
-	if date == "" {
-		return fmt.Errorf("didn't provide a date load")
-	}
-
-	// parse bq config
-	var bigqueryWriterConfig common.BigQueryWriterConfig
-
-	b, err := ioutil.ReadFile(os.Args[2])
-	if err != nil {
-		return fmt.Errorf("error reading bigquery config file: %v", err)
-	}
-
-	err = json.Unmarshal(b, &bigqueryWriterConfig)
-	if err != nil {
-		return fmt.Errorf("error reading writer config: %v", err)
-	}
-
-	bufferConfig := struct {
-		RecordsPerBlock int64 `json:"recordsPerBlock"`
-		BytesPerFile    int   `json:"bytesPerFile"`
-	}{}
-	err = json.Unmarshal(b, &bufferConfig)
-	if err != nil {
-		return fmt.Errorf("error reading avro buffer config: %v", err)
-	}
-
-	// create bq client
-	tableDatestamp := strings.Replace(date, "-", "", -1)
-	bigqueryWriterConfig.TableID += "_" + tableDatestamp[0:6] + "01"
-	bq, err := common.NewBigQueryWriter(bigqueryWriterConfig)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// upload log files
-	buffer, err := common.NewAvroBuffer(
-		avro.NewMessageWriter,
-		bq,
-		container.Snappy,
-		bufferConfig.RecordsPerBlock,
-		bufferConfig.BytesPerFile,
-	)
-	if err != nil {
-		log.Printf("error creating buffer: %v\n", err)
-	}
-
-	// find log files
-	fileNamePattern := fmt.Sprintf("%s.txt.gz", date)
-	pathPattern := filepath.Join(logsPath, "*", "*", fileNamePattern)
-	files, err := filepath.Glob(pathPattern)
-	if err != nil || len(files) < 1 {
-		log.Println("couldn't find any log files for this date in", logsPath)
-		return err
-	}
-
-	bar := pb.StartNew(len(files))
-
-	for _, file := range files {
-		if err := loadLogFileIntoAvroBuffer(file, buffer); err != nil {
-			log.Println(err)
-		}
-		bar.Increment()
-	}
-
-	if err := buffer.Flush(); err != nil {
-		log.Printf("error flushing buffer to bigquery: %v\n", err)
-	}
-
-	bar.Finish()
-
-	return nil
-}
-
-func loadLogFileIntoAvroBuffer(file string, buffer *common.AvroBuffer) error {
-	channel, err := common.ExtractChannelFromPath(file)
-	if err != nil {
-		return err
-	}
-	b, err := common.ReadCompressedFile(file)
-	if err != nil {
-		return err
-	}
-
-	lines := strings.Split(string(b), "\n")
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
-		}
-
-		message, err := common.ParseMessageLine(line)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-
-		if err := buffer.WriteRecord(avro.NewMessageFromCommonMessage(channel, message)); err != nil {
-			log.Println(err)
-		}
-	}
-
-	return nil
+	return jobs.UploadToBigQuery(os.Args[2], os.Args[3], os.Args[4])
 }